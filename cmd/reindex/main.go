@@ -0,0 +1,46 @@
+package main
+
+// reindex rebuilds the embedded search index file from
+// every comment in the store, run it while the api is stopped
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/db"
+	"github.com/imraan1901/comment-section-rest-api/internal/search"
+)
+
+func Run() error {
+	ctx := context.Background()
+
+	path := os.Getenv("SEARCH_INDEX_PATH")
+	if path == "" {
+		path = search.DefaultIndexPath
+	}
+
+	store, err := db.NewDatabase(ctx)
+	if err != nil {
+		fmt.Println("Failed to connect to the database")
+		return err
+	}
+
+	idx := search.NewIndex()
+	if err := idx.Rebuild(ctx, store); err != nil {
+		return err
+	}
+	if err := idx.SaveFile(path); err != nil {
+		return err
+	}
+
+	fmt.Printf("indexed %d comments into %s\n", idx.Len(), path)
+	return nil
+}
+
+func main() {
+	if err := Run(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
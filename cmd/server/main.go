@@ -5,13 +5,25 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/imraan1901/comment-section-rest-api/internal/comment"
 	"github.com/imraan1901/comment-section-rest-api/internal/db"
+	"github.com/imraan1901/comment-section-rest-api/internal/email"
+	"github.com/imraan1901/comment-section-rest-api/internal/events"
+	"github.com/imraan1901/comment-section-rest-api/internal/outbox"
+	"github.com/imraan1901/comment-section-rest-api/internal/processor"
+	"github.com/imraan1901/comment-section-rest-api/internal/search"
+	transportGraphql "github.com/imraan1901/comment-section-rest-api/internal/transport/graphql"
+	transportGrpc "github.com/imraan1901/comment-section-rest-api/internal/transport/grpc"
+	"github.com/imraan1901/comment-section-rest-api/internal/webhook"
 	transportHttp "github.com/imraan1901/comment-section-rest-api/internal/transport/http"
+	"github.com/nats-io/nats.go"
 
 
 	tr "go.opentelemetry.io/otel/trace"
@@ -51,6 +63,51 @@ func newExporter(w io.Writer) (trace.SpanExporter, error) {
 // name is the Tracer name used to identify this instrumentation library.
 const name = "main"
 
+// spamThreshold - reads SPAM_THRESHOLD, falling back to the
+// processor default when it is unset or not a probability
+func spamThreshold() float64 {
+	threshold, err := strconv.ParseFloat(os.Getenv("SPAM_THRESHOLD"), 64)
+	if err != nil || threshold <= 0 || threshold > 1 {
+		return processor.DefaultSpamThreshold
+	}
+	return threshold
+}
+
+// eventPublisher - the broker picked by EVENT_BROKER, events published
+// to it on any server are fed into bus on this one until ctx is done
+func eventPublisher(ctx context.Context, database *db.Database, bus *events.Bus) (comment.EventPublisher, error) {
+	switch os.Getenv("EVENT_BROKER") {
+	case "", "inprocess":
+		return bus, nil
+	case "postgres":
+		go func() {
+			if err := database.ListenForEvents(ctx, bus.Publish); err != nil {
+				fmt.Println(err)
+			}
+		}()
+		return database, nil
+	case "nats":
+		url := os.Getenv("NATS_URL")
+		if url == "" {
+			url = nats.DefaultURL
+		}
+		conn, err := nats.Connect(url)
+		if err != nil {
+			return nil, fmt.Errorf("could not connect to nats: %w", err)
+		}
+		go func() {
+			<-ctx.Done()
+			conn.Close()
+		}()
+		publisher := events.NewNATSPublisher(conn, os.Getenv("NATS_SUBJECT"))
+		if _, err := publisher.Subscribe(bus); err != nil {
+			return nil, fmt.Errorf("could not subscribe to nats: %w", err)
+		}
+		return publisher, nil
+	}
+	return nil, fmt.Errorf("unknown EVENT_BROKER %q", os.Getenv("EVENT_BROKER"))
+}
+
 // Run - is responsible for
 // the instantiation and startup of our
 // go application
@@ -102,11 +159,127 @@ func Run() error {
 
 	fmt.Println("successfully connected and pinged database")
 
-	// DB layer passed into business layer
-	cmtService := comment.NewService(db)
+	// DB layer passed into business layer along with
+	// the stages every new comment is processed by
+	classifier := processor.NewSpamClassifier()
+	cmtService := comment.NewService(
+		db,
+		processor.NewPIIStage(db),
+		processor.NewDuplicateStage(db),
+		processor.NewRuleStage(db),
+		processor.NewSpamStage(classifier, spamThreshold()),
+		processor.NewMentionStage(),
+		processor.NewMarkdownStage(),
+	)
+	cmtService.Classifier = classifier
+	if err := cmtService.LoadSpamModel(ctx); err != nil {
+		fmt.Println("failed to load spam model")
+		return err
+	}
+
+	// The service emits every relayed event to the configured broker,
+	// each server keeps its own state up to date from the bus it feeds
+	bus := events.NewBus()
+	brokerCtx, stopBroker := context.WithCancel(ctx)
+	defer stopBroker()
+	publisher, err := eventPublisher(brokerCtx, db, bus)
+	if err != nil {
+		fmt.Println("failed to set up the event broker")
+		return err
+	}
+	cmtService.Publisher = publisher
+
+	// Live comment streams are fed by the bus
+	hub := events.NewHub()
+	bus.Subscribe(hub)
+
+	// Work done once per event is fed from the outbox
+	listeners := []outbox.Listener{{Name: "notifications", Listener: cmtService}}
+
+	// Postgres searches comments itself, other stores need the
+	// embedded index on every server kept up to date by the bus
+	if os.Getenv("SEARCH_BACKEND") == "embedded" {
+		indexPath := os.Getenv("SEARCH_INDEX_PATH")
+		if indexPath == "" {
+			indexPath = search.DefaultIndexPath
+		}
+		idx := search.NewIndex()
+		if err := idx.LoadFile(ctx, indexPath, db); err != nil {
+			fmt.Println("failed to load search index")
+			return err
+		}
+		// Saved as it changes, so a crash loses little, and once more on the way out
+		saveCtx, stopSaving := context.WithCancel(ctx)
+		saved := make(chan struct{})
+		go func() {
+			idx.SaveEvery(saveCtx, indexPath, db, search.DefaultSaveInterval)
+			close(saved)
+		}()
+		defer func() {
+			stopSaving()
+			<-saved
+		}()
+		cmtService.Search = idx
+		unsubscribe := bus.Subscribe(idx)
+		defer unsubscribe()
+	}
+
+	// Every comment event is queued for the registered
+	// webhooks and delivered in the background
+	dispatcher := webhook.NewDispatcher(db)
+	listeners = append(listeners, outbox.Listener{Name: "webhooks", Listener: dispatcher})
+	webhookCtx, stopWebhooks := context.WithCancel(ctx)
+	defer stopWebhooks()
+	go dispatcher.Run(webhookCtx)
+
+	// Only one server holds a claim on the outbox at a time, the
+	// others wait for its events to be relayed or its lease to run out
+	relay := outbox.NewRelay(db, listeners...)
+	relayCtx, stopRelay := context.WithCancel(ctx)
+	defer stopRelay()
+	go relay.Run(relayCtx)
+
+	// Notification digests are only emailed when there is
+	// an SMTP server to send them through
+	if smtpAddr := os.Getenv("SMTP_ADDR"); smtpAddr != "" {
+		host, _, err := net.SplitHostPort(smtpAddr)
+		if err != nil {
+			fmt.Println("SMTP_ADDR must be host:port")
+			return err
+		}
+		sender := email.NewSMTPSender(smtpAddr, host, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+		digester := email.NewDigester(db, sender, os.Getenv("EMAIL_FROM"), os.Getenv("PUBLIC_URL"), os.Getenv("COMMENT_URL"))
+		digestCtx, stopDigests := context.WithCancel(ctx)
+		defer stopDigests()
+		go digester.Run(digestCtx)
+	}
+
+	// Internal services call the same business layer over gRPC
+	grpcServer := transportGrpc.NewServer(cmtService)
+	grpcServer.Hub = hub
+	if addr := os.Getenv("GRPC_ADDR"); addr != "" {
+		grpcServer.Addr = addr
+	}
+	grpcCtx, stopGrpc := context.WithCancel(ctx)
+	defer stopGrpc()
+	go func() {
+		if err := grpcServer.Serve(grpcCtx); err != nil {
+			fmt.Println(err)
+		}
+	}()
 
 	// business layer passed into transport/http layer
 	httpHandler := transportHttp.NewHandler(cmtService)
+	httpHandler.Hub = hub
+	if origins := os.Getenv("ALLOWED_ORIGINS"); origins != "" {
+		httpHandler.AllowedOrigins = strings.Split(origins, ",")
+	}
+	// The frontend fetches a thread and everything on it in one query
+	graphqlHandler, err := transportGraphql.NewHandler(cmtService)
+	if err != nil {
+		return err
+	}
+	httpHandler.GraphQL = graphqlHandler
 	if err := httpHandler.Serve(ctx); err != nil {
 		return err
 	}
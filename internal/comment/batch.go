@@ -0,0 +1,182 @@
+package comment
+
+import (
+	"context"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+// maxRepliesPerComment - the most replies read back per comment
+const maxRepliesPerComment = 50
+
+// BatchStore - reads many comments at once, for transports
+// that would otherwise fetch them one at a time
+type BatchStore interface {
+	GetComments(ctx context.Context, ids []string) ([]datastructs.Comment, error)
+	ListReplies(ctx context.Context, parentIDs []string, limit int) ([]datastructs.Comment, error)
+	ListPinnedCommentsOn(ctx context.Context, slugs []string) ([]datastructs.Comment, error)
+	ListCommentPages(ctx context.Context, sort string, featured bool, pages []datastructs.ListQuery) ([][]datastructs.Comment, error)
+	GetAuthorProfiles(ctx context.Context, authors []string) ([]datastructs.AuthorProfile, error)
+}
+
+// GetComments - the approved comments with the given ids keyed
+// by id, with their reactions, ids of any others are left out
+func (s *Service) GetComments(ctx context.Context, ids []string) (map[string]datastructs.Comment, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "GetComments", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	cmts, err := s.Store.GetComments(ctx, ids)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	if err := s.attachReactions(ctx, cmts); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	byID := map[string]datastructs.Comment{}
+	for _, cmt := range cmts {
+		byID[cmt.ID] = cmt
+	}
+	return byID, nil
+}
+
+// ListReplies - the approved replies to each of the comments keyed
+// by the comment's id, oldest first with their reactions
+func (s *Service) ListReplies(ctx context.Context, parentIDs []string) (map[string][]datastructs.Comment, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListReplies", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	cmts, err := s.Store.ListReplies(ctx, parentIDs, maxRepliesPerComment)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	if err := s.attachReactions(ctx, cmts); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	byParent := map[string][]datastructs.Comment{}
+	for _, cmt := range cmts {
+		byParent[cmt.ParentID] = append(byParent[cmt.ParentID], cmt)
+	}
+	return byParent, nil
+}
+
+// ListCommentPages - the pages of comments the queries ask for keyed
+// by query, each listed as ListComments would. The pinned comments
+// of every slug are read at once and the rest once per sort asked for
+func (s *Service) ListCommentPages(ctx context.Context, qs []datastructs.ListQuery) (map[datastructs.ListQuery][]datastructs.Comment, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListCommentPages", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	normalized := make([]datastructs.ListQuery, len(qs))
+	slugs := []string{}
+	for i, q := range qs {
+		n, err := normalizeListQuery(q)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		normalized[i] = n
+		slugs = append(slugs, n.Slug)
+	}
+
+	pinned, err := s.Store.ListPinnedCommentsOn(ctx, slugs)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	pinnedBySlug := map[string][]datastructs.Comment{}
+	for _, cmt := range pinned {
+		pinnedBySlug[cmt.Slug] = append(pinnedBySlug[cmt.Slug], cmt)
+	}
+
+	// The unpinned rest of each page is read along with those of
+	// the other pages of the same sort and filter
+	type listing struct {
+		sort     string
+		featured bool
+	}
+	pages := make([][]datastructs.Comment, len(qs))
+	rests := map[listing][]datastructs.ListQuery{}
+	restOf := map[listing][]int{}
+	for i, q := range normalized {
+		cmts, rest := pinnedPage(q, pinnedBySlug[q.Slug])
+		pages[i] = cmts
+		if rest.Limit > 0 {
+			l := listing{sort: rest.Sort, featured: rest.Featured}
+			rests[l] = append(rests[l], rest)
+			restOf[l] = append(restOf[l], i)
+		}
+	}
+	for l, rest := range rests {
+		unpinned, err := s.Store.ListCommentPages(ctx, l.sort, l.featured, rest)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		for j, i := range restOf[l] {
+			pages[i] = append(pages[i], unpinned[j]...)
+		}
+	}
+
+	// Reactions are read for every page at once
+	var cmts []datastructs.Comment
+	for _, page := range pages {
+		cmts = append(cmts, page...)
+	}
+	if err := s.attachReactions(ctx, cmts); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	byQuery := map[datastructs.ListQuery][]datastructs.Comment{}
+	for i, q := range qs {
+		byQuery[q], cmts = cmts[:len(pages[i]):len(pages[i])], cmts[len(pages[i]):]
+	}
+	return byQuery, nil
+}
+
+// GetAuthorProfiles - the authors' profiles keyed by name, an
+// author without approved comments gets an empty profile
+func (s *Service) GetAuthorProfiles(ctx context.Context, authors []string) (map[string]datastructs.AuthorProfile, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "GetAuthorProfiles", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	profiles, err := s.Store.GetAuthorProfiles(ctx, authors)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	byName := map[string]datastructs.AuthorProfile{}
+	for _, author := range authors {
+		byName[author] = datastructs.AuthorProfile{Name: author}
+	}
+	for _, profile := range profiles {
+		byName[profile.Name] = profile
+	}
+	return byName, nil
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
 	"github.com/imraan1901/comment-section-rest-api/internal/processor"
+	uuid "github.com/satori/go.uuid"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/codes"
 	tr "go.opentelemetry.io/otel/trace"
@@ -16,6 +17,8 @@ import (
 var (
 	ErrFetchingComment = errors.New("failed to fetch comment by id")
 	ErrNotImplemented  = errors.New("not implemented")
+	ErrCommentRejected = errors.New("comment rejected by moderation")
+	ErrInvalidParent   = errors.New("a reply must be to a comment on the same slug")
 )
 
 // Store - this interface defines all of the methods
@@ -26,26 +29,55 @@ type Store interface {
 	PostComment(context.Context, datastructs.Comment) (datastructs.Comment, error)
 	UpdateComment(context.Context, string, datastructs.Comment) (datastructs.Comment, error)
 	DeleteComment(context.Context, string) error
+	UpdateModerationStatus(context.Context, string, string) error
+	ListRecentComments(context.Context, int) ([]datastructs.Comment, error)
+	RuleStore
+	SpamStore
+	PIIStore
+	SearchStore
+	ReactionStore
+	ListStore
+	CountStore
+	ThreadStore
+	PinStore
+	NotificationStore
+	SubscriptionStore
+	WebhookStore
+	BatchStore
+	processor.DuplicateStore
 }
 
 // Service - is the struct in which
 // all of our logic wil be built on
 // All services of this type are also
 type Service struct {
-	Store Store
+	Store  Store
+	Stages []processor.Stage
+	// Classifier - the spam classifier used by the spam stage,
+	// nil when spam classification is turned off
+	Classifier *processor.SpamClassifier
+	// Search - answers searches instead of the store when set
+	Search SearchStore
+	// Publisher - where comment events are emitted once the
+	// outbox relays them, nil emits nothing
+	Publisher EventPublisher
 }
 
 // NewService - returns a pointer to a new
-// service
-func NewService(store Store) *Service {
+// service, comments are run through the
+// given processing stages in order
+func NewService(store Store, stages ...processor.Stage) *Service {
 	return &Service{
-		Store: store,
+		Store:  store,
+		Stages: stages,
 	}
 }
 
 // name is the Tracer name used to identify this instrumentation library.
 const name = "comment"
 
+// GetComment - the comment with its reactions, comments moderation
+// took out of view are only found by moderators and their author
 func (s *Service) GetComment(ctx context.Context, id string) (datastructs.Comment, error) {
 
 	startTime := time.Now()
@@ -60,8 +92,20 @@ func (s *Service) GetComment(ctx context.Context, id string) (datastructs.Commen
 		fmt.Println(err)
 		return datastructs.Comment{}, ErrFetchingComment
 	}
+	// Anyone else is told there is no such comment
+	if !viewerCanSee(ctx, cmt) {
+		span.SetStatus(codes.Error, ErrFetchingComment.Error())
+		return datastructs.Comment{}, ErrFetchingComment
+	}
 
-	return cmt, nil
+	cmts := []datastructs.Comment{cmt}
+	if err := s.attachReactions(ctx, cmts); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Comment{}, err
+	}
+
+	return cmts[0], nil
 }
 
 func (s *Service) UpdateComment(
@@ -74,14 +118,61 @@ func (s *Service) UpdateComment(
 	_, span := otel.Tracer(name).Start(ctx, "UpdateComment", tr.WithTimestamp(startTime))
 	defer span.End(tr.WithTimestamp(time.Now()))
 
-	cmt, err := s.Store.UpdateComment(ctx, id, updatedCmt)
+	existing, err := s.Store.GetComment(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Comment{}, ErrFetchingComment
+	}
+
+	// The comment's own thread has to allow edits, and a comment
+	// moved to another slug has to be one that thread would take
+	thread, err := s.Store.GetThread(ctx, existing.Slug)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Comment{}, err
+	}
+	if err := checkCanEdit(thread, updatedCmt.Body); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Comment{}, err
+	}
+	if updatedCmt.Slug != existing.Slug {
+		thread, err = s.Store.GetThread(ctx, updatedCmt.Slug)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return datastructs.Comment{}, err
+		}
+		if err := checkCanPost(thread, updatedCmt.Body); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return datastructs.Comment{}, err
+		}
+	}
+
+	// The new body has to go through the same processing as a new
+	// comment, the author stays the user who posted it
+	cmt := existing
+	cmt.Slug = updatedCmt.Slug
+	cmt.Body = updatedCmt.Body
+	processedCmt, err := s.processForThread(ctx, cmt, thread)
+	if err != nil {
+		return datastructs.Comment{}, err
+	}
+
+	storedCmt, err := s.Store.UpdateComment(ctx, id, processedCmt)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		fmt.Println("error updating comment")
 		return datastructs.Comment{}, err
 	}
-	return cmt, nil
+	if storedCmt.ModerationStatus == datastructs.ModerationRejected {
+		return datastructs.Comment{}, ErrCommentRejected
+	}
+	return storedCmt, nil
 }
 
 func (s *Service) DeleteComment(ctx context.Context, id string) error {
@@ -89,7 +180,12 @@ func (s *Service) DeleteComment(ctx context.Context, id string) error {
 	_, span := otel.Tracer(name).Start(ctx, "DeleteComment", tr.WithTimestamp(startTime))
 	defer span.End(tr.WithTimestamp(time.Now()))
 
-	return s.Store.DeleteComment(ctx, id)
+	if err := s.Store.DeleteComment(ctx, id); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
 }
 
 func (s *Service) PostComment(ctx context.Context, cmt datastructs.Comment) (datastructs.Comment, error) {
@@ -98,25 +194,79 @@ func (s *Service) PostComment(ctx context.Context, cmt datastructs.Comment) (dat
 	_, span := otel.Tracer(name).Start(ctx, "PostComment", tr.WithTimestamp(startTime))
 	defer span.End(tr.WithTimestamp(time.Now()))
 
-	insertedCmt, err := s.Store.PostComment(ctx, cmt)
+	if cmt.Site == "" {
+		cmt.Site = datastructs.DefaultSite
+	}
+	// Comments are posted as the authenticated user, the author is who
+	// replies and mentions are sent to so it can not be made up
+	if viewer := ViewerFromContext(ctx); viewer != "" {
+		cmt.Author = viewer
+	}
+
+	thread, err := s.Store.GetThread(ctx, cmt.Slug)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		return datastructs.Comment{}, err
 	}
+	if err := checkCanPost(thread, cmt.Body); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Comment{}, err
+	}
+
+	if cmt.ParentID != "" {
+		parent, err := s.Store.GetComment(ctx, cmt.ParentID)
+		if err != nil || parent.Slug != cmt.Slug {
+			span.SetStatus(codes.Error, ErrInvalidParent.Error())
+			return datastructs.Comment{}, ErrInvalidParent
+		}
+	}
+
+	// The id is given before processing so stages that
+	// compare against stored comments can leave this one out
+	cmt.ID = uuid.NewV4().String()
+	cmt.CreatedAt = time.Now().UTC()
+
+	processedCmt, err := s.processForThread(ctx, cmt, thread)
+	if err != nil {
+		return datastructs.Comment{}, err
+	}
 
-	//go func() {
-	cmt, err = s.ProcessComment(ctx, insertedCmt)
+	// Rejected comments are kept but not handed back
+	postedCmt, err := s.Store.PostComment(ctx, processedCmt)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
-		fmt.Println("error processing comment: %w", err)
 		return datastructs.Comment{}, err
 	}
-	s.UpdateComment(ctx, cmt.ID, cmt)
-	//}()
+	if postedCmt.ModerationStatus == datastructs.ModerationRejected {
+		return datastructs.Comment{}, ErrCommentRejected
+	}
+	return postedCmt, nil
+}
+
+// processForThread - runs a comment through the processor before it
+// is stored, so the comment and its event are written together
+func (s *Service) processForThread(
+	ctx context.Context,
+	cmt datastructs.Comment,
+	thread datastructs.Thread,
+) (datastructs.Comment, error) {
 
-	return insertedCmt, nil
+	span := tr.SpanFromContext(ctx)
+
+	processedCmt, err := s.ProcessComment(ctx, cmt)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		fmt.Printf("error processing comment: %v\n", err)
+		return datastructs.Comment{}, err
+	}
+	if thread.ModerationMode == datastructs.ThreadModerationPre {
+		processor.Escalate(&processedCmt, datastructs.ModerationHeld)
+	}
+	return processedCmt, nil
 }
 
 // In a production environment never let user input be executed with eval
@@ -127,14 +277,14 @@ func (s *Service) ProcessComment(ctx context.Context, comment datastructs.Commen
 	_, span := otel.Tracer(name).Start(ctx, "ProcessComment", tr.WithTimestamp(startTime))
 	defer span.End(tr.WithTimestamp(time.Now()))
 
-	processor, err := processor.NewProcessor()
+	p, err := processor.NewProcessor(s.Stages...)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		return datastructs.Comment{}, err
 	}
 
-	cmt, err := processor.ProcessComment(ctx, comment)
+	cmt, err := p.ProcessComment(ctx, comment)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
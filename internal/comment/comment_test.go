@@ -0,0 +1,312 @@
+package comment
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/imraan1901/comment-section-rest-api/internal/processor"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStore - keeps posted comments in memory and, like
+// Postgres, refuses ids that are not uuids
+type fakeStore struct {
+	Store
+	posted []datastructs.Comment
+}
+
+func (s *fakeStore) GetThread(ctx context.Context, slug string) (datastructs.Thread, error) {
+	return datastructs.Thread{Slug: slug, State: datastructs.ThreadOpen}, nil
+}
+
+func (s *fakeStore) GetPIISettings(ctx context.Context, site string) (datastructs.PIISettings, error) {
+	return datastructs.PIISettings{Site: site}, nil
+}
+
+func (s *fakeStore) CountAuthorDuplicates(ctx context.Context, author, bodyHash string, since time.Time, excludeID string) (int, error) {
+	if _, err := uuid.FromString(excludeID); err != nil {
+		return 0, fmt.Errorf("invalid input syntax for type uuid: %q", excludeID)
+	}
+	count := 0
+	for _, cmt := range s.posted {
+		if cmt.Author == author && cmt.BodyHash == bodyHash && cmt.ID != excludeID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *fakeStore) FindSimHashCandidates(ctx context.Context, simHash uint64, since time.Time, excludeAuthor string) ([]datastructs.Comment, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) PostComment(ctx context.Context, cmt datastructs.Comment) (datastructs.Comment, error) {
+	s.posted = append(s.posted, cmt)
+	return cmt, nil
+}
+
+func TestPostComment(t *testing.T) {
+
+	store := &fakeStore{}
+	service := NewService(
+		store,
+		processor.NewPIIStage(store),
+		processor.NewDuplicateStage(store),
+		processor.NewMentionStage(),
+		processor.NewMarkdownStage(),
+	)
+	post := datastructs.Comment{Slug: "post", Author: "alice", Body: "hello **world**"}
+
+	t.Run("posts through every stage", func(t *testing.T) {
+		cmt, err := service.PostComment(context.Background(), post)
+		require.NoError(t, err)
+
+		_, err = uuid.FromString(cmt.ID)
+		assert.NoError(t, err)
+		assert.False(t, cmt.CreatedAt.IsZero())
+		assert.NotEmpty(t, cmt.BodyHash)
+		assert.Contains(t, cmt.BodyHTML, "<strong>world</strong>")
+	})
+
+	t.Run("posts as the authenticated user", func(t *testing.T) {
+		ctx := WithViewer(context.Background(), "user-1")
+		cmt, err := service.PostComment(ctx, datastructs.Comment{Slug: "post", Author: "someone-else", Body: "hi"})
+		require.NoError(t, err)
+		assert.Equal(t, "user-1", cmt.Author)
+	})
+
+	t.Run("rejects the same comment posted again", func(t *testing.T) {
+		_, err := service.PostComment(context.Background(), post)
+		assert.ErrorIs(t, err, ErrCommentRejected)
+	})
+}
+
+// listStore - a slug's pinned comments and the unpinned
+// ones after them, paged the way the queries do
+type listStore struct {
+	Store
+	pinned   []datastructs.Comment
+	unpinned []datastructs.Comment
+	queries  []datastructs.ListQuery
+	batches  int
+}
+
+func (s *listStore) ListPinnedComments(ctx context.Context, slug string) ([]datastructs.Comment, error) {
+	return s.pinned, nil
+}
+
+func (s *listStore) ListComments(ctx context.Context, q datastructs.ListQuery) ([]datastructs.Comment, error) {
+	s.queries = append(s.queries, q)
+	cmts := []datastructs.Comment{}
+	for i := q.Offset; i < len(s.unpinned) && i < q.Offset+q.Limit; i++ {
+		cmts = append(cmts, s.unpinned[i])
+	}
+	return cmts, nil
+}
+
+// ListPinnedCommentsOn - every slug has the same pinned comments
+func (s *listStore) ListPinnedCommentsOn(ctx context.Context, slugs []string) ([]datastructs.Comment, error) {
+	pinned := []datastructs.Comment{}
+	for _, slug := range slugs {
+		for _, cmt := range s.pinned {
+			cmt.Slug = slug
+			pinned = append(pinned, cmt)
+		}
+	}
+	return pinned, nil
+}
+
+func (s *listStore) ListCommentPages(ctx context.Context, sort string, featured bool, pages []datastructs.ListQuery) ([][]datastructs.Comment, error) {
+	s.batches++
+	listed := [][]datastructs.Comment{}
+	for _, q := range pages {
+		cmts, _ := s.ListComments(ctx, q)
+		listed = append(listed, cmts)
+	}
+	return listed, nil
+}
+
+func (s *listStore) GetReactionCounts(ctx context.Context, ids []string) (map[string]map[string]int, error) {
+	return map[string]map[string]int{}, nil
+}
+
+func TestListComments(t *testing.T) {
+
+	comments := func(prefix string, n int) []datastructs.Comment {
+		cmts := []datastructs.Comment{}
+		for i := 1; i <= n; i++ {
+			cmts = append(cmts, datastructs.Comment{ID: fmt.Sprintf("%s%d", prefix, i), Pinned: prefix == "p"})
+		}
+		return cmts
+	}
+	ids := func(cmts []datastructs.Comment) []string {
+		ids := []string{}
+		for _, cmt := range cmts {
+			ids = append(ids, cmt.ID)
+		}
+		return ids
+	}
+	store := &listStore{pinned: comments("p", 3), unpinned: comments("c", 4)}
+	service := NewService(store)
+	list := func(limit, offset int) []string {
+		cmts, err := service.ListComments(context.Background(), datastructs.ListQuery{Slug: "post", Limit: limit, Offset: offset})
+		require.NoError(t, err)
+		return ids(cmts)
+	}
+
+	t.Run("pinned comments count toward the limit", func(t *testing.T) {
+		assert.Equal(t, []string{"p1", "p2"}, list(2, 0))
+		assert.Equal(t, []string{"p1", "p2", "p3", "c1"}, list(4, 0))
+	})
+
+	t.Run("later pages carry on after them", func(t *testing.T) {
+		assert.Equal(t, []string{"p3", "c1"}, list(2, 2))
+		assert.Equal(t, []string{"c2", "c3"}, list(2, 4))
+		assert.Equal(t, []string{"c4"}, list(2, 6))
+		assert.Equal(t, []string{}, list(2, 8))
+	})
+
+	t.Run("the store is not asked for a page of pins alone", func(t *testing.T) {
+		store.queries = nil
+		list(3, 0)
+		assert.Empty(t, store.queries)
+	})
+
+	t.Run("pages of many slugs are listed as one would be", func(t *testing.T) {
+		qs := []datastructs.ListQuery{
+			{Slug: "one", Limit: 2},
+			{Slug: "two", Limit: 2, Offset: 2},
+			{Slug: "three", Limit: 2, Offset: 4},
+			{Slug: "four", Limit: 2, Offset: 2, Sort: datastructs.SortTop},
+		}
+		store.batches = 0
+		pages, err := service.ListCommentPages(context.Background(), qs)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"p1", "p2"}, ids(pages[qs[0]]))
+		assert.Equal(t, []string{"p3", "c1"}, ids(pages[qs[1]]))
+		assert.Equal(t, []string{"c2", "c3"}, ids(pages[qs[2]]))
+		assert.Equal(t, []string{"p3", "c1"}, ids(pages[qs[3]]))
+		// Once for each sort with unpinned comments to read
+		assert.Equal(t, 2, store.batches)
+
+		_, err = service.ListCommentPages(context.Background(), []datastructs.ListQuery{{Slug: "one", Limit: -1}})
+		assert.ErrorIs(t, err, ErrInvalidListing)
+	})
+}
+
+// getStore - comments by id
+type getStore struct {
+	Store
+	cmts map[string]datastructs.Comment
+}
+
+func (s *getStore) GetComment(ctx context.Context, id string) (datastructs.Comment, error) {
+	cmt, ok := s.cmts[id]
+	if !ok {
+		return datastructs.Comment{}, fmt.Errorf("no comment %s", id)
+	}
+	return cmt, nil
+}
+
+// GetThread - a question answered by the comment with the slug's id
+func (s *getStore) GetThread(ctx context.Context, slug string) (datastructs.Thread, error) {
+	return datastructs.Thread{Slug: slug, Kind: datastructs.ThreadKindQuestion, AcceptedAnswerID: slug}, nil
+}
+
+func (s *getStore) GetReactionCounts(ctx context.Context, ids []string) (map[string]map[string]int, error) {
+	return map[string]map[string]int{}, nil
+}
+
+func (s *getStore) GetUserReactions(ctx context.Context, ids []string, userID string) (map[string][]string, error) {
+	return map[string][]string{}, nil
+}
+
+func TestGetComment(t *testing.T) {
+
+	service := NewService(&getStore{cmts: map[string]datastructs.Comment{
+		"approved": {ID: "approved", Author: "alice", ModerationStatus: datastructs.ModerationApproved},
+		"held":     {ID: "held", Author: "alice", ModerationStatus: datastructs.ModerationHeld},
+	}})
+	anonymous := context.Background()
+	author := WithViewer(anonymous, "alice")
+	someoneElse := WithViewer(anonymous, "bob")
+	moderator := WithViewerRole(someoneElse, "moderator")
+
+	t.Run("approved comments are found by anyone", func(t *testing.T) {
+		_, err := service.GetComment(anonymous, "approved")
+		assert.NoError(t, err)
+	})
+
+	t.Run("comments out of view only by moderators and their author", func(t *testing.T) {
+		_, err := service.GetComment(anonymous, "held")
+		assert.ErrorIs(t, err, ErrFetchingComment)
+		_, err = service.GetComment(someoneElse, "held")
+		assert.ErrorIs(t, err, ErrFetchingComment)
+
+		_, err = service.GetComment(author, "held")
+		assert.NoError(t, err)
+		_, err = service.GetComment(moderator, "held")
+		assert.NoError(t, err)
+	})
+}
+
+func TestGetThread(t *testing.T) {
+
+	service := NewService(&getStore{cmts: map[string]datastructs.Comment{
+		"approved": {ID: "approved", Author: "alice", ModerationStatus: datastructs.ModerationApproved},
+		"held":     {ID: "held", Author: "alice", ModerationStatus: datastructs.ModerationHeld},
+	}})
+
+	t.Run("an approved answer is attached", func(t *testing.T) {
+		thread, err := service.GetThread(context.Background(), "approved")
+		require.NoError(t, err)
+		require.NotNil(t, thread.AcceptedAnswer)
+		assert.Equal(t, "approved", thread.AcceptedAnswer.ID)
+	})
+
+	t.Run("an answer out of view is not, even to its author", func(t *testing.T) {
+		thread, err := service.GetThread(WithViewer(context.Background(), "alice"), "held")
+		require.NoError(t, err)
+		assert.Nil(t, thread.AcceptedAnswer)
+	})
+}
+
+// indexSearch - an embedded index finding a comment of each status
+type indexSearch struct{}
+
+func (indexSearch) SearchComments(ctx context.Context, q datastructs.SearchQuery) (datastructs.SearchResults, error) {
+	return datastructs.SearchResults{Total: 2, Results: []datastructs.SearchResult{
+		{Comment: datastructs.Comment{ID: "approved"}, Rank: 2},
+		{Comment: datastructs.Comment{ID: "held"}, Rank: 1},
+	}}, nil
+}
+
+// GetComments - like the store, only approved comments are read back
+func (s *getStore) GetComments(ctx context.Context, ids []string) ([]datastructs.Comment, error) {
+	cmts := []datastructs.Comment{}
+	for _, id := range ids {
+		if cmt, ok := s.cmts[id]; ok && cmt.ModerationStatus == datastructs.ModerationApproved {
+			cmts = append(cmts, cmt)
+		}
+	}
+	return cmts, nil
+}
+
+func TestSearchCommentsWithIndex(t *testing.T) {
+	service := NewService(&getStore{cmts: map[string]datastructs.Comment{
+		"approved": {ID: "approved", Author: "alice", ModerationStatus: datastructs.ModerationApproved},
+		"held":     {ID: "held", Author: "alice", ModerationStatus: datastructs.ModerationHeld},
+	}})
+	service.Search = indexSearch{}
+
+	res, err := service.SearchComments(context.Background(), datastructs.SearchQuery{Query: "garbage"})
+	require.NoError(t, err)
+	require.Len(t, res.Results, 1)
+	assert.Equal(t, "alice", res.Results[0].Comment.Author)
+	assert.Equal(t, 2.0, res.Results[0].Rank)
+}
@@ -0,0 +1,50 @@
+package comment
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrInvalidCountQuery = errors.New("between 1 and 100 slugs must be given")
+)
+
+const maxCountSlugs = 100
+
+// CountStore - the methods our service needs to count comments
+type CountStore interface {
+	CountComments(ctx context.Context, slugs []string) (map[string]int, error)
+}
+
+// CountComments - how many approved comments each slug has,
+// every slug asked for is in the result even with none
+func (s *Service) CountComments(ctx context.Context, slugs []string) (map[string]int, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "CountComments", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if len(slugs) == 0 || len(slugs) > maxCountSlugs {
+		span.SetStatus(codes.Error, ErrInvalidCountQuery.Error())
+		return nil, ErrInvalidCountQuery
+	}
+
+	counts, err := s.Store.CountComments(ctx, slugs)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	for _, slug := range slugs {
+		if _, ok := counts[slug]; !ok {
+			counts[slug] = 0
+		}
+	}
+	return counts, nil
+}
@@ -0,0 +1,79 @@
+package comment
+
+import (
+	"context"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+)
+
+// EventListener - anything that wants to hear about comments being
+// created, updated, moderated or deleted. Events are relayed from the
+// outbox at least once, a listener returning an error is given the
+// event again later so listeners have to cope with repeats
+type EventListener interface {
+	HandleCommentEvent(context.Context, datastructs.Event) error
+}
+
+// EventPublisher - the broker the service emits comment events to,
+// every server subscribes to it to keep its own state up to date
+type EventPublisher interface {
+	Publish(context.Context, datastructs.Event) error
+}
+
+// HandleCommentEvent - notifies participants once a comment is
+// approved, held comments notify nobody until a moderator approves
+// them, then emits the event. Repeats are harmless, a user is only
+// notified once per comment
+func (s *Service) HandleCommentEvent(ctx context.Context, evt datastructs.Event) error {
+	switch evt.Type {
+	case datastructs.EventCommentCreated, datastructs.EventCommentModerated:
+		if evt.Comment.ModerationStatus == datastructs.ModerationApproved {
+			if err := s.notifyParticipants(ctx, evt.Comment); err != nil {
+				return err
+			}
+		}
+	}
+	return s.emit(ctx, evt)
+}
+
+// emit - hands the event to the publisher, when there is one
+func (s *Service) emit(ctx context.Context, evt datastructs.Event) error {
+	if s.Publisher == nil {
+		return nil
+	}
+	return s.Publisher.Publish(ctx, evt)
+}
+
+// PublicEvent - the event as readers of its thread see it, false when
+// they should not hear of it. Readers only see approved comments, so
+// a comment moderated or edited into view reads as created and one
+// taken out of view reads as deleted. Deleted events only say which
+// comment went, a comment taken out of view must not be shown in them
+func PublicEvent(evt datastructs.Event) (datastructs.Event, bool) {
+	approved := evt.Comment.ModerationStatus == datastructs.ModerationApproved
+	switch evt.Type {
+	case datastructs.EventCommentCreated:
+		return evt, approved
+	case datastructs.EventCommentUpdated:
+		if !approved {
+			return deletedEvent(evt), true
+		}
+		return evt, true
+	case datastructs.EventCommentModerated:
+		if !approved {
+			return deletedEvent(evt), true
+		}
+		evt.Type = datastructs.EventCommentCreated
+		return evt, true
+	case datastructs.EventCommentDeleted:
+		return deletedEvent(evt), approved
+	}
+	return evt, false
+}
+
+// deletedEvent - the event as a deletion, with only the comment's id and slug
+func deletedEvent(evt datastructs.Event) datastructs.Event {
+	evt.Type = datastructs.EventCommentDeleted
+	evt.Comment = datastructs.Comment{ID: evt.Comment.ID, Slug: evt.Comment.Slug}
+	return evt
+}
@@ -0,0 +1,42 @@
+package comment
+
+import (
+	"testing"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublicEvent(t *testing.T) {
+
+	cmt := func(status string) datastructs.Comment {
+		return datastructs.Comment{ID: "c1", Slug: "post", Author: "alice", ProcessedBody: "hello", ModerationStatus: status}
+	}
+
+	t.Run("a comment moderated into view reads as created", func(t *testing.T) {
+		evt, ok := PublicEvent(datastructs.Event{Type: datastructs.EventCommentModerated, Comment: cmt(datastructs.ModerationApproved)})
+		assert.True(t, ok)
+		assert.Equal(t, datastructs.EventCommentCreated, evt.Type)
+		assert.Equal(t, "hello", evt.Comment.ProcessedBody)
+	})
+
+	t.Run("a comment taken out of view reads as deleted without its content", func(t *testing.T) {
+		for _, typ := range []string{datastructs.EventCommentModerated, datastructs.EventCommentUpdated} {
+			evt, ok := PublicEvent(datastructs.Event{Type: typ, Comment: cmt(datastructs.ModerationHeld)})
+			assert.True(t, ok, typ)
+			assert.Equal(t, datastructs.EventCommentDeleted, evt.Type, typ)
+			assert.Equal(t, datastructs.Comment{ID: "c1", Slug: "post"}, evt.Comment, typ)
+		}
+
+		evt, ok := PublicEvent(datastructs.Event{Type: datastructs.EventCommentDeleted, Comment: cmt(datastructs.ModerationApproved)})
+		assert.True(t, ok)
+		assert.Equal(t, datastructs.Comment{ID: "c1", Slug: "post"}, evt.Comment)
+	})
+
+	t.Run("readers never hear of comments they could not see", func(t *testing.T) {
+		_, ok := PublicEvent(datastructs.Event{Type: datastructs.EventCommentCreated, Comment: cmt(datastructs.ModerationHeld)})
+		assert.False(t, ok)
+		_, ok = PublicEvent(datastructs.Event{Type: datastructs.EventCommentDeleted, Comment: cmt(datastructs.ModerationSpam)})
+		assert.False(t, ok)
+	})
+}
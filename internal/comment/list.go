@@ -0,0 +1,117 @@
+package comment
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrInvalidListing = errors.New("invalid comment listing")
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+// ListStore - the methods our service needs to list comments
+type ListStore interface {
+	ListComments(context.Context, datastructs.ListQuery) ([]datastructs.Comment, error)
+}
+
+func validSort(sort string) bool {
+	switch sort {
+	case datastructs.SortNew, datastructs.SortOld, datastructs.SortTop,
+		datastructs.SortControversial, datastructs.SortBest:
+		return true
+	}
+	return false
+}
+
+// ListComments - the approved comments on a slug, newest first
+// unless another sort is asked for. Pinned comments always come
+// first and count toward the limit, later pages carry on after them
+func (s *Service) ListComments(ctx context.Context, q datastructs.ListQuery) ([]datastructs.Comment, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListComments", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	q, err := normalizeListQuery(q)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	pinned, err := s.Store.ListPinnedComments(ctx, q.Slug)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	cmts, rest := pinnedPage(q, pinned)
+	if rest.Limit > 0 {
+		unpinned, err := s.Store.ListComments(ctx, rest)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		cmts = append(cmts, unpinned...)
+	}
+
+	if err := s.attachReactions(ctx, cmts); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	return cmts, nil
+}
+
+// normalizeListQuery - the query with its defaults filled in,
+// or ErrInvalidListing when it can not be listed
+func normalizeListQuery(q datastructs.ListQuery) (datastructs.ListQuery, error) {
+	if q.Sort == "" {
+		q.Sort = datastructs.SortNew
+	}
+	if q.Slug == "" || !validSort(q.Sort) || q.Limit < 0 || q.Limit > maxListLimit || q.Offset < 0 {
+		return q, ErrInvalidListing
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultListLimit
+	}
+	return q, nil
+}
+
+// pinnedPage - the pinned comments on the page q asks for and the
+// query of the unpinned ones filling the rest of it. The pinned
+// comments are the start of the listing, the store's unpinned
+// ones carry on from where they end
+func pinnedPage(q datastructs.ListQuery, pinned []datastructs.Comment) ([]datastructs.Comment, datastructs.ListQuery) {
+	listed := []datastructs.Comment{}
+	for _, cmt := range pinned {
+		if !q.Featured || cmt.Featured {
+			listed = append(listed, cmt)
+		}
+	}
+
+	cmts := []datastructs.Comment{}
+	if q.Offset < len(listed) {
+		end := q.Offset + q.Limit
+		if end > len(listed) {
+			end = len(listed)
+		}
+		cmts = append(cmts, listed[q.Offset:end]...)
+		q.Limit -= len(cmts)
+		q.Offset = 0
+	} else {
+		q.Offset -= len(listed)
+	}
+	return cmts, q
+}
@@ -0,0 +1,66 @@
+package comment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrInvalidModerationStatus = errors.New("invalid moderation status")
+)
+
+// ModerateComment - applies a moderator's decision to a comment,
+// approve and spam decisions are kept to train the spam classifier
+func (s *Service) ModerateComment(ctx context.Context, id string, status string) (datastructs.Comment, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ModerateComment", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	switch status {
+	case datastructs.ModerationApproved, datastructs.ModerationFlagged,
+		datastructs.ModerationHeld, datastructs.ModerationSpam,
+		datastructs.ModerationRejected:
+	default:
+		span.SetStatus(codes.Error, ErrInvalidModerationStatus.Error())
+		return datastructs.Comment{}, ErrInvalidModerationStatus
+	}
+
+	cmt, err := s.Store.GetComment(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		fmt.Println(err)
+		return datastructs.Comment{}, ErrFetchingComment
+	}
+
+	if err := s.Store.UpdateModerationStatus(ctx, id, status); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Comment{}, err
+	}
+	cmt.ModerationStatus = status
+
+	if status == datastructs.ModerationApproved || status == datastructs.ModerationSpam {
+		err := s.Store.SaveTrainingExample(ctx, datastructs.TrainingExample{
+			CommentID: cmt.ID,
+			Body:      cmt.Body,
+			IsSpam:    status == datastructs.ModerationSpam,
+		})
+		if err != nil {
+			// The decision itself has been applied, losing
+			// one training example is not worth failing it
+			span.RecordError(err)
+			fmt.Printf("failed to save training example: %v\n", err)
+		}
+	}
+
+	return cmt, nil
+}
@@ -0,0 +1,190 @@
+package comment
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrInvalidNotificationQuery       = errors.New("invalid notification query")
+	ErrInvalidNotificationPreferences = errors.New("invalid notification preferences")
+)
+
+const (
+	defaultNotificationLimit = 20
+	maxNotificationLimit     = 100
+)
+
+// NotificationStore - the methods our service needs to keep notifications
+type NotificationStore interface {
+	CreateNotifications(ctx context.Context, notifications []datastructs.Notification) error
+	ListNotifications(ctx context.Context, userID string, unreadOnly bool, limit int, offset int) (datastructs.NotificationList, error)
+	MarkNotificationsRead(ctx context.Context, userID string, ids []string) error
+	GetNotificationPreferences(ctx context.Context, userID string) (datastructs.NotificationPreferences, error)
+	UpdateNotificationPreferences(ctx context.Context, prefs datastructs.NotificationPreferences) (datastructs.NotificationPreferences, error)
+}
+
+// ListNotifications - the viewer's notifications, newest first
+func (s *Service) ListNotifications(ctx context.Context, unreadOnly bool, limit int, offset int) (datastructs.NotificationList, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListNotifications", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	userID := ViewerFromContext(ctx)
+	if userID == "" {
+		return datastructs.NotificationList{}, ErrNotAuthenticated
+	}
+	if limit < 0 || limit > maxNotificationLimit || offset < 0 {
+		span.SetStatus(codes.Error, ErrInvalidNotificationQuery.Error())
+		return datastructs.NotificationList{}, ErrInvalidNotificationQuery
+	}
+	if limit == 0 {
+		limit = defaultNotificationLimit
+	}
+	return s.Store.ListNotifications(ctx, userID, unreadOnly, limit, offset)
+}
+
+// MarkNotificationsRead - marks the viewer's notifications as read,
+// every one of them when no ids are given
+func (s *Service) MarkNotificationsRead(ctx context.Context, ids []string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "MarkNotificationsRead", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	userID := ViewerFromContext(ctx)
+	if userID == "" {
+		return ErrNotAuthenticated
+	}
+	return s.Store.MarkNotificationsRead(ctx, userID, ids)
+}
+
+func (s *Service) GetNotificationPreferences(ctx context.Context) (datastructs.NotificationPreferences, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "GetNotificationPreferences", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	userID := ViewerFromContext(ctx)
+	if userID == "" {
+		return datastructs.NotificationPreferences{}, ErrNotAuthenticated
+	}
+	return s.Store.GetNotificationPreferences(ctx, userID)
+}
+
+func (s *Service) UpdateNotificationPreferences(
+	ctx context.Context,
+	prefs datastructs.NotificationPreferences,
+) (datastructs.NotificationPreferences, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "UpdateNotificationPreferences", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	prefs.UserID = ViewerFromContext(ctx)
+	if prefs.UserID == "" {
+		return datastructs.NotificationPreferences{}, ErrNotAuthenticated
+	}
+	switch prefs.DigestFrequency {
+	case "":
+		prefs.DigestFrequency = datastructs.DigestOff
+	case datastructs.DigestOff, datastructs.DigestHourly, datastructs.DigestDaily:
+	default:
+		span.SetStatus(codes.Error, ErrInvalidNotificationPreferences.Error())
+		return datastructs.NotificationPreferences{}, ErrInvalidNotificationPreferences
+	}
+	// There is nowhere to send a digest without an email address
+	if prefs.DigestFrequency != datastructs.DigestOff && prefs.Email == "" {
+		span.SetStatus(codes.Error, ErrInvalidNotificationPreferences.Error())
+		return datastructs.NotificationPreferences{}, ErrInvalidNotificationPreferences
+	}
+	return s.Store.UpdateNotificationPreferences(ctx, prefs)
+}
+
+// notifyParticipants - tells the author of the parent comment about a
+// reply, every mentioned user about the mention and every subscriber
+// about the new comment. Comments are posted as the authenticated user
+// so authors, mentioned usernames and inboxes are all the same user ids,
+// we have no accounts to look them up in. Each user is told once, for the
+// most specific reason. Only failing to store the notifications is
+// returned, the event is then relayed again
+func (s *Service) notifyParticipants(ctx context.Context, cmt datastructs.Comment) error {
+
+	span := tr.SpanFromContext(ctx)
+
+	notified := map[string]bool{cmt.Author: true}
+	var notifications []datastructs.Notification
+	add := func(userID string, kind string) {
+		if notified[userID] {
+			return
+		}
+		notified[userID] = true
+
+		prefs, err := s.Store.GetNotificationPreferences(ctx, userID)
+		if err != nil {
+			span.RecordError(err)
+			return
+		}
+		if (kind == datastructs.NotificationReply && !prefs.Replies) ||
+			(kind == datastructs.NotificationMention && !prefs.Mentions) {
+			return
+		}
+		notifications = append(notifications, datastructs.Notification{
+			UserID:    userID,
+			Kind:      kind,
+			CommentID: cmt.ID,
+			Slug:      cmt.Slug,
+			Actor:     cmt.Author,
+		})
+	}
+
+	// A reply is the more specific reason, it wins over a mention
+	if cmt.ParentID != "" {
+		parent, err := s.Store.GetComment(ctx, cmt.ParentID)
+		if err != nil {
+			span.RecordError(err)
+		} else {
+			add(parent.Author, datastructs.NotificationReply)
+		}
+	}
+	for _, username := range cmt.Mentions {
+		add(username, datastructs.NotificationMention)
+	}
+
+	// Subscribers who turned these notifications off were left out by the store
+	subscribers, err := s.Store.ListSubscribers(ctx, cmt)
+	if err != nil {
+		span.RecordError(err)
+	}
+	for _, sub := range subscribers {
+		if notified[sub.UserID] {
+			continue
+		}
+		notified[sub.UserID] = true
+		notifications = append(notifications, datastructs.Notification{
+			UserID:           sub.UserID,
+			Kind:             datastructs.NotificationNewComment,
+			CommentID:        cmt.ID,
+			Slug:             cmt.Slug,
+			Actor:            cmt.Author,
+			UnsubscribeToken: sub.UnsubscribeToken,
+		})
+	}
+
+	if len(notifications) == 0 {
+		return nil
+	}
+	if err := s.Store.CreateNotifications(ctx, notifications); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package comment
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/imraan1901/comment-section-rest-api/internal/processor"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrInvalidPIIMode = errors.New("pii mode must be redact, reject or flag")
+)
+
+// PIIStore - the methods our service needs to
+// manage per-site PII settings
+type PIIStore interface {
+	UpdatePIISettings(context.Context, datastructs.PIISettings) (datastructs.PIISettings, error)
+	processor.PIIStore
+}
+
+func (s *Service) GetPIISettings(ctx context.Context, site string) (datastructs.PIISettings, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "GetPIISettings", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	return s.Store.GetPIISettings(ctx, site)
+}
+
+func (s *Service) UpdatePIISettings(ctx context.Context, settings datastructs.PIISettings) (datastructs.PIISettings, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "UpdatePIISettings", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if !processor.ValidPIIMode(settings.Mode) {
+		span.SetStatus(codes.Error, ErrInvalidPIIMode.Error())
+		return datastructs.PIISettings{}, ErrInvalidPIIMode
+	}
+	return s.Store.UpdatePIISettings(ctx, settings)
+}
@@ -0,0 +1,97 @@
+package comment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrInvalidPinPosition = errors.New("pin position can not be negative")
+)
+
+// PinStore - the methods our service needs to pin and feature comments
+type PinStore interface {
+	ListPinnedComments(ctx context.Context, slug string) ([]datastructs.Comment, error)
+	PinComment(ctx context.Context, id string, position int) error
+	UnpinComment(ctx context.Context, id string) error
+	SetFeatured(ctx context.Context, id string, featured bool) error
+}
+
+// PinComment - pins a comment to the top of its thread, a position
+// of zero puts it below the comments already pinned there
+func (s *Service) PinComment(ctx context.Context, id string, position int) (datastructs.Comment, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "PinComment", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if position < 0 {
+		span.SetStatus(codes.Error, ErrInvalidPinPosition.Error())
+		return datastructs.Comment{}, ErrInvalidPinPosition
+	}
+	return s.changePin(ctx, id, func() error {
+		return s.Store.PinComment(ctx, id, position)
+	})
+}
+
+func (s *Service) UnpinComment(ctx context.Context, id string) (datastructs.Comment, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "UnpinComment", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	return s.changePin(ctx, id, func() error {
+		return s.Store.UnpinComment(ctx, id)
+	})
+}
+
+// FeatureComment - marks or unmarks a comment as an editor's pick
+func (s *Service) FeatureComment(ctx context.Context, id string, featured bool) (datastructs.Comment, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "FeatureComment", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	return s.changePin(ctx, id, func() error {
+		return s.Store.SetFeatured(ctx, id, featured)
+	})
+}
+
+func (s *Service) changePin(ctx context.Context, id string, change func() error) (datastructs.Comment, error) {
+
+	span := tr.SpanFromContext(ctx)
+
+	if _, err := s.Store.GetComment(ctx, id); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		fmt.Println(err)
+		return datastructs.Comment{}, ErrFetchingComment
+	}
+
+	if err := change(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Comment{}, err
+	}
+
+	cmt, err := s.Store.GetComment(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Comment{}, err
+	}
+	cmts := []datastructs.Comment{cmt}
+	if err := s.attachReactions(ctx, cmts); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Comment{}, err
+	}
+	return cmts[0], nil
+}
@@ -0,0 +1,135 @@
+package comment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrInvalidReaction  = errors.New("unknown reaction")
+	ErrNotAuthenticated = errors.New("this needs an authenticated user")
+)
+
+// ReactionStore - the methods our service needs to keep reactions
+type ReactionStore interface {
+	AddReaction(ctx context.Context, commentID string, userID string, reaction string) error
+	RemoveReaction(ctx context.Context, commentID string, userID string, reaction string) error
+	GetReactionCounts(ctx context.Context, commentIDs []string) (map[string]map[string]int, error)
+	GetUserReactions(ctx context.Context, commentIDs []string, userID string) (map[string][]string, error)
+}
+
+func validReaction(reaction string) bool {
+	for _, r := range datastructs.Reactions {
+		if r == reaction {
+			return true
+		}
+	}
+	return false
+}
+
+// AddReaction - adds the viewer's reaction to a comment, adding
+// the same reaction twice is not an error
+func (s *Service) AddReaction(ctx context.Context, commentID string, reaction string) (datastructs.Comment, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "AddReaction", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	return s.changeReaction(ctx, commentID, reaction, s.Store.AddReaction)
+}
+
+// RemoveReaction - takes the viewer's reaction off a comment,
+// removing a reaction that is not there is not an error
+func (s *Service) RemoveReaction(ctx context.Context, commentID string, reaction string) (datastructs.Comment, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "RemoveReaction", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	return s.changeReaction(ctx, commentID, reaction, s.Store.RemoveReaction)
+}
+
+func (s *Service) changeReaction(
+	ctx context.Context,
+	commentID string,
+	reaction string,
+	change func(context.Context, string, string, string) error,
+) (datastructs.Comment, error) {
+
+	span := tr.SpanFromContext(ctx)
+
+	userID := ViewerFromContext(ctx)
+	if userID == "" {
+		return datastructs.Comment{}, ErrNotAuthenticated
+	}
+	if !validReaction(reaction) {
+		return datastructs.Comment{}, ErrInvalidReaction
+	}
+
+	cmt, err := s.Store.GetComment(ctx, commentID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		fmt.Println(err)
+		return datastructs.Comment{}, ErrFetchingComment
+	}
+
+	if err := change(ctx, commentID, userID, reaction); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Comment{}, err
+	}
+
+	cmts := []datastructs.Comment{cmt}
+	if err := s.attachReactions(ctx, cmts); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Comment{}, err
+	}
+	return cmts[0], nil
+}
+
+// attachReactions - fills in the reaction counts of each comment,
+// and the viewer's own reactions when there is a viewer
+func (s *Service) attachReactions(ctx context.Context, cmts []datastructs.Comment) error {
+	if len(cmts) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(cmts))
+	for i, c := range cmts {
+		ids[i] = c.ID
+	}
+
+	counts, err := s.Store.GetReactionCounts(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	mine := map[string][]string{}
+	if userID := ViewerFromContext(ctx); userID != "" {
+		mine, err = s.Store.GetUserReactions(ctx, ids, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range cmts {
+		cmts[i].Reactions = counts[cmts[i].ID]
+		if cmts[i].Reactions == nil {
+			cmts[i].Reactions = map[string]int{}
+		}
+		cmts[i].MyReactions = mine[cmts[i].ID]
+		if cmts[i].MyReactions == nil {
+			cmts[i].MyReactions = []string{}
+		}
+	}
+	return nil
+}
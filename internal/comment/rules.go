@@ -0,0 +1,136 @@
+package comment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/imraan1901/comment-section-rest-api/internal/processor"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrFetchingRule = errors.New("failed to fetch rule by id")
+)
+
+// defaultDryRunLimit - how many recent comments a dry run looks at
+// when the caller does not ask for a specific number
+const defaultDryRunLimit = 100
+
+// RuleStore - the methods our service needs to
+// manage auto-moderation rules
+type RuleStore interface {
+	GetRule(context.Context, string) (datastructs.Rule, error)
+	ListRules(context.Context) ([]datastructs.Rule, error)
+	PostRule(context.Context, datastructs.Rule) (datastructs.Rule, error)
+	UpdateRule(context.Context, string, datastructs.Rule) (datastructs.Rule, error)
+	DeleteRule(context.Context, string) error
+	processor.RuleStore
+}
+
+func (s *Service) GetRule(ctx context.Context, id string) (datastructs.Rule, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "GetRule", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	rule, err := s.Store.GetRule(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		fmt.Println(err)
+		return datastructs.Rule{}, ErrFetchingRule
+	}
+	return rule, nil
+}
+
+func (s *Service) ListRules(ctx context.Context) ([]datastructs.Rule, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListRules", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	return s.Store.ListRules(ctx)
+}
+
+func (s *Service) PostRule(ctx context.Context, rule datastructs.Rule) (datastructs.Rule, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "PostRule", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if err := processor.ValidateRule(rule); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Rule{}, err
+	}
+	return s.Store.PostRule(ctx, rule)
+}
+
+func (s *Service) UpdateRule(ctx context.Context, id string, rule datastructs.Rule) (datastructs.Rule, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "UpdateRule", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if err := processor.ValidateRule(rule); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Rule{}, err
+	}
+	return s.Store.UpdateRule(ctx, id, rule)
+}
+
+func (s *Service) DeleteRule(ctx context.Context, id string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "DeleteRule", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	return s.Store.DeleteRule(ctx, id)
+}
+
+// DryRunRule - evaluates a rule against the most recent comments
+// and returns the ones it would have matched, hit counters are not touched
+func (s *Service) DryRunRule(ctx context.Context, rule datastructs.Rule, limit int) ([]datastructs.Comment, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "DryRunRule", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if err := processor.ValidateRule(rule); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	// Already validated, so it compiles
+	compiled, _ := processor.CompileRule(rule)
+	if limit <= 0 {
+		limit = defaultDryRunLimit
+	}
+
+	cmts, err := s.Store.ListRecentComments(ctx, limit)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	matched := []datastructs.Comment{}
+	for _, cmt := range cmts {
+		authorAge, err := processor.AuthorAge(ctx, s.Store, cmt)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		if compiled.Matches(cmt, authorAge) {
+			matched = append(matched, cmt)
+		}
+	}
+	return matched, nil
+}
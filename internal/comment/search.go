@@ -0,0 +1,86 @@
+package comment
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrInvalidSearch = errors.New("invalid search query")
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// SearchStore - the methods our service needs to search comments
+type SearchStore interface {
+	SearchComments(context.Context, datastructs.SearchQuery) (datastructs.SearchResults, error)
+}
+
+// SearchComments - full text search over comment bodies
+func (s *Service) SearchComments(ctx context.Context, q datastructs.SearchQuery) (datastructs.SearchResults, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "SearchComments", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	q.Query = strings.TrimSpace(q.Query)
+	if q.Query == "" || q.Limit < 0 || q.Limit > maxSearchLimit || q.Offset < 0 {
+		span.SetStatus(codes.Error, ErrInvalidSearch.Error())
+		return datastructs.SearchResults{}, ErrInvalidSearch
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultSearchLimit
+	}
+
+	var searcher SearchStore = s.Store
+	if s.Search != nil {
+		searcher = s.Search
+	}
+
+	results, err := searcher.SearchComments(ctx, q)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.SearchResults{}, err
+	}
+	if s.Search == nil {
+		return results, nil
+	}
+
+	// The embedded index keeps no more of a comment than it searches,
+	// the comments found are read back from the store, leaving out
+	// any that are not approved
+	ids := make([]string, len(results.Results))
+	for i, r := range results.Results {
+		ids[i] = r.Comment.ID
+	}
+	cmts, err := s.Store.GetComments(ctx, ids)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.SearchResults{}, err
+	}
+	byID := map[string]datastructs.Comment{}
+	for _, cmt := range cmts {
+		byID[cmt.ID] = cmt
+	}
+	found := []datastructs.SearchResult{}
+	for _, r := range results.Results {
+		if cmt, ok := byID[r.Comment.ID]; ok {
+			r.Comment = cmt
+			found = append(found, r)
+		}
+	}
+	results.Results = found
+	return results, nil
+}
@@ -0,0 +1,111 @@
+package comment
+
+import (
+	"context"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/imraan1901/comment-section-rest-api/internal/processor"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+// SpamStore - the methods our service needs to
+// train and keep the spam classifier
+type SpamStore interface {
+	SaveTrainingExample(context.Context, datastructs.TrainingExample) error
+	ListTrainingExamples(context.Context) ([]datastructs.TrainingExample, error)
+	SaveSpamModel(context.Context, processor.SpamModel) error
+	GetLatestSpamModel(context.Context) (processor.SpamModel, bool, error)
+}
+
+// LoadSpamModel - loads the last saved model into the classifier,
+// called once on start up
+func (s *Service) LoadSpamModel(ctx context.Context) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "LoadSpamModel", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if s.Classifier == nil {
+		return ErrNotImplemented
+	}
+
+	model, ok, err := s.Store.GetLatestSpamModel(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	return s.Classifier.Import(model)
+}
+
+// RetrainSpamModel - rebuilds the classifier from every moderator
+// decision so far and saves the result
+func (s *Service) RetrainSpamModel(ctx context.Context) (processor.SpamModel, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "RetrainSpamModel", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if s.Classifier == nil {
+		return processor.SpamModel{}, ErrNotImplemented
+	}
+
+	examples, err := s.Store.ListTrainingExamples(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return processor.SpamModel{}, err
+	}
+
+	s.Classifier.Train(examples)
+	model := s.Classifier.Export()
+	if err := s.Store.SaveSpamModel(ctx, model); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return processor.SpamModel{}, err
+	}
+	return model, nil
+}
+
+func (s *Service) ExportSpamModel(ctx context.Context) (processor.SpamModel, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ExportSpamModel", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if s.Classifier == nil {
+		return processor.SpamModel{}, ErrNotImplemented
+	}
+	return s.Classifier.Export(), nil
+}
+
+// ImportSpamModel - replaces the classifier with a model
+// trained somewhere else and saves it
+func (s *Service) ImportSpamModel(ctx context.Context, model processor.SpamModel) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ImportSpamModel", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if s.Classifier == nil {
+		return ErrNotImplemented
+	}
+
+	if err := s.Classifier.Import(model); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	if err := s.Store.SaveSpamModel(ctx, s.Classifier.Export()); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package comment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrInvalidSubscription  = errors.New("a subscription needs a slug or a comment")
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+)
+
+// SubscriptionStore - the methods our service needs to keep subscriptions
+type SubscriptionStore interface {
+	Subscribe(ctx context.Context, sub datastructs.Subscription) (datastructs.Subscription, error)
+	ListSubscriptions(ctx context.Context, userID string) ([]datastructs.Subscription, error)
+	DeleteSubscription(ctx context.Context, userID string, id string) error
+	DeleteSubscriptionByToken(ctx context.Context, token string) error
+	StopDigests(ctx context.Context, digestID string) error
+	ListSubscribers(ctx context.Context, cmt datastructs.Comment) ([]datastructs.Subscription, error)
+}
+
+// newToken - long enough that it can not be guessed
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Subscribe - follows every comment on a slug, or only the
+// replies under a comment when a comment id is given
+func (s *Service) Subscribe(ctx context.Context, slug string, commentID string) (datastructs.Subscription, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "Subscribe", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	userID := ViewerFromContext(ctx)
+	if userID == "" {
+		return datastructs.Subscription{}, ErrNotAuthenticated
+	}
+
+	if commentID != "" {
+		cmt, err := s.Store.GetComment(ctx, commentID)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			fmt.Println(err)
+			return datastructs.Subscription{}, ErrFetchingComment
+		}
+		slug = cmt.Slug
+	}
+	if slug == "" {
+		span.SetStatus(codes.Error, ErrInvalidSubscription.Error())
+		return datastructs.Subscription{}, ErrInvalidSubscription
+	}
+
+	token, err := newToken()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Subscription{}, err
+	}
+
+	return s.Store.Subscribe(ctx, datastructs.Subscription{
+		UserID:           userID,
+		Slug:             slug,
+		CommentID:        commentID,
+		UnsubscribeToken: token,
+	})
+}
+
+func (s *Service) ListSubscriptions(ctx context.Context) ([]datastructs.Subscription, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListSubscriptions", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	userID := ViewerFromContext(ctx)
+	if userID == "" {
+		return nil, ErrNotAuthenticated
+	}
+	return s.Store.ListSubscriptions(ctx, userID)
+}
+
+// Unsubscribe - deletes one of the viewer's subscriptions
+func (s *Service) Unsubscribe(ctx context.Context, id string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "Unsubscribe", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	userID := ViewerFromContext(ctx)
+	if userID == "" {
+		return ErrNotAuthenticated
+	}
+	if err := s.Store.DeleteSubscription(ctx, userID, id); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		fmt.Println(err)
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+// UnsubscribeByToken - the one click unsubscribe link, the
+// token is all it takes so no sign in is needed
+func (s *Service) UnsubscribeByToken(ctx context.Context, token string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "UnsubscribeByToken", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if err := s.Store.DeleteSubscriptionByToken(ctx, token); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		fmt.Println(err)
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+// UnsubscribeFromDigests - turns off the digests of whoever the digest
+// was emailed to, the one click unsubscribe sent with every digest
+func (s *Service) UnsubscribeFromDigests(ctx context.Context, digestID string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "UnsubscribeFromDigests", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if err := s.Store.StopDigests(ctx, digestID); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		fmt.Println(err)
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package comment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrInvalidThread  = errors.New("invalid thread settings")
+	ErrThreadClosed   = errors.New("this thread is not accepting new comments")
+	ErrThreadLocked   = errors.New("comments in this thread can no longer be edited")
+	ErrCommentTooLong = errors.New("comment is longer than this thread allows")
+	ErrNotQuestion    = errors.New("only question threads have answers")
+	ErrInvalidAnswer  = errors.New("the answer must be an approved comment on the thread")
+)
+
+// ThreadStore - the methods our service needs to keep thread settings
+type ThreadStore interface {
+	GetThread(ctx context.Context, slug string) (datastructs.Thread, error)
+	ListThreads(ctx context.Context, q datastructs.ThreadQuery) ([]datastructs.Thread, error)
+	UpdateThread(ctx context.Context, thread datastructs.Thread) (datastructs.Thread, error)
+	DeleteThread(ctx context.Context, slug string) error
+	SetAcceptedAnswer(ctx context.Context, slug string, commentID string) error
+}
+
+func validThreadState(state string) bool {
+	switch state {
+	case datastructs.ThreadOpen, datastructs.ThreadClosed,
+		datastructs.ThreadLocked, datastructs.ThreadArchived:
+		return true
+	}
+	return false
+}
+
+func validThreadModerationMode(mode string) bool {
+	return mode == datastructs.ThreadModerationPost || mode == datastructs.ThreadModerationPre
+}
+
+func validThreadKind(kind string) bool {
+	return kind == datastructs.ThreadKindDiscussion || kind == datastructs.ThreadKindQuestion
+}
+
+// checkCanPost - whether the thread takes a new comment with this body
+func checkCanPost(thread datastructs.Thread, body string) error {
+	if thread.State != datastructs.ThreadOpen {
+		return ErrThreadClosed
+	}
+	return checkLength(thread, body)
+}
+
+// checkCanEdit - whether a comment in the thread can be changed to this body
+func checkCanEdit(thread datastructs.Thread, body string) error {
+	if thread.State == datastructs.ThreadLocked || thread.State == datastructs.ThreadArchived {
+		return ErrThreadLocked
+	}
+	return checkLength(thread, body)
+}
+
+func checkLength(thread datastructs.Thread, body string) error {
+	if thread.MaxLength > 0 && utf8.RuneCountInString(body) > thread.MaxLength {
+		return fmt.Errorf("%w: at most %d characters", ErrCommentTooLong, thread.MaxLength)
+	}
+	return nil
+}
+
+// GetThread - the thread's settings, with the accepted answer of a
+// question while it is approved. An answer moderation has since
+// taken out of view is left off as it would be from any listing
+func (s *Service) GetThread(ctx context.Context, slug string) (datastructs.Thread, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "GetThread", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	thread, err := s.Store.GetThread(ctx, slug)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Thread{}, err
+	}
+
+	if thread.AcceptedAnswerID != "" {
+		answer, err := s.Store.GetComment(ctx, thread.AcceptedAnswerID)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return datastructs.Thread{}, err
+		}
+		if answer.ModerationStatus != datastructs.ModerationApproved {
+			return thread, nil
+		}
+		answers := []datastructs.Comment{answer}
+		if err := s.attachReactions(ctx, answers); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return datastructs.Thread{}, err
+		}
+		thread.AcceptedAnswer = &answers[0]
+	}
+	return thread, nil
+}
+
+// ListThreads - asking for answered or unanswered
+// threads only ever lists question threads, a limit
+// may be no more than that of a list of comments
+func (s *Service) ListThreads(ctx context.Context, q datastructs.ThreadQuery) ([]datastructs.Thread, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListThreads", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if q.Answered != nil && q.Kind == "" {
+		q.Kind = datastructs.ThreadKindQuestion
+	}
+	if (q.State != "" && !validThreadState(q.State)) || (q.Kind != "" && !validThreadKind(q.Kind)) ||
+		q.Limit < 0 || q.Limit > maxListLimit {
+		span.SetStatus(codes.Error, ErrInvalidThread.Error())
+		return nil, ErrInvalidThread
+	}
+	return s.Store.ListThreads(ctx, q)
+}
+
+func (s *Service) UpdateThread(ctx context.Context, thread datastructs.Thread) (datastructs.Thread, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "UpdateThread", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if thread.ModerationMode == "" {
+		thread.ModerationMode = datastructs.ThreadModerationPost
+	}
+	if thread.Kind == "" {
+		thread.Kind = datastructs.ThreadKindDiscussion
+	}
+	if thread.Slug == "" || !validThreadState(thread.State) || !validThreadKind(thread.Kind) ||
+		!validThreadModerationMode(thread.ModerationMode) || thread.MaxLength < 0 {
+		span.SetStatus(codes.Error, ErrInvalidThread.Error())
+		return datastructs.Thread{}, ErrInvalidThread
+	}
+	return s.Store.UpdateThread(ctx, thread)
+}
+
+// DeleteThread - forgets the slug's settings so it is open again
+func (s *Service) DeleteThread(ctx context.Context, slug string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "DeleteThread", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	return s.Store.DeleteThread(ctx, slug)
+}
+
+// AcceptAnswer - marks a comment as the answer to a question thread,
+// only the thread's owner or a moderator may do this
+func (s *Service) AcceptAnswer(ctx context.Context, slug string, commentID string) (datastructs.Thread, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "AcceptAnswer", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if err := s.checkCanAnswer(ctx, slug); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Thread{}, err
+	}
+
+	answer, err := s.Store.GetComment(ctx, commentID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Thread{}, ErrInvalidAnswer
+	}
+	if answer.Slug != slug || answer.ModerationStatus != datastructs.ModerationApproved {
+		span.SetStatus(codes.Error, ErrInvalidAnswer.Error())
+		return datastructs.Thread{}, ErrInvalidAnswer
+	}
+
+	if err := s.Store.SetAcceptedAnswer(ctx, slug, commentID); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Thread{}, err
+	}
+	return s.GetThread(ctx, slug)
+}
+
+// UnacceptAnswer - leaves a question thread without an accepted answer
+func (s *Service) UnacceptAnswer(ctx context.Context, slug string) (datastructs.Thread, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "UnacceptAnswer", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if err := s.checkCanAnswer(ctx, slug); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Thread{}, err
+	}
+
+	if err := s.Store.SetAcceptedAnswer(ctx, slug, ""); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Thread{}, err
+	}
+	return s.GetThread(ctx, slug)
+}
+
+// checkCanAnswer - whether the viewer may change the answer of the thread
+func (s *Service) checkCanAnswer(ctx context.Context, slug string) error {
+	viewer := ViewerFromContext(ctx)
+	if viewer == "" {
+		return ErrNotAuthenticated
+	}
+
+	thread, err := s.Store.GetThread(ctx, slug)
+	if err != nil {
+		return err
+	}
+	if thread.Kind != datastructs.ThreadKindQuestion {
+		return ErrNotQuestion
+	}
+	if viewer != thread.Owner && !viewerIsModerator(ctx) {
+		return ErrForbidden
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package comment
+
+import (
+	"context"
+	"errors"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+)
+
+var (
+	ErrForbidden = errors.New("the viewer is not allowed to do this")
+)
+
+type viewerKey struct{}
+
+type viewerRoleKey struct{}
+
+// Roles allowed to act on any comment, not only their own
+var moderatorRoles = []string{"moderator", "admin"}
+
+// WithViewer - records who is making the request, the transport
+// layer sets this once the caller has been authenticated
+func WithViewer(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, viewerKey{}, userID)
+}
+
+// ViewerFromContext - the authenticated user, empty when anonymous
+func ViewerFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(viewerKey{}).(string)
+	return userID
+}
+
+// WithViewerRole - records the role of the user making the request
+func WithViewerRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, viewerRoleKey{}, role)
+}
+
+// ViewerRoleFromContext - the authenticated user's role, empty when none
+func ViewerRoleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(viewerRoleKey{}).(string)
+	return role
+}
+
+// viewerIsModerator - whether the viewer's role lets them act on anything
+func viewerIsModerator(ctx context.Context) bool {
+	role := ViewerRoleFromContext(ctx)
+	for _, r := range moderatorRoles {
+		if role == r {
+			return true
+		}
+	}
+	return false
+}
+
+// viewerCanSee - whether the viewer may see the comment, comments
+// moderation took out of view are only shown to moderators and their author
+func viewerCanSee(ctx context.Context, cmt datastructs.Comment) bool {
+	if cmt.ModerationStatus == datastructs.ModerationApproved || viewerIsModerator(ctx) {
+		return true
+	}
+	viewer := ViewerFromContext(ctx)
+	return viewer != "" && viewer == cmt.Author
+}
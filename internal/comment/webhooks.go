@@ -0,0 +1,216 @@
+package comment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrInvalidWebhook             = errors.New("a webhook needs an http or https url and known event types")
+	ErrWebhookNotFound            = errors.New("webhook not found")
+	ErrInvalidWebhookDeliveryList = errors.New("invalid webhook delivery query")
+	ErrDeliveryNotFound           = errors.New("webhook delivery not found")
+	ErrDeliveryNotFailed          = errors.New("only failed deliveries can be replayed")
+)
+
+const (
+	defaultWebhookDeliveryLimit = 50
+	maxWebhookDeliveryLimit     = 200
+)
+
+// webhookEvents - the events a webhook can listen for
+var webhookEvents = map[string]bool{
+	datastructs.EventCommentCreated:   true,
+	datastructs.EventCommentUpdated:   true,
+	datastructs.EventCommentDeleted:   true,
+	datastructs.EventCommentModerated: true,
+}
+
+// WebhookStore - the methods our service needs to manage
+// webhooks and read their delivery logs
+type WebhookStore interface {
+	GetWebhook(ctx context.Context, id string) (datastructs.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]datastructs.Webhook, error)
+	PostWebhook(ctx context.Context, hook datastructs.Webhook) (datastructs.Webhook, error)
+	UpdateWebhook(ctx context.Context, id string, hook datastructs.Webhook) (datastructs.Webhook, error)
+	DeleteWebhook(ctx context.Context, id string) error
+	ListWebhookDeliveries(ctx context.Context, q datastructs.WebhookDeliveryQuery) ([]datastructs.WebhookDelivery, error)
+	GetWebhookDelivery(ctx context.Context, id string) (datastructs.WebhookDelivery, error)
+	ReplayWebhookDelivery(ctx context.Context, delivery datastructs.WebhookDelivery) (datastructs.WebhookDelivery, error)
+}
+
+func validateWebhook(hook datastructs.Webhook) error {
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidWebhook
+	}
+	for _, evt := range hook.Events {
+		if !webhookEvents[evt] {
+			return ErrInvalidWebhook
+		}
+	}
+	return nil
+}
+
+// GetWebhook - the secret is only shown when it is set
+func (s *Service) GetWebhook(ctx context.Context, id string) (datastructs.Webhook, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "GetWebhook", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	hook, err := s.Store.GetWebhook(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		fmt.Println(err)
+		return datastructs.Webhook{}, ErrWebhookNotFound
+	}
+	hook.Secret = ""
+	return hook, nil
+}
+
+func (s *Service) ListWebhooks(ctx context.Context) ([]datastructs.Webhook, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListWebhooks", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	hooks, err := s.Store.ListWebhooks(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	return hooks, nil
+}
+
+// PostWebhook - a secret is made up when none is given,
+// the response is the only time it is shown
+func (s *Service) PostWebhook(ctx context.Context, hook datastructs.Webhook) (datastructs.Webhook, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "PostWebhook", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if err := validateWebhook(hook); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Webhook{}, err
+	}
+	if hook.Secret == "" {
+		secret, err := newToken()
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return datastructs.Webhook{}, err
+		}
+		hook.Secret = secret
+	}
+	return s.Store.PostWebhook(ctx, hook)
+}
+
+// UpdateWebhook - the secret is only changed, and shown,
+// when a new one is given
+func (s *Service) UpdateWebhook(ctx context.Context, id string, hook datastructs.Webhook) (datastructs.Webhook, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "UpdateWebhook", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if err := validateWebhook(hook); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Webhook{}, err
+	}
+	updated, err := s.Store.UpdateWebhook(ctx, id, hook)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		fmt.Println(err)
+		return datastructs.Webhook{}, ErrWebhookNotFound
+	}
+	if hook.Secret == "" {
+		updated.Secret = ""
+	}
+	return updated, nil
+}
+
+func (s *Service) DeleteWebhook(ctx context.Context, id string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "DeleteWebhook", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if err := s.Store.DeleteWebhook(ctx, id); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		fmt.Println(err)
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// ListWebhookDeliveries - the webhook's delivery log, newest first
+func (s *Service) ListWebhookDeliveries(ctx context.Context, q datastructs.WebhookDeliveryQuery) ([]datastructs.WebhookDelivery, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListWebhookDeliveries", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if q.Limit < 0 || q.Limit > maxWebhookDeliveryLimit || q.Offset < 0 {
+		span.SetStatus(codes.Error, ErrInvalidWebhookDeliveryList.Error())
+		return nil, ErrInvalidWebhookDeliveryList
+	}
+	switch q.Status {
+	case "", datastructs.WebhookPending, datastructs.WebhookRetrying,
+		datastructs.WebhookDelivered, datastructs.WebhookFailed:
+	default:
+		span.SetStatus(codes.Error, ErrInvalidWebhookDeliveryList.Error())
+		return nil, ErrInvalidWebhookDeliveryList
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultWebhookDeliveryLimit
+	}
+
+	if _, err := s.Store.GetWebhook(ctx, q.WebhookID); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		fmt.Println(err)
+		return nil, ErrWebhookNotFound
+	}
+	return s.Store.ListWebhookDeliveries(ctx, q)
+}
+
+// ReplayWebhookDelivery - sends a failed delivery's payload again
+// as a new delivery with a fresh set of retries
+func (s *Service) ReplayWebhookDelivery(ctx context.Context, webhookID string, deliveryID string) (datastructs.WebhookDelivery, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ReplayWebhookDelivery", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	delivery, err := s.Store.GetWebhookDelivery(ctx, deliveryID)
+	if err != nil || delivery.WebhookID != webhookID {
+		if err != nil {
+			span.RecordError(err)
+			fmt.Println(err)
+		}
+		span.SetStatus(codes.Error, ErrDeliveryNotFound.Error())
+		return datastructs.WebhookDelivery{}, ErrDeliveryNotFound
+	}
+	if delivery.Status != datastructs.WebhookFailed {
+		span.SetStatus(codes.Error, ErrDeliveryNotFailed.Error())
+		return datastructs.WebhookDelivery{}, ErrDeliveryNotFailed
+	}
+	return s.Store.ReplayWebhookDelivery(ctx, delivery)
+}
@@ -1,8 +1,388 @@
 package datastructs
 
+import "time"
+
+// Moderation statuses a comment can be in once it has been processed
+const (
+	ModerationApproved = "approved"
+	ModerationFlagged  = "flagged"
+	ModerationHeld     = "held"
+	ModerationSpam     = "spam"
+	ModerationRejected = "rejected"
+)
+
+// DefaultSite - the site comments belong to when none is given
+const DefaultSite = "default"
+
+// Votes are reactions too, a user can only hold one of the two
+const (
+	ReactionUpvote   = "up"
+	ReactionDownvote = "down"
+)
+
+// Reactions - every reaction a user can leave on a comment
+var Reactions = []string{
+	ReactionUpvote,
+	ReactionDownvote,
+	"heart",
+	"laugh",
+	"hooray",
+	"confused",
+	"eyes",
+	"rocket",
+}
+
 type Comment struct {
-	ID     string
+	ID       string
+	Site     string
+	Slug     string
+	ParentID string
+	// Body - what the author wrote, it may hold personal information
+	// so it is never sent to readers, ProcessedBody is sent as the body
+	Body             string `json:"-"`
+	Author           string
+	ProcessedBody    string `json:"Body"`
+	BodyHTML         string `json:"body_html"`
+	ProcessStatus    int
+	ModerationStatus string
+	SpamScore        float64
+	BodyHash         string `json:"-"`
+	SimHash          uint64 `json:"-"`
+	PIICategories    []string
+	// Mentions - the usernames the comment mentions with @
+	Mentions []string
+	// Reactions - how many of each reaction the comment has
+	Reactions map[string]int
+	// MyReactions - the caller's own reactions, empty when anonymous
+	MyReactions []string
+	// Pinned comments are listed first, lowest PinPosition first
+	Pinned      bool
+	PinPosition int
+	// Featured - an editor's pick
+	Featured  bool
+	CreatedAt time.Time
+}
+
+// AuthorProfile - what is known of an author, we have no
+// accounts so it is worked out from their approved comments
+type AuthorProfile struct {
+	Name         string
+	FirstSeen    time.Time
+	CommentCount int
+}
+
+// RuleCondition - a single check a rule makes against a comment
+// e.g. {"field": "body", "op": "matches", "value": "(?i)casino"}
+type RuleCondition struct {
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value string `json:"value"`
+}
+
+// Rule - a moderation rule, all conditions must match
+// for the action to be applied to a comment
+type Rule struct {
+	ID         string
+	Name       string
+	Conditions []RuleCondition
+	Action     string
+	Enabled    bool
+	Hits       int64
+	CreatedAt  time.Time
+}
+
+// TrainingExample - a comment a moderator has labelled
+// as spam or not, used to train the spam classifier
+type TrainingExample struct {
+	CommentID string
+	Body      string
+	IsSpam    bool
+	CreatedAt time.Time
+}
+
+// PIISettings - what a site wants done with comments
+// containing personal information
+type PIISettings struct {
+	Site      string
+	Mode      string
+	UpdatedAt time.Time
+}
+
+// States a thread can be in
+const (
+	// ThreadOpen - comments can be posted and edited
+	ThreadOpen = "open"
+	// ThreadClosed - no new comments, existing ones can still be edited
+	ThreadClosed = "closed"
+	// ThreadLocked - no new comments and no edits
+	ThreadLocked = "locked"
+	// ThreadArchived - locked for good, kept for the record
+	ThreadArchived = "archived"
+)
+
+// How comments in a thread are moderated
+const (
+	// ThreadModerationPost - comments go live once they pass processing
+	ThreadModerationPost = "post"
+	// ThreadModerationPre - every comment is held for a moderator
+	ThreadModerationPre = "pre"
+)
+
+// Kinds of thread
+const (
+	ThreadKindDiscussion = "discussion"
+	// ThreadKindQuestion - the slug is a question and one
+	// comment on it can be accepted as the answer
+	ThreadKindQuestion = "question"
+)
+
+// Thread - the settings of the comment thread on a slug, a
+// MaxLength of zero means comments can be any length
+type Thread struct {
+	Slug           string
+	State          string
+	MaxLength      int
+	ModerationMode string
+	Kind           string
+	// Owner - the user who may accept an answer besides moderators
+	Owner            string
+	AcceptedAnswerID string
+	// AcceptedAnswer - the accepted comment, filled in when a thread is fetched
+	AcceptedAnswer *Comment `json:",omitempty"`
+	UpdatedAt      time.Time
+}
+
+// ThreadQuery - which threads to list, Answered only
+// lists question threads with or without an accepted answer
+type ThreadQuery struct {
+	State    string
+	Kind     string
+	Answered *bool
+	// Limit - the most threads listed, all of them when zero
+	Limit int
+}
+
+// Orders a list of comments can be sorted in
+const (
+	SortNew           = "new"
+	SortOld           = "old"
+	SortTop           = "top"
+	SortControversial = "controversial"
+	SortBest          = "best"
+)
+
+// ListQuery - which comments to list and in what order,
+// only approved comments are ever listed
+type ListQuery struct {
+	Slug string
+	Sort string
+	// Featured - only list editor's picks
+	Featured bool
+	Limit    int
+	Offset   int
+}
+
+// SearchQuery - a full text search over comments,
+// phrases can be quoted and words excluded with a leading -
+type SearchQuery struct {
+	Query  string
 	Slug   string
-	Body   string
-	Author string
+	Limit  int
+	Offset int
+}
+
+// SearchResult - a matching comment with its rank and a
+// snippet of the body, matches in the snippet are wrapped in <mark>
+type SearchResult struct {
+	Comment Comment
+	Rank    float64
+	Snippet string
+}
+
+type SearchResults struct {
+	Results []SearchResult
+	Total   int
+}
+
+// Types of event comment.Service emits when comments change
+const (
+	EventCommentCreated   = "comment.created"
+	EventCommentUpdated   = "comment.updated"
+	EventCommentDeleted   = "comment.deleted"
+	EventCommentModerated = "comment.moderated"
+)
+
+// Event - a change made to a comment, deleted
+// events carry the comment as it was before deletion
+type Event struct {
+	// ID - the same every time the event is relayed, listeners
+	// can use it to drop events they have already handled
+	ID         string
+	Type       string
+	Comment    Comment
+	OccurredAt time.Time
+}
+
+// OutboxEvent - an event claimed from the outbox to be relayed,
+// Delivered are the listeners that have already handled it
+type OutboxEvent struct {
+	Event
+	Attempts  int
+	Delivered []string
+}
+
+// OutboxResult - what came of relaying a claimed event. Done events
+// are not relayed again, GivenUp are the listeners that failed every
+// attempt and will never have it. Events that are not done are
+// relayed again from NextAttemptAt
+type OutboxResult struct {
+	EventID       string
+	Delivered     []string
+	GivenUp       []string
+	Error         string
+	Done          bool
+	NextAttemptAt time.Time
+}
+
+// Why a user was sent a notification
+const (
+	NotificationMention = "mention"
+	NotificationReply   = "reply"
+	// NotificationNewComment - a comment on something the user subscribed to
+	NotificationNewComment = "new_comment"
+)
+
+// Notification - something in a thread a user was told about,
+// Actor is the author of the comment that caused it
+type Notification struct {
+	ID        string
+	UserID    string
+	Kind      string
+	CommentID string
+	Slug      string
+	Actor     string
+	Read      bool
+	// UnsubscribeToken - ends the subscription a new_comment notification came from
+	UnsubscribeToken string `json:",omitempty"`
+	CreatedAt        time.Time
+}
+
+type NotificationList struct {
+	Notifications []Notification
+	Unread        int
+}
+
+// NotificationPreferences - which notifications a user wants,
+// users who never set any get every kind
+type NotificationPreferences struct {
+	UserID        string
+	Mentions      bool
+	Replies       bool
+	Subscriptions bool
+	// Email - where digests are sent, digests are off without one
+	Email           string
+	DigestFrequency string
+	// EmailBouncedAt - set when mail to Email bounced, no more
+	// digests are sent until the address is changed
+	EmailBouncedAt *time.Time `json:",omitempty"`
+	UpdatedAt      time.Time
+}
+
+// How often a user is emailed a digest of their unread notifications
+const (
+	DigestOff    = "off"
+	DigestHourly = "hourly"
+	DigestDaily  = "daily"
+)
+
+// Where an email digest is in being delivered
+const (
+	DigestPending  = "pending"
+	DigestRetrying = "retrying"
+	DigestSent     = "sent"
+	// DigestBounced - the mail server refused the address for good
+	DigestBounced = "bounced"
+	// DigestFailed - every retry failed
+	DigestFailed = "failed"
+)
+
+// Digest - one email of a user's unread notifications, the
+// stored digests are the log of every email sent
+type Digest struct {
+	ID            string
+	UserID        string
+	Email         string
+	Frequency     string
+	Status        string
+	Attempts      int
+	LastError     string
+	Notifications []Notification
+	CreatedAt     time.Time
+	SentAt        *time.Time
+}
+
+// Subscription - a user following every comment on a slug, or when
+// CommentID is set only the replies under that comment
+type Subscription struct {
+	ID        string
+	UserID    string
+	Slug      string
+	CommentID string
+	// UnsubscribeToken - ends the subscription without signing in
+	UnsubscribeToken string
+	CreatedAt        time.Time
+}
+
+// Webhook - a URL told about comment events, the body of
+// every delivery is signed with the secret
+type Webhook struct {
+	ID  string
+	URL string
+	// Events - the event types sent, every type when empty
+	Events []string
+	// Secret - only returned when the webhook is created
+	Secret    string `json:",omitempty"`
+	Active    bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Where a webhook delivery is in being sent
+const (
+	WebhookPending   = "pending"
+	WebhookRetrying  = "retrying"
+	WebhookDelivered = "delivered"
+	// WebhookFailed - every retry failed, it can be replayed
+	WebhookFailed = "failed"
+)
+
+// WebhookDelivery - one event sent to one webhook, the
+// stored deliveries are the log of every attempt's outcome
+type WebhookDelivery struct {
+	ID        string
+	WebhookID string
+	EventID   string
+	EventType string
+	// Payload - the exact JSON body that is signed and sent
+	Payload        string
+	Status         string
+	Attempts       int
+	ResponseStatus int
+	LastError      string
+	// ReplayOf - the failed delivery this one replays
+	ReplayOf      string `json:",omitempty"`
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	DeliveredAt   *time.Time
+	// URL and Secret - of the webhook, filled in for sending
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// WebhookDeliveryQuery - filters a webhook's delivery log
+type WebhookDeliveryQuery struct {
+	WebhookID string
+	Status    string
+	Limit     int
+	Offset    int
 }
@@ -0,0 +1,201 @@
+package db
+
+// This file in the db package reads many comments at once for
+// transports that would otherwise fetch them one at a time
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+// GetComments - the approved comments with the given ids,
+// ids of missing or unapproved comments are left out
+func (d *Database) GetComments(ctx context.Context, ids []string) ([]datastructs.Comment, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "GetComments", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	rows, err := d.Client.QueryContext(
+		ctx,
+		`SELECT `+commentColumns+`
+		 FROM comments
+		 WHERE id = ANY($1) AND moderation_status = $2`,
+		pq.Array(ids),
+		datastructs.ModerationApproved,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to fetch comments: %w", err)
+	}
+	return scanComments(rows)
+}
+
+// ListReplies - up to limit approved replies to each of the
+// parents, oldest first
+func (d *Database) ListReplies(ctx context.Context, parentIDs []string, limit int) ([]datastructs.Comment, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListReplies", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	rows, err := d.Client.QueryContext(
+		ctx,
+		`SELECT `+commentColumns+`
+		 FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY parent_id ORDER BY created_at, id) AS n
+			FROM comments
+			WHERE parent_id = ANY($1) AND moderation_status = $2
+		 ) replies
+		 WHERE n <= $3
+		 ORDER BY created_at, id`,
+		pq.Array(parentIDs),
+		datastructs.ModerationApproved,
+		limit,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to list replies: %w", err)
+	}
+	return scanComments(rows)
+}
+
+// ListCommentPages - a page of the approved, unpinned comments on
+// each of the pages' slugs in the sort, in the order of the pages
+func (d *Database) ListCommentPages(ctx context.Context, sort string, featured bool, pages []datastructs.ListQuery) ([][]datastructs.Comment, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListCommentPages", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	order, ok := listOrders[sort]
+	if !ok {
+		err := fmt.Errorf("unknown sort %q", sort)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	slugs := make([]string, len(pages))
+	offsets := make([]int64, len(pages))
+	limits := make([]int64, len(pages))
+	for i, page := range pages {
+		slugs[i] = page.Slug
+		offsets[i] = int64(page.Offset)
+		limits[i] = int64(page.Limit)
+	}
+
+	// A slug asked for by more than one page is numbered once for each
+	rows, err := d.Client.QueryContext(
+		ctx,
+		`SELECT `+commentColumns+`, page
+		 FROM (
+			SELECT comments.*, pages.page, pages.skip, pages.take,
+				ROW_NUMBER() OVER (PARTITION BY pages.page ORDER BY `+order+`) AS n
+			FROM comments
+			JOIN unnest($1::text[], $2::bigint[], $3::bigint[]) WITH ORDINALITY
+				AS pages(slug, skip, take, page) ON comments.slug = pages.slug
+			WHERE moderation_status = $4
+			AND pin_position IS NULL
+			AND (NOT $5 OR featured)
+		 ) listed
+		 WHERE n > skip AND n <= skip + take
+		 ORDER BY page, n`,
+		pq.Array(slugs),
+		pq.Array(offsets),
+		pq.Array(limits),
+		datastructs.ModerationApproved,
+		featured,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to list comment pages: %w", err)
+	}
+	defer rows.Close()
+
+	listed := make([][]datastructs.Comment, len(pages))
+	for i := range listed {
+		listed[i] = []datastructs.Comment{}
+	}
+	for rows.Next() {
+		var page int
+		cmtRow, err := scanCommentRow(rows, &page)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		listed[page-1] = append(listed[page-1], convertCommentRowToComment(cmtRow))
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to list comment pages: %w", err)
+	}
+	return listed, nil
+}
+
+// GetAuthorProfiles - the profiles of the authors with approved
+// comments, authors without any are left out
+func (d *Database) GetAuthorProfiles(ctx context.Context, authors []string) ([]datastructs.AuthorProfile, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "GetAuthorProfiles", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	rows, err := d.Client.QueryContext(
+		ctx,
+		`SELECT author, MIN(created_at), COUNT(*)
+		 FROM comments
+		 WHERE author = ANY($1) AND moderation_status = $2
+		 GROUP BY author`,
+		pq.Array(authors),
+		datastructs.ModerationApproved,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to fetch author profiles: %w", err)
+	}
+	defer rows.Close()
+
+	profiles := []datastructs.AuthorProfile{}
+	for rows.Next() {
+		var profile datastructs.AuthorProfile
+		if err := rows.Scan(&profile.Name, &profile.FirstSeen, &profile.CommentCount); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, fmt.Errorf("failed to scan author profile: %w", err)
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, rows.Err()
+}
+
+func scanComments(rows *sql.Rows) ([]datastructs.Comment, error) {
+	defer rows.Close()
+
+	cmts := []datastructs.Comment{}
+	for rows.Next() {
+		cmtRow, err := scanCommentRow(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		cmts = append(cmts, convertCommentRowToComment(cmtRow))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read comments: %w", err)
+	}
+	return cmts, nil
+}
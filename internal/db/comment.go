@@ -6,10 +6,14 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/imraan1901/comment-section-rest-api/internal/processor"
+	"github.com/lib/pq"
 	uuid "github.com/satori/go.uuid"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/codes"
@@ -17,18 +21,91 @@ import (
 )
 
 type CommentRow struct {
-	ID     string
-	Slug   sql.NullString
-	Body   sql.NullString
-	Author sql.NullString
+	ID               string
+	Site             sql.NullString
+	Slug             sql.NullString
+	ParentID         sql.NullString `db:"parent_id"`
+	Body             sql.NullString
+	Author           sql.NullString
+	ProcessedBody    sql.NullString  `db:"processed_body"`
+	BodyHTML         sql.NullString  `db:"body_html"`
+	ProcessStatus    sql.NullString  `db:"process_status"`
+	ModerationStatus sql.NullString  `db:"moderation_status"`
+	SpamScore        sql.NullFloat64 `db:"spam_score"`
+	BodyHash         sql.NullString  `db:"body_hash"`
+	SimHash          sql.NullInt64   `db:"sim_hash"`
+	PIICategories    pq.StringArray  `db:"pii_categories"`
+	Mentions         pq.StringArray  `db:"mentions"`
+	PinPosition      sql.NullInt64   `db:"pin_position"`
+	Featured         sql.NullBool    `db:"featured"`
+	CreatedAt        sql.NullTime    `db:"created_at"`
+}
+
+// commentColumns - the columns every comment query selects,
+// in the order scanCommentRow expects them
+const commentColumns = `id, site, slug, parent_id, body, author, processed_body, body_html,
+	process_status, moderation_status, spam_score, pii_categories, mentions,
+	pin_position, featured, created_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanCommentRow - scans the commentColumns of a row, any extra
+// columns selected after them are scanned into extra
+func scanCommentRow(row rowScanner, extra ...any) (CommentRow, error) {
+	var cmtRow CommentRow
+	dest := []any{
+		&cmtRow.ID,
+		&cmtRow.Site,
+		&cmtRow.Slug,
+		&cmtRow.ParentID,
+		&cmtRow.Body,
+		&cmtRow.Author,
+		&cmtRow.ProcessedBody,
+		&cmtRow.BodyHTML,
+		&cmtRow.ProcessStatus,
+		&cmtRow.ModerationStatus,
+		&cmtRow.SpamScore,
+		&cmtRow.PIICategories,
+		&cmtRow.Mentions,
+		&cmtRow.PinPosition,
+		&cmtRow.Featured,
+		&cmtRow.CreatedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	return cmtRow, err
 }
 
 func convertCommentRowToComment(c CommentRow) datastructs.Comment {
+	// Comments that were never processed have no status yet
+	processStatus := int(processor.UnProcessed)
+	if c.ProcessStatus.Valid {
+		processStatus, _ = strconv.Atoi(c.ProcessStatus.String)
+	}
+	// nor a processed body, readers see the body as it was written
+	processedBody := c.ProcessedBody.String
+	if !c.ProcessedBody.Valid {
+		processedBody = c.Body.String
+	}
 	return datastructs.Comment{
-		ID:     c.ID,
-		Slug:   c.Slug.String,
-		Body:   c.Slug.String,
-		Author: c.Author.String,
+		ID:               c.ID,
+		Site:             c.Site.String,
+		Slug:             c.Slug.String,
+		ParentID:         c.ParentID.String,
+		Body:             c.Body.String,
+		Author:           c.Author.String,
+		ProcessedBody:    processedBody,
+		BodyHTML:         c.BodyHTML.String,
+		ProcessStatus:    processStatus,
+		ModerationStatus: c.ModerationStatus.String,
+		SpamScore:        c.SpamScore.Float64,
+		PIICategories:    c.PIICategories,
+		Mentions:         c.Mentions,
+		Pinned:           c.PinPosition.Valid,
+		PinPosition:      int(c.PinPosition.Int64),
+		Featured:         c.Featured.Bool,
+		CreatedAt:        c.CreatedAt.Time,
 	}
 }
 
@@ -41,16 +118,15 @@ func (d *Database) GetComment(
 	_, span := otel.Tracer(name).Start(ctx, "GetComment", tr.WithTimestamp(startTime))
 	defer span.End(tr.WithTimestamp(time.Now()))
 
-	var cmtRow CommentRow
 	row := d.Client.QueryRowContext(
 		ctx,
-		`SELECT id, slug, body, author
+		`SELECT `+commentColumns+`
 		 FROM comments
 		 WHERE id=$1`,
 		uuid,
 	)
 
-	err := row.Scan(&cmtRow.ID, &cmtRow.Slug, &cmtRow.Body, &cmtRow.Author)
+	cmtRow, err := scanCommentRow(row)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
@@ -60,61 +136,128 @@ func (d *Database) GetComment(
 	return convertCommentRowToComment(cmtRow), nil
 }
 
+// convertCommentToCommentRow - the row for a comment
+// that has been through the processor
+func convertCommentToCommentRow(cmt datastructs.Comment) CommentRow {
+	return CommentRow{
+		ID:               cmt.ID,
+		Site:             sql.NullString{String: cmt.Site, Valid: true},
+		Slug:             sql.NullString{String: cmt.Slug, Valid: true},
+		ParentID:         sql.NullString{String: cmt.ParentID, Valid: cmt.ParentID != ""},
+		Author:           sql.NullString{String: cmt.Author, Valid: true},
+		Body:             sql.NullString{String: cmt.Body, Valid: true},
+		ProcessedBody:    sql.NullString{String: cmt.ProcessedBody, Valid: true},
+		BodyHTML:         sql.NullString{String: cmt.BodyHTML, Valid: true},
+		ProcessStatus:    sql.NullString{String: strconv.Itoa(cmt.ProcessStatus), Valid: true},
+		ModerationStatus: sql.NullString{String: cmt.ModerationStatus, Valid: true},
+		SpamScore:        sql.NullFloat64{Float64: cmt.SpamScore, Valid: true},
+		// Fingerprints are only there when the duplicate stage ran
+		BodyHash:      sql.NullString{String: cmt.BodyHash, Valid: cmt.BodyHash != ""},
+		SimHash:       sql.NullInt64{Int64: int64(cmt.SimHash), Valid: cmt.BodyHash != ""},
+		PIICategories: pq.StringArray(cmt.PIICategories),
+		Mentions:      pq.StringArray(cmt.Mentions),
+		CreatedAt:     sql.NullTime{Time: cmt.CreatedAt, Valid: true},
+	}
+}
+
+// PostComment - stores a processed comment and its created
+// event in the outbox in one transaction
 func (d *Database) PostComment(ctx context.Context, cmt datastructs.Comment) (datastructs.Comment, error) {
 
 	startTime := time.Now()
 	_, span := otel.Tracer(name).Start(ctx, "PostComment", tr.WithTimestamp(startTime))
 	defer span.End(tr.WithTimestamp(time.Now()))
 
-	cmt.ID = uuid.NewV4().String()
+	// The service gives comments their id before processing
+	if cmt.ID == "" {
+		cmt.ID = uuid.NewV4().String()
+	}
+	if cmt.CreatedAt.IsZero() {
+		cmt.CreatedAt = time.Now().UTC()
+	}
 
-	postRow := CommentRow{
-		ID:     cmt.ID,
-		Slug:   sql.NullString{String: cmt.Slug, Valid: true},
-		Author: sql.NullString{String: cmt.Author, Valid: true},
-		Body:   sql.NullString{String: cmt.Body, Valid: true},
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Comment{}, fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	rows, err := d.Client.NamedQueryContext(
+	defer tx.Rollback()
+
+	_, err = tx.NamedExecContext(
 		ctx,
 		`INSERT INTO comments
-		(id, slug, author, body)
+		(id, site, slug, parent_id, author, body, processed_body, body_html, process_status,
+		moderation_status, spam_score, body_hash, sim_hash, pii_categories, mentions, created_at)
 		VALUES
-		(:id, :slug, :author, :body)`,
-		postRow,
+		(:id, :site, :slug, :parent_id, :author, :body, :processed_body, :body_html, :process_status,
+		:moderation_status, :spam_score, :body_hash, :sim_hash, :pii_categories, :mentions, :created_at)`,
+		convertCommentToCommentRow(cmt),
 	)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		return datastructs.Comment{}, fmt.Errorf("failed to insert comment: %w", err)
 	}
-	if err := rows.Close(); err != nil {
+	if err := insertOutboxEvent(ctx, tx, datastructs.EventCommentCreated, cmt); err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
-		return datastructs.Comment{}, fmt.Errorf("failed to close rows: %w", err)
+		return datastructs.Comment{}, err
 	}
 
+	if err := tx.Commit(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Comment{}, fmt.Errorf("failed to insert comment: %w", err)
+	}
 	return cmt, nil
 }
 
+// DeleteComment - the deleted event carries the
+// comment as it was, deleting nothing records no event
 func (d *Database) DeleteComment(ctx context.Context, id string) error {
 
 	startTime := time.Now()
 	_, span := otel.Tracer(name).Start(ctx, "DeleteComment", tr.WithTimestamp(startTime))
 	defer span.End(tr.WithTimestamp(time.Now()))
 
-	_, err := d.Client.ExecContext(
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	cmtRow, err := scanCommentRow(tx.QueryRowContext(
 		ctx,
-		`DELETE FROM comments where id=$1`,
+		`DELETE FROM comments WHERE id=$1 RETURNING `+commentColumns,
 		id,
-	)
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
-		fmt.Errorf("failed to delete comment from database: %w", err)
+		return fmt.Errorf("failed to delete comment from database: %w", err)
+	}
+	if err := insertOutboxEvent(ctx, tx, datastructs.EventCommentDeleted, convertCommentRowToComment(cmtRow)); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to delete comment from database: %w", err)
 	}
 	return nil
 }
 
+// UpdateComment - stores what the author changed along with the
+// processor's output for it, and the updated event in the outbox
 func (d *Database) UpdateComment(
 	ctx context.Context,
 	id string,
@@ -125,34 +268,254 @@ func (d *Database) UpdateComment(
 	_, span := otel.Tracer(name).Start(ctx, "UpdateComment", tr.WithTimestamp(startTime))
 	defer span.End(tr.WithTimestamp(time.Now()))
 
-	cmtRow := CommentRow{
-		ID:     id,
-		Slug:   sql.NullString{String: cmt.Slug, Valid: true},
-		Author: sql.NullString{String: cmt.Author, Valid: true},
-		Body:   sql.NullString{String: cmt.Body, Valid: true},
+	cmt.ID = id
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Comment{}, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	rows, err := d.Client.NamedQueryContext(
+	res, err := tx.NamedExecContext(
 		ctx,
 		`UPDATE comments SET
 		slug = :slug,
 		author = :author,
-		body = :body
+		body = :body,
+		processed_body = :processed_body,
+		body_html = :body_html,
+		process_status = :process_status,
+		moderation_status = :moderation_status,
+		spam_score = :spam_score,
+		body_hash = :body_hash,
+		sim_hash = :sim_hash,
+		pii_categories = :pii_categories,
+		mentions = :mentions
 		WHERE id = :id`,
-		cmtRow,
+		convertCommentToCommentRow(cmt),
 	)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		return datastructs.Comment{}, fmt.Errorf("failed to update comment: %w", err)
 	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		span.SetStatus(codes.Error, sql.ErrNoRows.Error())
+		return datastructs.Comment{}, fmt.Errorf("failed to update comment: %w", sql.ErrNoRows)
+	}
+	if err := insertOutboxEvent(ctx, tx, datastructs.EventCommentUpdated, cmt); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Comment{}, err
+	}
 
-	if err := rows.Close(); err != nil {
+	if err := tx.Commit(); err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
-		return datastructs.Comment{}, fmt.Errorf("failed to close rows: %w", err)
+		return datastructs.Comment{}, fmt.Errorf("failed to update comment: %w", err)
 	}
+	return cmt, nil
+}
 
-	return convertCommentRowToComment(cmtRow), nil
+// UpdateModerationStatus - records a moderator's decision on
+// a comment, and the moderated event in the outbox
+func (d *Database) UpdateModerationStatus(ctx context.Context, id string, status string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "UpdateModerationStatus", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	cmtRow, err := scanCommentRow(tx.QueryRowContext(
+		ctx,
+		`UPDATE comments SET moderation_status = $2 WHERE id = $1 RETURNING `+commentColumns,
+		id,
+		status,
+	))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to update moderation status: %w", err)
+	}
+	if err := insertOutboxEvent(ctx, tx, datastructs.EventCommentModerated, convertCommentRowToComment(cmtRow)); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to update moderation status: %w", err)
+	}
+	return nil
+}
+
+// ListRecentComments - returns the newest comments first
+func (d *Database) ListRecentComments(ctx context.Context, limit int) ([]datastructs.Comment, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListRecentComments", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	rows, err := d.Client.QueryContext(
+		ctx,
+		`SELECT `+commentColumns+`
+		 FROM comments
+		 ORDER BY created_at DESC
+		 LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to list recent comments: %w", err)
+	}
+	defer rows.Close()
 
+	cmts := []datastructs.Comment{}
+	for rows.Next() {
+		cmtRow, err := scanCommentRow(rows)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		cmts = append(cmts, convertCommentRowToComment(cmtRow))
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to list recent comments: %w", err)
+	}
+	return cmts, nil
+}
+
+// listOrders - the ORDER BY of each sort, every one of
+// them is backed by an index on (slug, moderation_status, ...)
+var listOrders = map[string]string{
+	datastructs.SortNew:           `created_at DESC`,
+	datastructs.SortOld:           `created_at ASC`,
+	datastructs.SortTop:           `score DESC, created_at DESC`,
+	datastructs.SortControversial: `controversy DESC, created_at DESC`,
+	datastructs.SortBest:          `wilson_score DESC, created_at DESC`,
+}
+
+// ListComments - the approved, unpinned comments on a slug in the requested order
+func (d *Database) ListComments(ctx context.Context, q datastructs.ListQuery) ([]datastructs.Comment, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListComments", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	order, ok := listOrders[q.Sort]
+	if !ok {
+		err := fmt.Errorf("unknown sort %q", q.Sort)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	rows, err := d.Client.QueryContext(
+		ctx,
+		`SELECT `+commentColumns+`
+		 FROM comments
+		 WHERE slug = $1 AND moderation_status = $2
+		 AND pin_position IS NULL
+		 AND (NOT $3 OR featured)
+		 ORDER BY `+order+`
+		 LIMIT $4 OFFSET $5`,
+		q.Slug,
+		datastructs.ModerationApproved,
+		q.Featured,
+		q.Limit,
+		q.Offset,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to list comments: %w", err)
+	}
+	defer rows.Close()
+
+	cmts := []datastructs.Comment{}
+	for rows.Next() {
+		cmtRow, err := scanCommentRow(rows)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		cmts = append(cmts, convertCommentRowToComment(cmtRow))
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to list comments: %w", err)
+	}
+	return cmts, nil
+}
+
+// GetAuthorFirstSeen - the time of the author's first comment,
+// we have no accounts so this is how old an author is
+func (d *Database) GetAuthorFirstSeen(ctx context.Context, author string) (time.Time, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "GetAuthorFirstSeen", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var firstSeen sql.NullTime
+	err := d.Client.QueryRowContext(
+		ctx,
+		`SELECT MIN(created_at) FROM comments WHERE author=$1`,
+		author,
+	).Scan(&firstSeen)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return time.Time{}, fmt.Errorf("failed to fetch author first seen: %w", err)
+	}
+	return firstSeen.Time, nil
+}
+
+// ScanComments - calls fn with every stored comment, oldest first
+func (d *Database) ScanComments(ctx context.Context, fn func(datastructs.Comment) error) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ScanComments", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	rows, err := d.Client.QueryContext(
+		ctx,
+		`SELECT `+commentColumns+`
+		 FROM comments
+		 ORDER BY created_at`,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to scan comments: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		cmtRow, err := scanCommentRow(rows)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return fmt.Errorf("failed to scan comment: %w", err)
+		}
+		if err := fn(convertCommentRowToComment(cmtRow)); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
 }
@@ -0,0 +1,49 @@
+package db
+
+// This file in the db package reads the per slug comment
+// counts kept up to date by a trigger on comments
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+// CountComments - approved comments per slug, slugs
+// without any comments are left out
+func (d *Database) CountComments(ctx context.Context, slugs []string) (map[string]int, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "CountComments", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	rows, err := d.Client.QueryContext(
+		ctx,
+		`SELECT slug, count FROM comment_counts WHERE slug = ANY($1)`,
+		pq.Array(slugs),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to count comments: %w", err)
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var slug string
+		var count int
+		if err := rows.Scan(&slug, &count); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, fmt.Errorf("failed to scan comment count: %w", err)
+		}
+		counts[slug] = count
+	}
+	return counts, rows.Err()
+}
@@ -18,6 +18,9 @@ const name = "db"
 
 type Database struct {
 	Client *sqlx.DB
+	// connectionString - kept for connections outside
+	// the pool, such as the one LISTENing for events
+	connectionString string
 }
 
 func NewDatabase(ctx context.Context) (*Database, error) {
@@ -44,7 +47,8 @@ func NewDatabase(ctx context.Context) (*Database, error) {
 	}
 
 	return &Database{
-		Client: dbConn,
+		Client:           dbConn,
+		connectionString: connectionString,
 	}, nil
 }
 
@@ -0,0 +1,335 @@
+package db
+
+// This file in the db package builds the email digests of
+// unread notifications and keeps the log of sending them
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// digestWindow - older unread notifications are left out of digests
+	digestWindow = 7 * 24 * time.Hour
+	// maxDigestNotifications - the most notifications in one digest
+	maxDigestNotifications = 50
+	// maxDigestsPerBuild - the most digests built in one call
+	maxDigestsPerBuild = 100
+)
+
+type DigestRow struct {
+	ID        string
+	UserID    string `db:"user_id"`
+	Email     string
+	Frequency string
+	Status    string
+	Attempts  int
+	LastError string       `db:"last_error"`
+	CreatedAt time.Time    `db:"created_at"`
+	SentAt    sql.NullTime `db:"sent_at"`
+}
+
+const digestColumns = `id, user_id, email, frequency, status, attempts, last_error, created_at, sent_at`
+
+func convertDigestRowToDigest(d DigestRow) datastructs.Digest {
+	digest := datastructs.Digest{
+		ID:        d.ID,
+		UserID:    d.UserID,
+		Email:     d.Email,
+		Frequency: d.Frequency,
+		Status:    d.Status,
+		Attempts:  d.Attempts,
+		LastError: d.LastError,
+		CreatedAt: d.CreatedAt,
+	}
+	if d.SentAt.Valid {
+		digest.SentAt = &d.SentAt.Time
+	}
+	return digest
+}
+
+type dueDigestRow struct {
+	UserID          string `db:"user_id"`
+	Email           string
+	DigestFrequency string `db:"digest_frequency"`
+}
+
+// CreateDueDigests - a pending digest for each user with a digest
+// frequency, a working email address, no digest within the last period
+// and unread notifications no digest has claimed yet. The users are
+// locked while their digest is built so two servers never both build one
+func (d *Database) CreateDueDigests(ctx context.Context, now time.Time) (int, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "CreateDueDigests", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	since := now.Add(-digestWindow)
+	var due []dueDigestRow
+	err = tx.SelectContext(
+		ctx,
+		&due,
+		`SELECT p.user_id, p.email, p.digest_frequency
+		 FROM notification_preferences p
+		 WHERE p.digest_frequency IN ('hourly', 'daily')
+		 AND p.email <> '' AND p.email_bounced_at IS NULL
+		 AND NOT EXISTS (
+			SELECT 1 FROM email_digests d
+			WHERE d.user_id = p.user_id
+			AND d.created_at > $1::timestamptz - CASE p.digest_frequency
+				WHEN 'hourly' THEN interval '1 hour'
+				ELSE interval '1 day'
+			END
+		 )
+		 AND EXISTS (
+			SELECT 1 FROM notifications n
+			WHERE n.user_id = p.user_id AND n.read_at IS NULL
+			AND n.digest_id IS NULL AND n.created_at > $2
+		 )
+		 ORDER BY p.user_id
+		 LIMIT $3
+		 FOR UPDATE OF p SKIP LOCKED`,
+		now,
+		since,
+		maxDigestsPerBuild,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, fmt.Errorf("failed to find due digests: %w", err)
+	}
+
+	for _, user := range due {
+		id := uuid.NewV4().String()
+		_, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO email_digests
+			(id, user_id, email, frequency, status, next_attempt_at, created_at)
+			VALUES
+			($1, $2, $3, $4, $5, $6, $6)`,
+			id,
+			user.UserID,
+			user.Email,
+			user.DigestFrequency,
+			datastructs.DigestPending,
+			now,
+		)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return 0, fmt.Errorf("failed to create digest: %w", err)
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			`UPDATE notifications SET digest_id = $1
+			 WHERE id IN (
+				SELECT id FROM notifications
+				WHERE user_id = $2 AND read_at IS NULL
+				AND digest_id IS NULL AND created_at > $3
+				ORDER BY created_at DESC
+				LIMIT $4
+			 )`,
+			id,
+			user.UserID,
+			since,
+			maxDigestNotifications,
+		)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return 0, fmt.Errorf("failed to claim digest notifications: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, fmt.Errorf("failed to create digests: %w", err)
+	}
+	return len(due), nil
+}
+
+type digestNotificationRow struct {
+	NotificationRow
+	DigestID string `db:"digest_id"`
+}
+
+// LeaseDueDigests - counts an attempt against each digest that is due
+// and pushes its next attempt back by the lease, so a digest whose
+// sender dies part way through is picked up again once the lease ends
+func (d *Database) LeaseDueDigests(
+	ctx context.Context,
+	now time.Time,
+	limit int,
+	lease time.Duration,
+) ([]datastructs.Digest, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "LeaseDueDigests", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var rows []DigestRow
+	err := d.Client.SelectContext(
+		ctx,
+		&rows,
+		`UPDATE email_digests SET attempts = attempts + 1, next_attempt_at = $2
+		 WHERE id IN (
+			SELECT id FROM email_digests
+			WHERE status IN ('pending', 'retrying') AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING `+digestColumns,
+		now,
+		now.Add(lease),
+		limit,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to lease digests: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+	}
+	var notificationRows []digestNotificationRow
+	err = d.Client.SelectContext(
+		ctx,
+		&notificationRows,
+		`SELECT id, user_id, kind, comment_id, slug, actor, unsubscribe_token, read_at, created_at, digest_id
+		 FROM notifications
+		 WHERE digest_id = ANY($1::uuid[])
+		 ORDER BY created_at DESC`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to fetch digest notifications: %w", err)
+	}
+
+	notifications := make(map[string][]datastructs.Notification, len(rows))
+	for _, row := range notificationRows {
+		notifications[row.DigestID] = append(notifications[row.DigestID], convertNotificationRowToNotification(row.NotificationRow))
+	}
+	digests := make([]datastructs.Digest, 0, len(rows))
+	for _, row := range rows {
+		digest := convertDigestRowToDigest(row)
+		digest.Notifications = notifications[row.ID]
+		digests = append(digests, digest)
+	}
+	return digests, nil
+}
+
+// RecordDigestAttempt - stores the outcome of sending a digest, a
+// zero nextAttempt keeps the lease. A bounce marks the address so
+// nothing more is sent to it until the user changes it
+func (d *Database) RecordDigestAttempt(ctx context.Context, digest datastructs.Digest, nextAttempt time.Time) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "RecordDigestAttempt", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var sentAt sql.NullTime
+	if digest.SentAt != nil {
+		sentAt = sql.NullTime{Time: *digest.SentAt, Valid: true}
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`UPDATE email_digests SET status = $2, last_error = $3, sent_at = $4,
+		 next_attempt_at = COALESCE($5, next_attempt_at)
+		 WHERE id = $1`,
+		digest.ID,
+		digest.Status,
+		digest.LastError,
+		sentAt,
+		sql.NullTime{Time: nextAttempt, Valid: !nextAttempt.IsZero()},
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to record digest attempt: %w", err)
+	}
+
+	if digest.Status == datastructs.DigestBounced {
+		_, err = tx.ExecContext(
+			ctx,
+			`UPDATE notification_preferences SET email_bounced_at = $3
+			 WHERE user_id = $1 AND email = $2`,
+			digest.UserID,
+			digest.Email,
+			time.Now().UTC(),
+		)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return fmt.Errorf("failed to record bounce: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to record digest attempt: %w", err)
+	}
+	return nil
+}
+
+// StopDigests - turns digests off for the user a digest was sent to,
+// the digest's id is what its unsubscribe link carries
+func (d *Database) StopDigests(ctx context.Context, digestID string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "StopDigests", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	res, err := d.Client.ExecContext(
+		ctx,
+		`UPDATE notification_preferences SET digest_frequency = $2
+		 WHERE user_id = (SELECT user_id FROM email_digests WHERE id = $1)`,
+		digestID,
+		datastructs.DigestOff,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to stop digests: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		span.SetStatus(codes.Error, sql.ErrNoRows.Error())
+		return fmt.Errorf("failed to stop digests: %w", sql.ErrNoRows)
+	}
+	return nil
+}
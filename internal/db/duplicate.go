@@ -0,0 +1,122 @@
+package db
+
+// This file in the db package looks up the fingerprints
+// the duplicate stage compares new comments against
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/imraan1901/comment-section-rest-api/internal/processor"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+// maxSimHashCandidates - bounds how many comments sharing a band
+// are pulled back to have their full fingerprint compared
+const maxSimHashCandidates = 500
+
+// CountAuthorDuplicates - how many of the author's comments since the
+// given time have the same normalized body hash
+func (d *Database) CountAuthorDuplicates(
+	ctx context.Context,
+	author string,
+	bodyHash string,
+	since time.Time,
+	excludeID string,
+) (int, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "CountAuthorDuplicates", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var count int
+	err := d.Client.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*) FROM comments
+		 WHERE author = $1
+		 AND body_hash = $2
+		 AND created_at >= $3
+		 AND ($4 = '' OR id <> $4::uuid)`,
+		author,
+		bodyHash,
+		since,
+		excludeID,
+	).Scan(&count)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, fmt.Errorf("failed to count duplicate comments: %w", err)
+	}
+	return count, nil
+}
+
+// FindSimHashCandidates - other authors' comments since the given time
+// whose fingerprint shares at least one band with simHash, callers
+// still need to check the hamming distance of what comes back
+func (d *Database) FindSimHashCandidates(
+	ctx context.Context,
+	simHash uint64,
+	since time.Time,
+	excludeAuthor string,
+) ([]datastructs.Comment, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "FindSimHashCandidates", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	args := []any{since, excludeAuthor}
+	for i := 0; i < processor.SimHashBands; i++ {
+		args = append(args, int64(processor.SimHashBand(simHash, i)))
+	}
+	args = append(args, maxSimHashCandidates)
+
+	rows, err := d.Client.QueryContext(
+		ctx,
+		`SELECT id, author, sim_hash FROM comments
+		 WHERE created_at >= $1
+		 AND author <> $2
+		 AND sim_hash IS NOT NULL
+		 AND (
+			(sim_hash & 255) = $3
+			OR ((sim_hash >> 8) & 255) = $4
+			OR ((sim_hash >> 16) & 255) = $5
+			OR ((sim_hash >> 24) & 255) = $6
+			OR ((sim_hash >> 32) & 255) = $7
+			OR ((sim_hash >> 40) & 255) = $8
+			OR ((sim_hash >> 48) & 255) = $9
+			OR ((sim_hash >> 56) & 255) = $10
+		 )
+		 ORDER BY created_at DESC
+		 LIMIT $11`,
+		args...,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to find near duplicate comments: %w", err)
+	}
+	defer rows.Close()
+
+	cmts := []datastructs.Comment{}
+	for rows.Next() {
+		var cmt datastructs.Comment
+		var fingerprint int64
+		if err := rows.Scan(&cmt.ID, &cmt.Author, &fingerprint); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, fmt.Errorf("failed to scan near duplicate comment: %w", err)
+		}
+		cmt.SimHash = uint64(fingerprint)
+		cmts = append(cmts, cmt)
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to find near duplicate comments: %w", err)
+	}
+	return cmts, nil
+}
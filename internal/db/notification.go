@@ -0,0 +1,286 @@
+package db
+
+// This file in the db package stores each user's notifications
+// and which kinds of notification they want
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type NotificationRow struct {
+	ID               string
+	UserID           string `db:"user_id"`
+	Kind             string
+	CommentID        string `db:"comment_id"`
+	Slug             string
+	Actor            string
+	UnsubscribeToken sql.NullString `db:"unsubscribe_token"`
+	ReadAt           sql.NullTime   `db:"read_at"`
+	CreatedAt        time.Time      `db:"created_at"`
+}
+
+func convertNotificationRowToNotification(n NotificationRow) datastructs.Notification {
+	return datastructs.Notification{
+		ID:               n.ID,
+		UserID:           n.UserID,
+		Kind:             n.Kind,
+		CommentID:        n.CommentID,
+		Slug:             n.Slug,
+		Actor:            n.Actor,
+		Read:             n.ReadAt.Valid,
+		UnsubscribeToken: n.UnsubscribeToken.String,
+		CreatedAt:        n.CreatedAt,
+	}
+}
+
+// CreateNotifications - stores the notifications in one transaction,
+// one the user was already sent for the same comment is skipped
+func (d *Database) CreateNotifications(ctx context.Context, notifications []datastructs.Notification) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "CreateNotifications", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	for _, n := range notifications {
+		_, err := tx.NamedExecContext(
+			ctx,
+			`INSERT INTO notifications
+			(id, user_id, kind, comment_id, slug, actor, unsubscribe_token, created_at)
+			VALUES
+			(:id, :user_id, :kind, :comment_id, :slug, :actor, :unsubscribe_token, :created_at)
+			ON CONFLICT (user_id, comment_id, kind) DO NOTHING`,
+			NotificationRow{
+				ID:        uuid.NewV4().String(),
+				UserID:    n.UserID,
+				Kind:      n.Kind,
+				CommentID: n.CommentID,
+				Slug:      n.Slug,
+				Actor:     n.Actor,
+				UnsubscribeToken: sql.NullString{
+					String: n.UnsubscribeToken,
+					Valid:  n.UnsubscribeToken != "",
+				},
+				CreatedAt: now,
+			},
+		)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return fmt.Errorf("failed to create notification: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to create notifications: %w", err)
+	}
+	return nil
+}
+
+// ListNotifications - the user's notifications newest first,
+// with how many of all their notifications are unread
+func (d *Database) ListNotifications(
+	ctx context.Context,
+	userID string,
+	unreadOnly bool,
+	limit int,
+	offset int,
+) (datastructs.NotificationList, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListNotifications", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var rows []NotificationRow
+	err := d.Client.SelectContext(
+		ctx,
+		&rows,
+		`SELECT id, user_id, kind, comment_id, slug, actor, unsubscribe_token, read_at, created_at
+		 FROM notifications
+		 WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+		 ORDER BY created_at DESC
+		 LIMIT $3 OFFSET $4`,
+		userID,
+		unreadOnly,
+		limit,
+		offset,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.NotificationList{}, fmt.Errorf("failed to list notifications: %w", err)
+	}
+
+	list := datastructs.NotificationList{Notifications: make([]datastructs.Notification, 0, len(rows))}
+	for _, row := range rows {
+		list.Notifications = append(list.Notifications, convertNotificationRowToNotification(row))
+	}
+
+	err = d.Client.GetContext(
+		ctx,
+		&list.Unread,
+		`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`,
+		userID,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.NotificationList{}, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	return list, nil
+}
+
+// MarkNotificationsRead - marks the user's notifications with
+// the given ids as read, or all of them when no ids are given
+func (d *Database) MarkNotificationsRead(ctx context.Context, userID string, ids []string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "MarkNotificationsRead", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	_, err := d.Client.ExecContext(
+		ctx,
+		`UPDATE notifications SET read_at = $3
+		 WHERE user_id = $1 AND read_at IS NULL
+		 AND (cardinality($2::uuid[]) = 0 OR id = ANY($2::uuid[]))`,
+		userID,
+		pq.Array(ids),
+		time.Now().UTC(),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to mark notifications read: %w", err)
+	}
+	return nil
+}
+
+type NotificationPreferencesRow struct {
+	UserID          string `db:"user_id"`
+	Mentions        bool
+	Replies         bool
+	Subscriptions   bool
+	Email           string
+	DigestFrequency string       `db:"digest_frequency"`
+	EmailBouncedAt  sql.NullTime `db:"email_bounced_at"`
+	UpdatedAt       time.Time    `db:"updated_at"`
+}
+
+const notificationPreferencesColumns = `user_id, mentions, replies, subscriptions,
+	email, digest_frequency, email_bounced_at, updated_at`
+
+func convertNotificationPreferencesRow(row NotificationPreferencesRow) datastructs.NotificationPreferences {
+	prefs := datastructs.NotificationPreferences{
+		UserID:          row.UserID,
+		Mentions:        row.Mentions,
+		Replies:         row.Replies,
+		Subscriptions:   row.Subscriptions,
+		Email:           row.Email,
+		DigestFrequency: row.DigestFrequency,
+		UpdatedAt:       row.UpdatedAt,
+	}
+	if row.EmailBouncedAt.Valid {
+		prefs.EmailBouncedAt = &row.EmailBouncedAt.Time
+	}
+	return prefs
+}
+
+// GetNotificationPreferences - users who never set
+// preferences get every kind of notification
+func (d *Database) GetNotificationPreferences(ctx context.Context, userID string) (datastructs.NotificationPreferences, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "GetNotificationPreferences", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var row NotificationPreferencesRow
+	err := d.Client.GetContext(
+		ctx,
+		&row,
+		`SELECT `+notificationPreferencesColumns+`
+		 FROM notification_preferences WHERE user_id=$1`,
+		userID,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return datastructs.NotificationPreferences{
+			UserID:          userID,
+			Mentions:        true,
+			Replies:         true,
+			Subscriptions:   true,
+			DigestFrequency: datastructs.DigestOff,
+		}, nil
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.NotificationPreferences{}, fmt.Errorf("failed to fetch notification preferences: %w", err)
+	}
+
+	return convertNotificationPreferencesRow(row), nil
+}
+
+// UpdateNotificationPreferences - a new email address
+// clears the bounce recorded against the old one
+func (d *Database) UpdateNotificationPreferences(
+	ctx context.Context,
+	prefs datastructs.NotificationPreferences,
+) (datastructs.NotificationPreferences, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "UpdateNotificationPreferences", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var row NotificationPreferencesRow
+	err := d.Client.QueryRowxContext(
+		ctx,
+		`INSERT INTO notification_preferences
+		(user_id, mentions, replies, subscriptions, email, digest_frequency, updated_at)
+		VALUES
+		($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id) DO UPDATE SET
+		mentions = EXCLUDED.mentions,
+		replies = EXCLUDED.replies,
+		subscriptions = EXCLUDED.subscriptions,
+		email = EXCLUDED.email,
+		digest_frequency = EXCLUDED.digest_frequency,
+		email_bounced_at = CASE
+			WHEN notification_preferences.email = EXCLUDED.email THEN notification_preferences.email_bounced_at
+		END,
+		updated_at = EXCLUDED.updated_at
+		RETURNING `+notificationPreferencesColumns,
+		prefs.UserID,
+		prefs.Mentions,
+		prefs.Replies,
+		prefs.Subscriptions,
+		prefs.Email,
+		prefs.DigestFrequency,
+		time.Now().UTC(),
+	).StructScan(&row)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.NotificationPreferences{}, fmt.Errorf("failed to update notification preferences: %w", err)
+	}
+	return convertNotificationPreferencesRow(row), nil
+}
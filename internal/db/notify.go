@@ -0,0 +1,261 @@
+package db
+
+// This file in the db package publishes comment events with
+// Postgres NOTIFY and hands them on to servers that LISTEN
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+// EventChannel - the channel comment events are NOTIFYed on
+const EventChannel = "comment_events"
+
+const (
+	// catchUpBatch - how many missed events are read back from the
+	// outbox at once, pages are read until every one is caught up on
+	catchUpBatch = 500
+	// catchUpEvery - how often the outbox is read back for events
+	// whose NOTIFY was missed
+	catchUpEvery = 10 * time.Second
+	// catchUpGrace - how far back from the newest event read back the
+	// next read starts. Outbox rows are written with the writer's clock
+	// and only seen once their transaction commits, so a row can turn
+	// up after newer ones have been read
+	catchUpGrace = time.Minute
+	// seenEvents - how many of the events handed on lately are
+	// remembered, more than are written in catchUpGrace
+	seenEvents = 10000
+	// listenerPingEvery - how long the listener waits for a
+	// NOTIFY before checking its connection is still alive
+	listenerPingEvery = 90 * time.Second
+)
+
+// Publish - NOTIFYs every server LISTENing on EventChannel of the
+// event. NOTIFY payloads are limited to 8000 bytes so only the
+// event's id is sent, listeners read the event from the outbox
+func (d *Database) Publish(ctx context.Context, evt datastructs.Event) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "Publish", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if _, err := d.Client.ExecContext(ctx, `SELECT pg_notify($1, $2)`, EventChannel, evt.ID); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	return nil
+}
+
+// ListenForEvents - LISTENs on EventChannel and hands every event
+// NOTIFYed to handle until the context is cancelled. Outbox ids are
+// handed out when rows are written, not when they are committed, so
+// events are NOTIFYed in no particular order. NOTIFYs can be missed
+// while the connection is down, so the events written lately are
+// read back from the outbox every catchUpEvery and once the connection
+// is back, and those not seen yet are handed on. Each event is handed
+// on once, events handle fails are dropped, they are not redelivered
+func (d *Database) ListenForEvents(ctx context.Context, handle func(context.Context, datastructs.Event) error) error {
+
+	listener := pq.NewListener(d.connectionString, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		switch ev {
+		case pq.ListenerEventDisconnected:
+			log.Printf("event listener disconnected: %v", err)
+		case pq.ListenerEventConnectionAttemptFailed:
+			log.Printf("event listener failed to reconnect: %v", err)
+		case pq.ListenerEventReconnected:
+			log.Print("event listener reconnected")
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(EventChannel); err != nil {
+		return fmt.Errorf("failed to listen for events: %w", err)
+	}
+
+	// Only events written from now on are wanted
+	follower := newEventFollower(d.getOutboxRow, d.listOutboxRows, handle, time.Now().UTC())
+
+	catchUp := time.NewTicker(catchUpEvery)
+	defer catchUp.Stop()
+	ping := time.NewTicker(listenerPingEvery)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			follower.notified(ctx, n)
+		case <-catchUp.C:
+			follower.notified(ctx, nil)
+		case <-ping.C:
+			// Make sure the connection is still alive
+			go listener.Ping()
+		}
+	}
+}
+
+// getOutboxRow - the outbox row of the event
+func (d *Database) getOutboxRow(ctx context.Context, eventID string) (OutboxRow, error) {
+	var row OutboxRow
+	err := d.Client.GetContext(
+		ctx,
+		&row,
+		`SELECT id, event_id, event_type, payload, attempts, created_at
+		 FROM outbox
+		 WHERE event_id = $1`,
+		eventID,
+	)
+	return row, err
+}
+
+// listOutboxRows - up to limit outbox rows written after the row
+// with the id afterID written at since, in the order they were written
+func (d *Database) listOutboxRows(ctx context.Context, since time.Time, afterID int64, limit int) ([]OutboxRow, error) {
+	var rows []OutboxRow
+	err := d.Client.SelectContext(
+		ctx,
+		&rows,
+		`SELECT id, event_id, event_type, payload, attempts, created_at
+		 FROM outbox
+		 WHERE (created_at, id) > ($1, $2)
+		 ORDER BY created_at, id
+		 LIMIT $3`,
+		since,
+		afterID,
+		limit,
+	)
+	return rows, err
+}
+
+// eventFollower - hands NOTIFYed events on once each, reading back
+// from the outbox the events whose NOTIFY was missed
+type eventFollower struct {
+	getEvent   func(ctx context.Context, eventID string) (OutboxRow, error)
+	listEvents func(ctx context.Context, since time.Time, afterID int64, limit int) ([]OutboxRow, error)
+	handle     func(context.Context, datastructs.Event) error
+	// seen - the ids of the events handed on lately, recent holds
+	// them in a ring with next the oldest, to be forgotten first
+	seen   map[string]bool
+	recent []string
+	next   int
+	// newest - when the newest event read back was written, reads
+	// start catchUpGrace before it but never before started
+	newest    time.Time
+	started   time.Time
+	batchSize int
+	grace     time.Duration
+}
+
+func newEventFollower(
+	getEvent func(ctx context.Context, eventID string) (OutboxRow, error),
+	listEvents func(ctx context.Context, since time.Time, afterID int64, limit int) ([]OutboxRow, error),
+	handle func(context.Context, datastructs.Event) error,
+	started time.Time,
+) *eventFollower {
+	return &eventFollower{
+		getEvent:   getEvent,
+		listEvents: listEvents,
+		handle:     handle,
+		seen:       map[string]bool{},
+		recent:     make([]string, seenEvents),
+		newest:     started,
+		started:    started,
+		batchSize:  catchUpBatch,
+		grace:      catchUpGrace,
+	}
+}
+
+// notified - hands on the NOTIFYed event unless it has been already.
+// n is nil once the connection has been re-established and when it is
+// time to check for missed events, then the outbox is read back
+func (f *eventFollower) notified(ctx context.Context, n *pq.Notification) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(ctx, "HandleNotification", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if n == nil {
+		f.catchUp(ctx)
+		return
+	}
+	// Published again after the relay retried it
+	if f.seen[n.Extra] {
+		return
+	}
+
+	row, err := f.getEvent(ctx, n.Extra)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Printf("failed to fetch outbox event %s: %v", n.Extra, err)
+		return
+	}
+	f.handleRow(ctx, row)
+}
+
+// catchUp - hands on the events written since catchUpGrace before the
+// newest one read back that have not been handed on, a page at a time
+func (f *eventFollower) catchUp(ctx context.Context) {
+
+	span := tr.SpanFromContext(ctx)
+
+	since := f.newest.Add(-f.grace)
+	if since.Before(f.started) {
+		since = f.started
+	}
+	var afterID int64
+	for ctx.Err() == nil {
+		rows, err := f.listEvents(ctx, since, afterID, f.batchSize)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			log.Printf("failed to catch up on events: %v", err)
+			return
+		}
+		for _, row := range rows {
+			since, afterID = row.CreatedAt, row.ID
+			if row.CreatedAt.After(f.newest) {
+				f.newest = row.CreatedAt
+			}
+			f.handleRow(ctx, row)
+		}
+		if len(rows) < f.batchSize {
+			return
+		}
+	}
+}
+
+// handleRow - hands the row's event on unless it has been already,
+// whether or not handle takes it the event is not handed on again
+func (f *eventFollower) handleRow(ctx context.Context, row OutboxRow) {
+
+	span := tr.SpanFromContext(ctx)
+
+	if f.seen[row.EventID] {
+		return
+	}
+	delete(f.seen, f.recent[f.next])
+	f.seen[row.EventID] = true
+	f.recent[f.next] = row.EventID
+	f.next = (f.next + 1) % len(f.recent)
+
+	evt, err := convertOutboxRowToEvent(row)
+	if err == nil {
+		err = f.handle(ctx, evt)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+	}
+}
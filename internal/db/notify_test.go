@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeOutbox - outbox rows with ids 1 to n written a second apart
+// from start, all committed but those in pending, read the way the
+// queries do
+type fakeOutbox struct {
+	rows    []OutboxRow
+	pending map[int64]bool
+	pages   int
+}
+
+var start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func newFakeOutbox(n int) *fakeOutbox {
+	o := &fakeOutbox{pending: map[int64]bool{}}
+	for id := int64(1); id <= int64(n); id++ {
+		o.rows = append(o.rows, OutboxRow{
+			ID:        id,
+			EventID:   fmt.Sprintf("e%d", id),
+			EventType: datastructs.EventCommentCreated,
+			Payload:   `{"ID": "c1"}`,
+			CreatedAt: start.Add(time.Duration(id) * time.Second),
+		})
+	}
+	return o
+}
+
+func (o *fakeOutbox) getEvent(ctx context.Context, eventID string) (OutboxRow, error) {
+	for _, row := range o.rows {
+		if row.EventID == eventID && !o.pending[row.ID] {
+			return row, nil
+		}
+	}
+	return OutboxRow{}, sql.ErrNoRows
+}
+
+func (o *fakeOutbox) listEvents(ctx context.Context, since time.Time, afterID int64, limit int) ([]OutboxRow, error) {
+	o.pages++
+	var rows []OutboxRow
+	for _, row := range o.rows {
+		if o.pending[row.ID] || len(rows) == limit {
+			continue
+		}
+		if row.CreatedAt.After(since) || (row.CreatedAt.Equal(since) && row.ID > afterID) {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+func newFollower(o *fakeOutbox, handled *[]string) *eventFollower {
+	f := newEventFollower(o.getEvent, o.listEvents, func(ctx context.Context, evt datastructs.Event) error {
+		*handled = append(*handled, evt.ID)
+		return nil
+	}, start)
+	f.batchSize = 2
+	f.grace = 5 * time.Second
+	return f
+}
+
+func notify(eventID string) *pq.Notification {
+	return &pq.Notification{Extra: eventID}
+}
+
+func TestEventFollower(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("hands on a NOTIFYed event once", func(t *testing.T) {
+		var handled []string
+		f := newFollower(newFakeOutbox(3), &handled)
+
+		f.notified(ctx, notify("e3"))
+		f.notified(ctx, notify("e3"))
+		assert.Equal(t, []string{"e3"}, handled)
+	})
+
+	t.Run("hands on an event committed after a newer one", func(t *testing.T) {
+		var handled []string
+		f := newFollower(newFakeOutbox(3), &handled)
+
+		f.notified(ctx, notify("e3"))
+		f.notified(ctx, notify("e2"))
+		assert.Equal(t, []string{"e3", "e2"}, handled)
+	})
+
+	t.Run("reads back every event whose NOTIFY was missed", func(t *testing.T) {
+		var handled []string
+		outbox := newFakeOutbox(5)
+		f := newFollower(outbox, &handled)
+
+		f.notified(ctx, notify("e2"))
+		f.notified(ctx, nil)
+		assert.Equal(t, []string{"e2", "e1", "e3", "e4", "e5"}, handled)
+		// Pages of two until one comes back short
+		assert.Equal(t, 3, outbox.pages)
+	})
+
+	t.Run("reads back an event committed late within the grace window", func(t *testing.T) {
+		var handled []string
+		outbox := newFakeOutbox(12)
+		outbox.pending[8] = true
+		f := newFollower(outbox, &handled)
+
+		f.notified(ctx, nil)
+		assert.NotContains(t, handled, "e8")
+		assert.Len(t, handled, 11)
+
+		// Committed once 12 had been read back, 4s before it
+		delete(outbox.pending, 8)
+		handled = nil
+		f.notified(ctx, nil)
+		assert.Equal(t, []string{"e8"}, handled)
+
+		// And only handed on the once
+		handled = nil
+		f.notified(ctx, nil)
+		assert.Empty(t, handled)
+	})
+
+	t.Run("does not read back events written before it started", func(t *testing.T) {
+		var handled []string
+		outbox := newFakeOutbox(3)
+		f := newFollower(outbox, &handled)
+		f.started = start.Add(2500 * time.Millisecond)
+		f.newest = f.started
+
+		f.notified(ctx, nil)
+		assert.Equal(t, []string{"e3"}, handled)
+	})
+
+	t.Run("remembers only the latest events", func(t *testing.T) {
+		var handled []string
+		f := newFollower(newFakeOutbox(3), &handled)
+		f.recent = make([]string, 2)
+
+		f.notified(ctx, notify("e1"))
+		f.notified(ctx, notify("e2"))
+		f.notified(ctx, notify("e3"))
+		assert.Equal(t, map[string]bool{"e2": true, "e3": true}, f.seen)
+	})
+
+	t.Run("an event that can not be fetched is skipped", func(t *testing.T) {
+		var handled []string
+		f := newFollower(newFakeOutbox(3), &handled)
+
+		f.notified(ctx, notify("missing"))
+		assert.Empty(t, handled)
+	})
+}
@@ -0,0 +1,295 @@
+package db
+
+// This file in the db package keeps the outbox of comment events,
+// each written in the same transaction as the change it describes
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+// outboxLockKey - the advisory lock held while claiming events,
+// only one relay at a time holds events so they stay in order
+const outboxLockKey = 7013570
+
+type OutboxRow struct {
+	ID        int64
+	EventID   string `db:"event_id"`
+	EventType string `db:"event_type"`
+	Payload   string
+	Attempts  int
+	CreatedAt time.Time `db:"created_at"`
+	// DeliveredTo - the listeners that have handled the event
+	DeliveredTo pq.StringArray `db:"delivered_to"`
+}
+
+func convertOutboxRowToEvent(o OutboxRow) (datastructs.Event, error) {
+	var cmt datastructs.Comment
+	if err := json.Unmarshal([]byte(o.Payload), &cmt); err != nil {
+		return datastructs.Event{}, fmt.Errorf("failed to decode outbox event %d: %w", o.ID, err)
+	}
+	return datastructs.Event{
+		ID:         o.EventID,
+		Type:       o.EventType,
+		Comment:    cmt,
+		OccurredAt: o.CreatedAt,
+	}, nil
+}
+
+// insertOutboxEvent - records the event in the caller's transaction,
+// it is only relayed if the change it describes is committed
+func insertOutboxEvent(ctx context.Context, tx *sqlx.Tx, eventType string, cmt datastructs.Comment) error {
+	payload, err := json.Marshal(cmt)
+	if err != nil {
+		return fmt.Errorf("failed to encode outbox event: %w", err)
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO outbox (event_id, event_type, payload, created_at)
+		 VALUES ($1, $2, $3, $4)`,
+		uuid.NewV4().String(),
+		eventType,
+		string(payload),
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write outbox event: %w", err)
+	}
+	return nil
+}
+
+// OutboxPosition - the id of the latest event written to the outbox,
+// zero when there are none. It is read from the id sequence, so it
+// does not go back when the latest events are pruned
+func (d *Database) OutboxPosition(ctx context.Context) (int64, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "OutboxPosition", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var position int64
+	err := d.Client.GetContext(
+		ctx,
+		&position,
+		`SELECT CASE WHEN is_called THEN last_value ELSE 0 END
+		 FROM outbox_id_seq`,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, fmt.Errorf("failed to read the outbox position: %w", err)
+	}
+	return position, nil
+}
+
+// ClaimOutboxEvents - leases up to limit undispatched events to the
+// caller until the lease runs out, in id order, stopping at the first
+// event whose next attempt is not due yet. Only one relay holds events
+// at a time and nothing is returned while another relay's lease is
+// live. Ids are handed out when rows are written rather than when they
+// commit, so an event can be handed out after later ones. Events about
+// the same comment are written holding its row lock, so those are
+// always handed out in the order they happened.
+// The claim is its own short transaction, the caller dispatches the
+// events outside of it and reports back with CompleteOutboxEvent
+func (d *Database) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]datastructs.OutboxEvent, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ClaimOutboxEvents", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Claims are made one at a time so two relays never both see no lease
+	var locked bool
+	if err := tx.GetContext(ctx, &locked, `SELECT pg_try_advisory_xact_lock($1)`, outboxLockKey); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to lock outbox: %w", err)
+	}
+	if !locked {
+		return nil, nil
+	}
+
+	var leased bool
+	err = tx.GetContext(
+		ctx,
+		&leased,
+		`SELECT EXISTS (SELECT 1 FROM outbox WHERE dispatched_at IS NULL AND claimed_until > now())`,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to read outbox claims: %w", err)
+	}
+	if leased {
+		return nil, nil
+	}
+
+	var rows []OutboxRow
+	err = tx.SelectContext(
+		ctx,
+		&rows,
+		`UPDATE outbox SET claimed_until = $2
+		 WHERE id IN (
+			SELECT id FROM outbox
+			WHERE dispatched_at IS NULL AND id < COALESCE(
+				(SELECT MIN(id) FROM outbox WHERE dispatched_at IS NULL AND next_attempt_at > now()),
+				9223372036854775807
+			)
+			ORDER BY id
+			LIMIT $1
+		 )
+		 RETURNING id, event_id, event_type, payload, attempts, created_at, delivered_to`,
+		limit,
+		time.Now().UTC().Add(lease),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+
+	// RETURNING does not keep the order of the subquery
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+
+	var evts []datastructs.OutboxEvent
+	for _, row := range rows {
+		evt, err := convertOutboxRowToEvent(row)
+		if err != nil {
+			// Nothing can decode it so no listener can have it, it is
+			// set aside with the error rather than holding up the rest
+			span.RecordError(err)
+			log.Printf("giving up on outbox event %s: %v", row.EventID, err)
+			_, err = tx.ExecContext(
+				ctx,
+				`UPDATE outbox SET dispatched_at = $2, last_error = $3, claimed_until = NULL WHERE id = $1`,
+				row.ID,
+				time.Now().UTC(),
+				err.Error(),
+			)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return nil, fmt.Errorf("failed to set aside outbox event: %w", err)
+			}
+			continue
+		}
+		evts = append(evts, datastructs.OutboxEvent{
+			Event:     evt,
+			Attempts:  row.Attempts,
+			Delivered: row.DeliveredTo,
+		})
+	}
+
+	if err := tx.Commit(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+	return evts, nil
+}
+
+// CompleteOutboxEvent - records what came of relaying a claimed event
+// and ends its claim. Done events are marked dispatched, the listeners
+// given up on are recorded on the event until it is pruned. The others
+// are not claimed again before their next attempt is due
+func (d *Database) CompleteOutboxEvent(ctx context.Context, res datastructs.OutboxResult) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "CompleteOutboxEvent", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var dispatchedAt, nextAttemptAt sql.NullTime
+	if res.Done {
+		dispatchedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	} else if !res.NextAttemptAt.IsZero() {
+		nextAttemptAt = sql.NullTime{Time: res.NextAttemptAt.UTC(), Valid: true}
+	}
+
+	_, err := d.Client.ExecContext(
+		ctx,
+		`UPDATE outbox SET
+			attempts = attempts + 1,
+			delivered_to = delivered_to || $2::text[],
+			failed_to = failed_to || $3::text[],
+			last_error = $4,
+			dispatched_at = $5,
+			next_attempt_at = $6,
+			claimed_until = NULL
+		 WHERE event_id = $1`,
+		res.EventID,
+		pq.StringArray(res.Delivered),
+		pq.StringArray(res.GivenUp),
+		res.Error,
+		dispatchedAt,
+		nextAttemptAt,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to record outbox event: %w", err)
+	}
+	return nil
+}
+
+// ReleaseOutboxEvents - ends the claim on events that were not relayed,
+// so the next relay can claim them without waiting for the lease to run out
+func (d *Database) ReleaseOutboxEvents(ctx context.Context, eventIDs []string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ReleaseOutboxEvents", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	_, err := d.Client.ExecContext(
+		ctx,
+		`UPDATE outbox SET claimed_until = NULL WHERE event_id = ANY($1)`,
+		pq.StringArray(eventIDs),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to release outbox events: %w", err)
+	}
+	return nil
+}
+
+// PruneOutbox - deletes events dispatched before the given time,
+// along with the record of any listener given up on for them
+func (d *Database) PruneOutbox(ctx context.Context, before time.Time) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "PruneOutbox", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	_, err := d.Client.ExecContext(
+		ctx,
+		`DELETE FROM outbox WHERE dispatched_at < $1`,
+		before,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to prune outbox: %w", err)
+	}
+	return nil
+}
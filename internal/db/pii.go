@@ -0,0 +1,85 @@
+package db
+
+// This file in the db package stores what each site wants
+// done with comments containing personal information
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/imraan1901/comment-section-rest-api/internal/processor"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type PIISettingsRow struct {
+	Site      string
+	Mode      string
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// GetPIISettings - sites that were never configured redact
+func (d *Database) GetPIISettings(ctx context.Context, site string) (datastructs.PIISettings, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "GetPIISettings", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var row PIISettingsRow
+	err := d.Client.GetContext(
+		ctx,
+		&row,
+		`SELECT site, mode, updated_at FROM pii_settings WHERE site=$1`,
+		site,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return datastructs.PIISettings{Site: site, Mode: processor.PIIModeRedact}, nil
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.PIISettings{}, fmt.Errorf("failed to fetch pii settings: %w", err)
+	}
+
+	return datastructs.PIISettings{
+		Site:      row.Site,
+		Mode:      row.Mode,
+		UpdatedAt: row.UpdatedAt,
+	}, nil
+}
+
+func (d *Database) UpdatePIISettings(ctx context.Context, settings datastructs.PIISettings) (datastructs.PIISettings, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "UpdatePIISettings", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	settings.UpdatedAt = time.Now().UTC()
+	row := PIISettingsRow{
+		Site:      settings.Site,
+		Mode:      settings.Mode,
+		UpdatedAt: settings.UpdatedAt,
+	}
+	_, err := d.Client.NamedExecContext(
+		ctx,
+		`INSERT INTO pii_settings
+		(site, mode, updated_at)
+		VALUES
+		(:site, :mode, :updated_at)
+		ON CONFLICT (site) DO UPDATE SET
+		mode = EXCLUDED.mode,
+		updated_at = EXCLUDED.updated_at`,
+		row,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.PIISettings{}, fmt.Errorf("failed to update pii settings: %w", err)
+	}
+	return settings, nil
+}
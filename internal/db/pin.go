@@ -0,0 +1,156 @@
+package db
+
+// This file in the db package stores which comments
+// editors have pinned or picked as featured
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+// ListPinnedComments - the approved pinned comments on a slug in pin order
+func (d *Database) ListPinnedComments(ctx context.Context, slug string) ([]datastructs.Comment, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListPinnedComments", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	rows, err := d.Client.QueryContext(
+		ctx,
+		`SELECT `+commentColumns+`
+		 FROM comments
+		 WHERE slug = $1 AND moderation_status = $2
+		 AND pin_position IS NOT NULL
+		 ORDER BY pin_position, created_at`,
+		slug,
+		datastructs.ModerationApproved,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to list pinned comments: %w", err)
+	}
+	defer rows.Close()
+
+	cmts := []datastructs.Comment{}
+	for rows.Next() {
+		cmtRow, err := scanCommentRow(rows)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		cmts = append(cmts, convertCommentRowToComment(cmtRow))
+	}
+	return cmts, rows.Err()
+}
+
+// ListPinnedCommentsOn - the approved pinned comments on each
+// of the slugs, a slug's in pin order
+func (d *Database) ListPinnedCommentsOn(ctx context.Context, slugs []string) ([]datastructs.Comment, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListPinnedCommentsOn", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	rows, err := d.Client.QueryContext(
+		ctx,
+		`SELECT `+commentColumns+`
+		 FROM comments
+		 WHERE slug = ANY($1) AND moderation_status = $2
+		 AND pin_position IS NOT NULL
+		 ORDER BY slug, pin_position, created_at`,
+		pq.Array(slugs),
+		datastructs.ModerationApproved,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to list pinned comments: %w", err)
+	}
+	return scanComments(rows)
+}
+
+// PinComment - pins the comment at the position, a position
+// of zero puts it after every comment already pinned on its slug
+func (d *Database) PinComment(ctx context.Context, id string, position int) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "PinComment", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	res, err := d.Client.ExecContext(
+		ctx,
+		`UPDATE comments c SET pin_position = CASE WHEN $2 > 0 THEN $2 ELSE
+			(SELECT COALESCE(MAX(p.pin_position), 0) + 1 FROM comments p
+			 WHERE p.slug = c.slug AND p.id <> c.id) END
+		 WHERE c.id = $1`,
+		id,
+		position,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to pin comment: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		span.SetStatus(codes.Error, sql.ErrNoRows.Error())
+		return fmt.Errorf("failed to pin comment: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+func (d *Database) UnpinComment(ctx context.Context, id string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "UnpinComment", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	res, err := d.Client.ExecContext(
+		ctx,
+		`UPDATE comments SET pin_position = NULL WHERE id = $1`,
+		id,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to unpin comment: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		span.SetStatus(codes.Error, sql.ErrNoRows.Error())
+		return fmt.Errorf("failed to unpin comment: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+func (d *Database) SetFeatured(ctx context.Context, id string, featured bool) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "SetFeatured", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	res, err := d.Client.ExecContext(
+		ctx,
+		`UPDATE comments SET featured = $2 WHERE id = $1`,
+		id,
+		featured,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to set featured: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		span.SetStatus(codes.Error, sql.ErrNoRows.Error())
+		return fmt.Errorf("failed to set featured: %w", sql.ErrNoRows)
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package db
+
+// This file in the db package stores the votes and
+// emoji reactions users leave on comments
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/imraan1901/comment-section-rest-api/internal/ranking"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+// opposingVote - the vote a new vote replaces, empty for other reactions
+func opposingVote(reaction string) string {
+	switch reaction {
+	case datastructs.ReactionUpvote:
+		return datastructs.ReactionDownvote
+	case datastructs.ReactionDownvote:
+		return datastructs.ReactionUpvote
+	}
+	return ""
+}
+
+// isVote - whether the reaction counts towards the vote scores
+func isVote(reaction string) bool {
+	return reaction == datastructs.ReactionUpvote || reaction == datastructs.ReactionDownvote
+}
+
+// lockForVote - locks the comment's row for the rest of the transaction,
+// taken before its reactions are touched so a vote's changes and the
+// recount after them are not interleaved with another vote's
+func lockForVote(ctx context.Context, tx *sqlx.Tx, commentID string) error {
+	_, err := tx.ExecContext(ctx, `SELECT 1 FROM comments WHERE id = $1 FOR UPDATE`, commentID)
+	if err != nil {
+		return fmt.Errorf("failed to lock comment: %w", err)
+	}
+	return nil
+}
+
+// updateVoteScores - recounts the comment's votes and stores the scores
+// the listing sorts use, lockForVote must have been called first
+func updateVoteScores(ctx context.Context, tx *sqlx.Tx, commentID string) error {
+	var ups, downs int
+	err := tx.QueryRowContext(
+		ctx,
+		`SELECT
+			(SELECT COUNT(*) FROM comment_reactions WHERE comment_id = c.id AND reaction = $2),
+			(SELECT COUNT(*) FROM comment_reactions WHERE comment_id = c.id AND reaction = $3)
+		 FROM comments c
+		 WHERE c.id = $1`,
+		commentID,
+		datastructs.ReactionUpvote,
+		datastructs.ReactionDownvote,
+	).Scan(&ups, &downs)
+	if err != nil {
+		return fmt.Errorf("failed to count votes: %w", err)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`UPDATE comments SET
+		upvotes = $2,
+		downvotes = $3,
+		score = $4,
+		wilson_score = $5,
+		controversy = $6
+		WHERE id = $1`,
+		commentID,
+		ups,
+		downs,
+		ranking.Score(ups, downs),
+		ranking.WilsonScore(ups, downs),
+		ranking.Controversy(ups, downs),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update vote scores: %w", err)
+	}
+	return nil
+}
+
+// AddReaction - does nothing if the user already reacted this way,
+// an up vote replaces a down vote and the other way round
+func (d *Database) AddReaction(ctx context.Context, commentID string, userID string, reaction string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "AddReaction", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if isVote(reaction) {
+		if err := lockForVote(ctx, tx, commentID); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+	}
+
+	if opposite := opposingVote(reaction); opposite != "" {
+		_, err := tx.ExecContext(
+			ctx,
+			`DELETE FROM comment_reactions
+			 WHERE comment_id = $1 AND user_id = $2 AND reaction = $3`,
+			commentID,
+			userID,
+			opposite,
+		)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return fmt.Errorf("failed to remove opposing vote: %w", err)
+		}
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO comment_reactions
+		(comment_id, user_id, reaction, created_at)
+		VALUES
+		($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING`,
+		commentID,
+		userID,
+		reaction,
+		time.Now().UTC(),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to add reaction: %w", err)
+	}
+
+	if isVote(reaction) {
+		if err := updateVoteScores(ctx, tx, commentID); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to add reaction: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) RemoveReaction(ctx context.Context, commentID string, userID string, reaction string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "RemoveReaction", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if isVote(reaction) {
+		if err := lockForVote(ctx, tx, commentID); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`DELETE FROM comment_reactions
+		 WHERE comment_id = $1 AND user_id = $2 AND reaction = $3`,
+		commentID,
+		userID,
+		reaction,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to remove reaction: %w", err)
+	}
+
+	if isVote(reaction) {
+		if err := updateVoteScores(ctx, tx, commentID); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to remove reaction: %w", err)
+	}
+	return nil
+}
+
+// GetReactionCounts - reaction counts keyed by comment id then reaction
+func (d *Database) GetReactionCounts(ctx context.Context, commentIDs []string) (map[string]map[string]int, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "GetReactionCounts", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	rows, err := d.Client.QueryContext(
+		ctx,
+		`SELECT comment_id, reaction, COUNT(*)
+		 FROM comment_reactions
+		 WHERE comment_id = ANY($1)
+		 GROUP BY comment_id, reaction`,
+		pq.Array(commentIDs),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to count reactions: %w", err)
+	}
+	defer rows.Close()
+
+	counts := map[string]map[string]int{}
+	for rows.Next() {
+		var commentID, reaction string
+		var count int
+		if err := rows.Scan(&commentID, &reaction, &count); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, fmt.Errorf("failed to scan reaction count: %w", err)
+		}
+		if counts[commentID] == nil {
+			counts[commentID] = map[string]int{}
+		}
+		counts[commentID][reaction] = count
+	}
+	return counts, rows.Err()
+}
+
+// GetUserReactions - the user's reactions keyed by comment id
+func (d *Database) GetUserReactions(ctx context.Context, commentIDs []string, userID string) (map[string][]string, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "GetUserReactions", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	rows, err := d.Client.QueryContext(
+		ctx,
+		`SELECT comment_id, reaction
+		 FROM comment_reactions
+		 WHERE comment_id = ANY($1) AND user_id = $2
+		 ORDER BY created_at`,
+		pq.Array(commentIDs),
+		userID,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to fetch user reactions: %w", err)
+	}
+	defer rows.Close()
+
+	mine := map[string][]string{}
+	for rows.Next() {
+		var commentID, reaction string
+		if err := rows.Scan(&commentID, &reaction); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, fmt.Errorf("failed to scan user reaction: %w", err)
+		}
+		mine[commentID] = append(mine[commentID], reaction)
+	}
+	return mine, rows.Err()
+}
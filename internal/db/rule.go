@@ -0,0 +1,236 @@
+package db
+
+// This file in the db package stores the auto-moderation
+// rules used by the processor
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	uuid "github.com/satori/go.uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type RuleRow struct {
+	ID         string
+	Name       string
+	Conditions []byte
+	Action     string
+	Enabled    bool
+	Hits       int64
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+const ruleColumns = `id, name, conditions, action, enabled, hits, created_at`
+
+func convertRuleRowToRule(r RuleRow) (datastructs.Rule, error) {
+	var conditions []datastructs.RuleCondition
+	if err := json.Unmarshal(r.Conditions, &conditions); err != nil {
+		return datastructs.Rule{}, fmt.Errorf("failed to decode rule conditions: %w", err)
+	}
+	return datastructs.Rule{
+		ID:         r.ID,
+		Name:       r.Name,
+		Conditions: conditions,
+		Action:     r.Action,
+		Enabled:    r.Enabled,
+		Hits:       r.Hits,
+		CreatedAt:  r.CreatedAt,
+	}, nil
+}
+
+func convertRuleToRuleRow(id string, rule datastructs.Rule) (RuleRow, error) {
+	conditions, err := json.Marshal(rule.Conditions)
+	if err != nil {
+		return RuleRow{}, fmt.Errorf("failed to encode rule conditions: %w", err)
+	}
+	return RuleRow{
+		ID:         id,
+		Name:       rule.Name,
+		Conditions: conditions,
+		Action:     rule.Action,
+		Enabled:    rule.Enabled,
+		CreatedAt:  rule.CreatedAt,
+	}, nil
+}
+
+func (d *Database) queryRules(ctx context.Context, query string, args ...any) ([]datastructs.Rule, error) {
+	var ruleRows []RuleRow
+	if err := d.Client.SelectContext(ctx, &ruleRows, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to fetch rules: %w", err)
+	}
+
+	rules := []datastructs.Rule{}
+	for _, r := range ruleRows {
+		rule, err := convertRuleRowToRule(r)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (d *Database) GetRule(ctx context.Context, id string) (datastructs.Rule, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "GetRule", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var ruleRow RuleRow
+	err := d.Client.GetContext(
+		ctx,
+		&ruleRow,
+		`SELECT `+ruleColumns+` FROM rules WHERE id=$1`,
+		id,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Rule{}, fmt.Errorf("error fetching rule by uuid: %w", err)
+	}
+
+	return convertRuleRowToRule(ruleRow)
+}
+
+func (d *Database) ListRules(ctx context.Context) ([]datastructs.Rule, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListRules", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	rules, err := d.queryRules(ctx, `SELECT `+ruleColumns+` FROM rules ORDER BY created_at`)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	return rules, nil
+}
+
+// GetEnabledRules - the rules the processor should apply
+func (d *Database) GetEnabledRules(ctx context.Context) ([]datastructs.Rule, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "GetEnabledRules", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	rules, err := d.queryRules(ctx, `SELECT `+ruleColumns+` FROM rules WHERE enabled ORDER BY created_at`)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (d *Database) PostRule(ctx context.Context, rule datastructs.Rule) (datastructs.Rule, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "PostRule", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	rule.ID = uuid.NewV4().String()
+	rule.CreatedAt = time.Now().UTC()
+	rule.Hits = 0
+
+	ruleRow, err := convertRuleToRuleRow(rule.ID, rule)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Rule{}, err
+	}
+
+	_, err = d.Client.NamedExecContext(
+		ctx,
+		`INSERT INTO rules
+		(id, name, conditions, action, enabled, created_at)
+		VALUES
+		(:id, :name, :conditions, :action, :enabled, :created_at)`,
+		ruleRow,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Rule{}, fmt.Errorf("failed to insert rule: %w", err)
+	}
+
+	return rule, nil
+}
+
+func (d *Database) UpdateRule(ctx context.Context, id string, rule datastructs.Rule) (datastructs.Rule, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "UpdateRule", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	ruleRow, err := convertRuleToRuleRow(id, rule)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Rule{}, err
+	}
+
+	res, err := d.Client.NamedExecContext(
+		ctx,
+		`UPDATE rules SET
+		name = :name,
+		conditions = :conditions,
+		action = :action,
+		enabled = :enabled
+		WHERE id = :id`,
+		ruleRow,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Rule{}, fmt.Errorf("failed to update rule: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		span.SetStatus(codes.Error, sql.ErrNoRows.Error())
+		return datastructs.Rule{}, fmt.Errorf("failed to update rule: %w", sql.ErrNoRows)
+	}
+
+	return d.GetRule(ctx, id)
+}
+
+func (d *Database) DeleteRule(ctx context.Context, id string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "DeleteRule", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	res, err := d.Client.ExecContext(ctx, `DELETE FROM rules WHERE id=$1`, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to delete rule from database: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		span.SetStatus(codes.Error, sql.ErrNoRows.Error())
+		return fmt.Errorf("failed to delete rule from database: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// IncrementRuleHits - counts one more comment matched by the rule
+func (d *Database) IncrementRuleHits(ctx context.Context, id string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "IncrementRuleHits", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	_, err := d.Client.ExecContext(ctx, `UPDATE rules SET hits = hits + 1 WHERE id=$1`, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to increment rule hits: %w", err)
+	}
+	return nil
+}
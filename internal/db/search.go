@@ -0,0 +1,98 @@
+package db
+
+// This file in the db package runs full text searches
+// over the search_vector column of comments
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+// ts_headline marks matches with these, they are stripped from the
+// body it is given so the only ones in a snippet are its own and it
+// can be escaped before they are swapped for <mark>
+const (
+	headlineStart = "\x02"
+	headlineStop  = "\x03"
+)
+
+// SearchComments - ranks comments matching the query, websearch syntax
+// means "quoted phrases", OR and -excluded words all work
+func (d *Database) SearchComments(ctx context.Context, q datastructs.SearchQuery) (datastructs.SearchResults, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "SearchComments", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	rows, err := d.Client.QueryContext(
+		ctx,
+		`WITH q AS (SELECT websearch_to_tsquery('english', $1) AS query)
+		 SELECT `+prefixColumns("c", commentColumns)+`,
+			ts_rank_cd(c.search_vector, q.query) AS rank,
+			ts_headline('english', translate(coalesce(c.processed_body, c.body, ''), $5, ''), q.query,
+				'StartSel=`+headlineStart+`, StopSel=`+headlineStop+`, MaxFragments=2, MaxWords=30, MinWords=10'),
+			COUNT(*) OVER () AS total
+		 FROM comments c, q
+		 WHERE c.search_vector @@ q.query
+		 AND ($2 = '' OR c.slug = $2)
+		 ORDER BY rank DESC, c.created_at DESC
+		 LIMIT $3 OFFSET $4`,
+		q.Query,
+		q.Slug,
+		q.Limit,
+		q.Offset,
+		headlineStart+headlineStop,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.SearchResults{}, fmt.Errorf("failed to search comments: %w", err)
+	}
+	defer rows.Close()
+
+	results := datastructs.SearchResults{Results: []datastructs.SearchResult{}}
+	for rows.Next() {
+		var result datastructs.SearchResult
+		var snippet string
+		cmtRow, err := scanCommentRow(rows, &result.Rank, &snippet, &results.Total)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return datastructs.SearchResults{}, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		result.Comment = convertCommentRowToComment(cmtRow)
+		result.Snippet = highlightSnippet(snippet)
+		results.Results = append(results.Results, result)
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.SearchResults{}, fmt.Errorf("failed to search comments: %w", err)
+	}
+	return results, nil
+}
+
+// highlightSnippet - escapes the snippet and swaps the
+// ts_headline markers for <mark> tags
+func highlightSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, headlineStart, "<mark>")
+	return strings.ReplaceAll(escaped, headlineStop, "</mark>")
+}
+
+// prefixColumns - qualifies a comma separated column list with a table alias
+func prefixColumns(alias string, columns string) string {
+	parts := strings.Split(columns, ",")
+	for i, p := range parts {
+		parts[i] = alias + "." + strings.TrimSpace(p)
+	}
+	return strings.Join(parts, ", ")
+}
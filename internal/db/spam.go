@@ -0,0 +1,149 @@
+package db
+
+// This file in the db package stores the training data
+// and trained models of the spam classifier
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/imraan1901/comment-section-rest-api/internal/processor"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type TrainingExampleRow struct {
+	CommentID string    `db:"comment_id"`
+	Body      string    `db:"body"`
+	IsSpam    bool      `db:"is_spam"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// SaveTrainingExample - a later decision on the same
+// comment replaces the earlier one
+func (d *Database) SaveTrainingExample(ctx context.Context, ex datastructs.TrainingExample) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "SaveTrainingExample", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	row := TrainingExampleRow{
+		CommentID: ex.CommentID,
+		Body:      ex.Body,
+		IsSpam:    ex.IsSpam,
+		CreatedAt: time.Now().UTC(),
+	}
+	_, err := d.Client.NamedExecContext(
+		ctx,
+		`INSERT INTO spam_training
+		(comment_id, body, is_spam, created_at)
+		VALUES
+		(:comment_id, :body, :is_spam, :created_at)
+		ON CONFLICT (comment_id) DO UPDATE SET
+		body = EXCLUDED.body,
+		is_spam = EXCLUDED.is_spam,
+		created_at = EXCLUDED.created_at`,
+		row,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to save training example: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) ListTrainingExamples(ctx context.Context) ([]datastructs.TrainingExample, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListTrainingExamples", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var rows []TrainingExampleRow
+	err := d.Client.SelectContext(
+		ctx,
+		&rows,
+		`SELECT comment_id, body, is_spam, created_at FROM spam_training`,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to list training examples: %w", err)
+	}
+
+	examples := make([]datastructs.TrainingExample, 0, len(rows))
+	for _, r := range rows {
+		examples = append(examples, datastructs.TrainingExample{
+			CommentID: r.CommentID,
+			Body:      r.Body,
+			IsSpam:    r.IsSpam,
+			CreatedAt: r.CreatedAt,
+		})
+	}
+	return examples, nil
+}
+
+// SaveSpamModel - stores a new version of the model,
+// older versions are kept so a bad import can be rolled back
+func (d *Database) SaveSpamModel(ctx context.Context, model processor.SpamModel) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "SaveSpamModel", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	encoded, err := json.Marshal(model)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to encode spam model: %w", err)
+	}
+
+	_, err = d.Client.ExecContext(
+		ctx,
+		`INSERT INTO spam_models (model, created_at) VALUES ($1, $2)`,
+		encoded,
+		time.Now().UTC(),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to save spam model: %w", err)
+	}
+	return nil
+}
+
+// GetLatestSpamModel - returns false when no model has been saved yet
+func (d *Database) GetLatestSpamModel(ctx context.Context) (processor.SpamModel, bool, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "GetLatestSpamModel", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var encoded []byte
+	err := d.Client.QueryRowContext(
+		ctx,
+		`SELECT model FROM spam_models ORDER BY id DESC LIMIT 1`,
+	).Scan(&encoded)
+	if errors.Is(err, sql.ErrNoRows) {
+		return processor.SpamModel{}, false, nil
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return processor.SpamModel{}, false, fmt.Errorf("failed to fetch spam model: %w", err)
+	}
+
+	var model processor.SpamModel
+	if err := json.Unmarshal(encoded, &model); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return processor.SpamModel{}, false, fmt.Errorf("failed to decode spam model: %w", err)
+	}
+	return model, true, nil
+}
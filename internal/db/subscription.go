@@ -0,0 +1,195 @@
+package db
+
+// This file in the db package stores who follows
+// which slugs and comment threads
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	uuid "github.com/satori/go.uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type SubscriptionRow struct {
+	ID               string
+	UserID           string `db:"user_id"`
+	Slug             string
+	CommentID        sql.NullString `db:"comment_id"`
+	UnsubscribeToken string         `db:"unsubscribe_token"`
+	CreatedAt        time.Time      `db:"created_at"`
+}
+
+const subscriptionColumns = `id, user_id, slug, comment_id, unsubscribe_token, created_at`
+
+func convertSubscriptionRowToSubscription(s SubscriptionRow) datastructs.Subscription {
+	return datastructs.Subscription{
+		ID:               s.ID,
+		UserID:           s.UserID,
+		Slug:             s.Slug,
+		CommentID:        s.CommentID.String,
+		UnsubscribeToken: s.UnsubscribeToken,
+		CreatedAt:        s.CreatedAt,
+	}
+}
+
+// Subscribe - stores the subscription, subscribing to the same
+// thing twice hands back the subscription that already exists
+func (d *Database) Subscribe(ctx context.Context, sub datastructs.Subscription) (datastructs.Subscription, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "Subscribe", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var row SubscriptionRow
+	err := d.Client.GetContext(
+		ctx,
+		&row,
+		`INSERT INTO subscriptions
+		(id, user_id, slug, comment_id, unsubscribe_token, created_at)
+		VALUES
+		($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, slug, (COALESCE(comment_id, '00000000-0000-0000-0000-000000000000'::uuid)))
+		DO UPDATE SET user_id = EXCLUDED.user_id
+		RETURNING `+subscriptionColumns,
+		uuid.NewV4().String(),
+		sub.UserID,
+		sub.Slug,
+		sql.NullString{String: sub.CommentID, Valid: sub.CommentID != ""},
+		sub.UnsubscribeToken,
+		time.Now().UTC(),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Subscription{}, fmt.Errorf("failed to subscribe: %w", err)
+	}
+	return convertSubscriptionRowToSubscription(row), nil
+}
+
+func (d *Database) ListSubscriptions(ctx context.Context, userID string) ([]datastructs.Subscription, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListSubscriptions", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var rows []SubscriptionRow
+	err := d.Client.SelectContext(
+		ctx,
+		&rows,
+		`SELECT `+subscriptionColumns+`
+		 FROM subscriptions
+		 WHERE user_id = $1
+		 ORDER BY created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+
+	subs := make([]datastructs.Subscription, 0, len(rows))
+	for _, row := range rows {
+		subs = append(subs, convertSubscriptionRowToSubscription(row))
+	}
+	return subs, nil
+}
+
+// DeleteSubscription - only deletes the subscription if it is the user's
+func (d *Database) DeleteSubscription(ctx context.Context, userID string, id string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "DeleteSubscription", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	res, err := d.Client.ExecContext(
+		ctx,
+		`DELETE FROM subscriptions WHERE id = $1 AND user_id = $2`,
+		id,
+		userID,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		span.SetStatus(codes.Error, sql.ErrNoRows.Error())
+		return fmt.Errorf("failed to delete subscription: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+func (d *Database) DeleteSubscriptionByToken(ctx context.Context, token string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "DeleteSubscriptionByToken", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	res, err := d.Client.ExecContext(
+		ctx,
+		`DELETE FROM subscriptions WHERE unsubscribe_token = $1`,
+		token,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to unsubscribe: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		span.SetStatus(codes.Error, sql.ErrNoRows.Error())
+		return fmt.Errorf("failed to unsubscribe: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// ListSubscribers - a subscription per user following the comment's slug
+// or any comment above it in its thread, the most specific one when a
+// user follows several. Users who turned subscription notifications
+// off are left out
+func (d *Database) ListSubscribers(ctx context.Context, cmt datastructs.Comment) ([]datastructs.Subscription, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListSubscribers", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var rows []SubscriptionRow
+	err := d.Client.SelectContext(
+		ctx,
+		&rows,
+		`WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id, 1 AS depth FROM comments WHERE id = $2
+			UNION
+			SELECT c.id, c.parent_id, a.depth + 1 FROM comments c
+			JOIN ancestors a ON c.id = a.parent_id
+			WHERE a.depth < 100
+		 )
+		 SELECT DISTINCT ON (s.user_id) `+prefixColumns("s", subscriptionColumns)+`
+		 FROM subscriptions s
+		 LEFT JOIN ancestors a ON a.id = s.comment_id
+		 LEFT JOIN notification_preferences p ON p.user_id = s.user_id
+		 WHERE s.slug = $1
+		 AND (s.comment_id IS NULL OR a.id IS NOT NULL)
+		 AND COALESCE(p.subscriptions, true)
+		 ORDER BY s.user_id, a.depth NULLS LAST`,
+		cmt.Slug,
+		sql.NullString{String: cmt.ParentID, Valid: cmt.ParentID != ""},
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to list subscribers: %w", err)
+	}
+
+	subs := make([]datastructs.Subscription, 0, len(rows))
+	for _, row := range rows {
+		subs = append(subs, convertSubscriptionRowToSubscription(row))
+	}
+	return subs, nil
+}
@@ -0,0 +1,214 @@
+package db
+
+// This file in the db package stores the settings
+// of the comment thread on each slug
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type ThreadRow struct {
+	Slug             string
+	State            string
+	MaxLength        int    `db:"max_length"`
+	ModerationMode   string `db:"moderation_mode"`
+	Kind             string
+	Owner            sql.NullString
+	AcceptedAnswerID sql.NullString `db:"accepted_answer_id"`
+	UpdatedAt        time.Time      `db:"updated_at"`
+}
+
+// threadColumns - the columns every thread query selects
+const threadColumns = `slug, state, max_length, moderation_mode,
+	kind, owner, accepted_answer_id, updated_at`
+
+func convertThreadRowToThread(t ThreadRow) datastructs.Thread {
+	return datastructs.Thread{
+		Slug:             t.Slug,
+		State:            t.State,
+		MaxLength:        t.MaxLength,
+		ModerationMode:   t.ModerationMode,
+		Kind:             t.Kind,
+		Owner:            t.Owner.String,
+		AcceptedAnswerID: t.AcceptedAnswerID.String,
+		UpdatedAt:        t.UpdatedAt,
+	}
+}
+
+// GetThread - slugs that were never configured are open,
+// post moderated and take comments of any length
+func (d *Database) GetThread(ctx context.Context, slug string) (datastructs.Thread, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "GetThread", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var row ThreadRow
+	err := d.Client.GetContext(
+		ctx,
+		&row,
+		`SELECT `+threadColumns+`
+		 FROM threads WHERE slug=$1`,
+		slug,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return datastructs.Thread{
+			Slug:           slug,
+			State:          datastructs.ThreadOpen,
+			ModerationMode: datastructs.ThreadModerationPost,
+			Kind:           datastructs.ThreadKindDiscussion,
+		}, nil
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Thread{}, fmt.Errorf("failed to fetch thread: %w", err)
+	}
+	return convertThreadRowToThread(row), nil
+}
+
+// ListThreads - the configured threads matching the query
+func (d *Database) ListThreads(ctx context.Context, q datastructs.ThreadQuery) ([]datastructs.Thread, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListThreads", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var answered sql.NullBool
+	if q.Answered != nil {
+		answered = sql.NullBool{Bool: *q.Answered, Valid: true}
+	}
+
+	var rows []ThreadRow
+	err := d.Client.SelectContext(
+		ctx,
+		&rows,
+		`SELECT `+threadColumns+`
+		 FROM threads
+		 WHERE ($1 = '' OR state = $1)
+		 AND ($2 = '' OR kind = $2)
+		 AND ($3::boolean IS NULL OR (accepted_answer_id IS NOT NULL) = $3)
+		 ORDER BY slug
+		 LIMIT NULLIF($4, 0)`,
+		q.State,
+		q.Kind,
+		answered,
+		q.Limit,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to list threads: %w", err)
+	}
+
+	threads := make([]datastructs.Thread, 0, len(rows))
+	for _, row := range rows {
+		threads = append(threads, convertThreadRowToThread(row))
+	}
+	return threads, nil
+}
+
+func (d *Database) UpdateThread(ctx context.Context, thread datastructs.Thread) (datastructs.Thread, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "UpdateThread", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	thread.UpdatedAt = time.Now().UTC()
+	row := ThreadRow{
+		Slug:           thread.Slug,
+		State:          thread.State,
+		MaxLength:      thread.MaxLength,
+		ModerationMode: thread.ModerationMode,
+		Kind:           thread.Kind,
+		Owner:          sql.NullString{String: thread.Owner, Valid: thread.Owner != ""},
+		UpdatedAt:      thread.UpdatedAt,
+	}
+	// The accepted answer is left alone, it is set with SetAcceptedAnswer
+	var saved ThreadRow
+	rows, err := d.Client.NamedQueryContext(
+		ctx,
+		`INSERT INTO threads
+		(slug, state, max_length, moderation_mode, kind, owner, updated_at)
+		VALUES
+		(:slug, :state, :max_length, :moderation_mode, :kind, :owner, :updated_at)
+		ON CONFLICT (slug) DO UPDATE SET
+		state = EXCLUDED.state,
+		max_length = EXCLUDED.max_length,
+		moderation_mode = EXCLUDED.moderation_mode,
+		kind = EXCLUDED.kind,
+		owner = EXCLUDED.owner,
+		updated_at = EXCLUDED.updated_at
+		RETURNING `+threadColumns,
+		row,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Thread{}, fmt.Errorf("failed to update thread: %w", err)
+	}
+	defer rows.Close()
+	if rows.Next() {
+		if err := rows.StructScan(&saved); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return datastructs.Thread{}, fmt.Errorf("failed to update thread: %w", err)
+		}
+	}
+	return convertThreadRowToThread(saved), rows.Err()
+}
+
+// SetAcceptedAnswer - an empty comment id clears the accepted answer
+func (d *Database) SetAcceptedAnswer(ctx context.Context, slug string, commentID string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "SetAcceptedAnswer", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	res, err := d.Client.ExecContext(
+		ctx,
+		`UPDATE threads SET accepted_answer_id = $2, updated_at = $3 WHERE slug = $1`,
+		slug,
+		sql.NullString{String: commentID, Valid: commentID != ""},
+		time.Now().UTC(),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to set accepted answer: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		span.SetStatus(codes.Error, sql.ErrNoRows.Error())
+		return fmt.Errorf("failed to set accepted answer: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// DeleteThread - puts the slug back to the default settings
+func (d *Database) DeleteThread(ctx context.Context, slug string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "DeleteThread", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	_, err := d.Client.ExecContext(
+		ctx,
+		`DELETE FROM threads WHERE slug=$1`,
+		slug,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to delete thread: %w", err)
+	}
+	return nil
+}
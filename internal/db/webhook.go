@@ -0,0 +1,462 @@
+package db
+
+// This file in the db package stores webhooks and the
+// log of every event delivered to them
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type WebhookRow struct {
+	ID        string
+	URL       string
+	Events    pq.StringArray
+	Secret    string
+	Active    bool
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+const webhookColumns = `id, url, events, secret, active, created_at, updated_at`
+
+func convertWebhookRowToWebhook(w WebhookRow) datastructs.Webhook {
+	events := []string(w.Events)
+	if events == nil {
+		events = []string{}
+	}
+	return datastructs.Webhook{
+		ID:        w.ID,
+		URL:       w.URL,
+		Events:    events,
+		Secret:    w.Secret,
+		Active:    w.Active,
+		CreatedAt: w.CreatedAt,
+		UpdatedAt: w.UpdatedAt,
+	}
+}
+
+type WebhookDeliveryRow struct {
+	ID             string
+	WebhookID      string `db:"webhook_id"`
+	EventID        string `db:"event_id"`
+	EventType      string `db:"event_type"`
+	Payload        string
+	Status         string
+	Attempts       int
+	ResponseStatus int            `db:"response_status"`
+	LastError      string         `db:"last_error"`
+	ReplayOf       sql.NullString `db:"replay_of"`
+	NextAttemptAt  time.Time      `db:"next_attempt_at"`
+	CreatedAt      time.Time      `db:"created_at"`
+	DeliveredAt    sql.NullTime   `db:"delivered_at"`
+}
+
+const webhookDeliveryColumns = `id, webhook_id, event_id, event_type, payload, status, attempts,
+	response_status, last_error, replay_of, next_attempt_at, created_at, delivered_at`
+
+func convertWebhookDeliveryRowToWebhookDelivery(d WebhookDeliveryRow) datastructs.WebhookDelivery {
+	delivery := datastructs.WebhookDelivery{
+		ID:             d.ID,
+		WebhookID:      d.WebhookID,
+		EventID:        d.EventID,
+		EventType:      d.EventType,
+		Payload:        d.Payload,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		ResponseStatus: d.ResponseStatus,
+		LastError:      d.LastError,
+		ReplayOf:       d.ReplayOf.String,
+		NextAttemptAt:  d.NextAttemptAt,
+		CreatedAt:      d.CreatedAt,
+	}
+	if d.DeliveredAt.Valid {
+		delivery.DeliveredAt = &d.DeliveredAt.Time
+	}
+	return delivery
+}
+
+func (d *Database) GetWebhook(ctx context.Context, id string) (datastructs.Webhook, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "GetWebhook", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var row WebhookRow
+	err := d.Client.GetContext(
+		ctx,
+		&row,
+		`SELECT `+webhookColumns+` FROM webhooks WHERE id=$1`,
+		id,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Webhook{}, fmt.Errorf("error fetching webhook by uuid: %w", err)
+	}
+	return convertWebhookRowToWebhook(row), nil
+}
+
+func (d *Database) ListWebhooks(ctx context.Context) ([]datastructs.Webhook, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListWebhooks", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var rows []WebhookRow
+	err := d.Client.SelectContext(
+		ctx,
+		&rows,
+		`SELECT `+webhookColumns+` FROM webhooks ORDER BY created_at`,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+
+	hooks := make([]datastructs.Webhook, 0, len(rows))
+	for _, row := range rows {
+		hooks = append(hooks, convertWebhookRowToWebhook(row))
+	}
+	return hooks, nil
+}
+
+func (d *Database) PostWebhook(ctx context.Context, hook datastructs.Webhook) (datastructs.Webhook, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "PostWebhook", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	id := uuid.NewV4().String()
+	now := time.Now().UTC()
+	_, err := d.Client.NamedExecContext(
+		ctx,
+		`INSERT INTO webhooks
+		(id, url, events, secret, active, created_at, updated_at)
+		VALUES
+		(:id, :url, :events, :secret, :active, :created_at, :updated_at)`,
+		WebhookRow{
+			ID:        id,
+			URL:       hook.URL,
+			Events:    pq.StringArray(hook.Events),
+			Secret:    hook.Secret,
+			Active:    hook.Active,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Webhook{}, fmt.Errorf("failed to insert webhook: %w", err)
+	}
+	return d.GetWebhook(ctx, id)
+}
+
+// UpdateWebhook - an empty secret keeps the one the webhook has
+func (d *Database) UpdateWebhook(ctx context.Context, id string, hook datastructs.Webhook) (datastructs.Webhook, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "UpdateWebhook", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	res, err := d.Client.NamedExecContext(
+		ctx,
+		`UPDATE webhooks SET
+		url = :url,
+		events = :events,
+		secret = COALESCE(NULLIF(:secret, ''), secret),
+		active = :active,
+		updated_at = :updated_at
+		WHERE id = :id`,
+		WebhookRow{
+			ID:        id,
+			URL:       hook.URL,
+			Events:    pq.StringArray(hook.Events),
+			Secret:    hook.Secret,
+			Active:    hook.Active,
+			UpdatedAt: time.Now().UTC(),
+		},
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.Webhook{}, fmt.Errorf("failed to update webhook: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		span.SetStatus(codes.Error, sql.ErrNoRows.Error())
+		return datastructs.Webhook{}, fmt.Errorf("failed to update webhook: %w", sql.ErrNoRows)
+	}
+
+	return d.GetWebhook(ctx, id)
+}
+
+// DeleteWebhook - its delivery log goes with it
+func (d *Database) DeleteWebhook(ctx context.Context, id string) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "DeleteWebhook", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	res, err := d.Client.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		span.SetStatus(codes.Error, sql.ErrNoRows.Error())
+		return fmt.Errorf("failed to delete webhook: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// ListWebhookDeliveries - a webhook's delivery log, newest first
+func (d *Database) ListWebhookDeliveries(ctx context.Context, q datastructs.WebhookDeliveryQuery) ([]datastructs.WebhookDelivery, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ListWebhookDeliveries", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var rows []WebhookDeliveryRow
+	err := d.Client.SelectContext(
+		ctx,
+		&rows,
+		`SELECT `+webhookDeliveryColumns+`
+		 FROM webhook_deliveries
+		 WHERE webhook_id = $1 AND ($2 = '' OR status = $2)
+		 ORDER BY created_at DESC
+		 LIMIT $3 OFFSET $4`,
+		q.WebhookID,
+		q.Status,
+		q.Limit,
+		q.Offset,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+
+	deliveries := make([]datastructs.WebhookDelivery, 0, len(rows))
+	for _, row := range rows {
+		deliveries = append(deliveries, convertWebhookDeliveryRowToWebhookDelivery(row))
+	}
+	return deliveries, nil
+}
+
+func (d *Database) GetWebhookDelivery(ctx context.Context, id string) (datastructs.WebhookDelivery, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "GetWebhookDelivery", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var row WebhookDeliveryRow
+	err := d.Client.GetContext(
+		ctx,
+		&row,
+		`SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries WHERE id=$1`,
+		id,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.WebhookDelivery{}, fmt.Errorf("error fetching webhook delivery by uuid: %w", err)
+	}
+	return convertWebhookDeliveryRowToWebhookDelivery(row), nil
+}
+
+// ReplayWebhookDelivery - queues the delivery's payload again as a new
+// delivery, the failed one stays in the log as it was
+func (d *Database) ReplayWebhookDelivery(ctx context.Context, delivery datastructs.WebhookDelivery) (datastructs.WebhookDelivery, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "ReplayWebhookDelivery", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	now := time.Now().UTC()
+	var row WebhookDeliveryRow
+	err := d.Client.QueryRowxContext(
+		ctx,
+		`INSERT INTO webhook_deliveries
+		(id, webhook_id, event_id, event_type, payload, status, replay_of, next_attempt_at, created_at)
+		VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $8)
+		RETURNING `+webhookDeliveryColumns,
+		uuid.NewV4().String(),
+		delivery.WebhookID,
+		delivery.EventID,
+		delivery.EventType,
+		delivery.Payload,
+		datastructs.WebhookPending,
+		delivery.ID,
+		now,
+	).StructScan(&row)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return datastructs.WebhookDelivery{}, fmt.Errorf("failed to replay webhook delivery: %w", err)
+	}
+	return convertWebhookDeliveryRowToWebhookDelivery(row), nil
+}
+
+// CreateWebhookDeliveries - a pending delivery for every active webhook
+// listening for the event type, webhooks with no events get every type
+func (d *Database) CreateWebhookDeliveries(ctx context.Context, eventID string, eventType string, payload string) (int, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "CreateWebhookDeliveries", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var webhookIDs []string
+	err = tx.SelectContext(
+		ctx,
+		&webhookIDs,
+		`SELECT id FROM webhooks
+		 WHERE active AND (cardinality(events) = 0 OR $1 = ANY(events))`,
+		eventType,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, fmt.Errorf("failed to find webhooks: %w", err)
+	}
+
+	now := time.Now().UTC()
+	for _, webhookID := range webhookIDs {
+		_, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO webhook_deliveries
+			(id, webhook_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+			VALUES
+			($1, $2, $3, $4, $5, $6, $7, $7)`,
+			uuid.NewV4().String(),
+			webhookID,
+			eventID,
+			eventType,
+			payload,
+			datastructs.WebhookPending,
+			now,
+		)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return 0, fmt.Errorf("failed to create webhook delivery: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, fmt.Errorf("failed to create webhook deliveries: %w", err)
+	}
+	return len(webhookIDs), nil
+}
+
+type leasedWebhookDeliveryRow struct {
+	WebhookDeliveryRow
+	URL    string
+	Secret string
+}
+
+// LeaseWebhookDeliveries - counts an attempt against each delivery that
+// is due and pushes its next attempt back by the lease, so a delivery
+// whose sender dies part way through is picked up again once the lease
+// ends. Deliveries to webhooks that were deactivated wait until they
+// are active again
+func (d *Database) LeaseWebhookDeliveries(
+	ctx context.Context,
+	now time.Time,
+	limit int,
+	lease time.Duration,
+) ([]datastructs.WebhookDelivery, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "LeaseWebhookDeliveries", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var rows []leasedWebhookDeliveryRow
+	err := d.Client.SelectContext(
+		ctx,
+		&rows,
+		`UPDATE webhook_deliveries d SET attempts = d.attempts + 1, next_attempt_at = $2
+		 FROM webhooks w
+		 WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT dd.id FROM webhook_deliveries dd
+			JOIN webhooks ww ON ww.id = dd.webhook_id
+			WHERE dd.status IN ('pending', 'retrying') AND dd.next_attempt_at <= $1
+			AND ww.active
+			ORDER BY dd.next_attempt_at
+			LIMIT $3
+			FOR UPDATE OF dd SKIP LOCKED
+		 )
+		 RETURNING `+prefixColumns("d", webhookDeliveryColumns)+`, w.url, w.secret`,
+		now,
+		now.Add(lease),
+		limit,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to lease webhook deliveries: %w", err)
+	}
+
+	deliveries := make([]datastructs.WebhookDelivery, 0, len(rows))
+	for _, row := range rows {
+		delivery := convertWebhookDeliveryRowToWebhookDelivery(row.WebhookDeliveryRow)
+		delivery.URL = row.URL
+		delivery.Secret = row.Secret
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// RecordWebhookAttempt - stores the outcome of sending a
+// delivery, a zero nextAttempt keeps the lease
+func (d *Database) RecordWebhookAttempt(ctx context.Context, delivery datastructs.WebhookDelivery, nextAttempt time.Time) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "RecordWebhookAttempt", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var deliveredAt sql.NullTime
+	if delivery.DeliveredAt != nil {
+		deliveredAt = sql.NullTime{Time: *delivery.DeliveredAt, Valid: true}
+	}
+	_, err := d.Client.ExecContext(
+		ctx,
+		`UPDATE webhook_deliveries SET status = $2, response_status = $3, last_error = $4,
+		 delivered_at = $5, next_attempt_at = COALESCE($6, next_attempt_at)
+		 WHERE id = $1`,
+		delivery.ID,
+		delivery.Status,
+		delivery.ResponseStatus,
+		delivery.LastError,
+		deliveredAt,
+		sql.NullTime{Time: nextAttempt, Valid: !nextAttempt.IsZero()},
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to record webhook attempt: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package email
+
+// Batches unread notifications into hourly or daily digest emails
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"net/url"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var (
+	textTemplate = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/digest.txt.tmpl"))
+	htmlTemplate = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/digest.html.tmpl"))
+)
+
+const (
+	// DefaultInterval - how often the digester looks for work
+	DefaultInterval = time.Minute
+	// MaxAttempts - a digest that failed this many times is given up on
+	MaxAttempts = 5
+	// leaseDuration - how long a digest being sent is hidden from
+	// other digesters, a crash mid send is retried after it
+	leaseDuration = 10 * time.Minute
+	// batchSize - the most digests sent per tick
+	batchSize  = 50
+	maxBackoff = 6 * time.Hour
+)
+
+// DigestStore - the methods the digester needs to build and log digests
+type DigestStore interface {
+	// CreateDueDigests - claims the unread notifications of every user
+	// whose digest is due into a new pending digest
+	CreateDueDigests(ctx context.Context, now time.Time) (int, error)
+	// LeaseDueDigests - pending and retrying digests due by now, with
+	// their notifications, hidden from other callers until the lease ends
+	LeaseDueDigests(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]datastructs.Digest, error)
+	// RecordDigestAttempt - logs how sending went, a bounced digest
+	// stops any more being sent to the address
+	RecordDigestAttempt(ctx context.Context, digest datastructs.Digest, nextAttempt time.Time) error
+}
+
+// Digester - builds digests when they are due and sends them
+type Digester struct {
+	Store  DigestStore
+	Sender Sender
+	From   string
+	// BaseURL - where the API is publicly reachable, unsubscribe
+	// links in the email point at it
+	BaseURL string
+	// CommentURL - where readers see a comment, with {slug} and {id}
+	// filled in e.g. https://blog.example.com/{slug}#comment-{id}.
+	// When empty the page is taken to be the slug under BaseURL
+	CommentURL string
+	Interval   time.Duration
+	// now - the clock, swapped out by tests
+	now func() time.Time
+}
+
+func NewDigester(store DigestStore, sender Sender, from string, baseURL string, commentURL string) *Digester {
+	return &Digester{
+		Store:      store,
+		Sender:     sender,
+		From:       from,
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		CommentURL: commentURL,
+		Interval:   DefaultInterval,
+		now:        time.Now,
+	}
+}
+
+// Run - ticks until the context is cancelled
+func (d *Digester) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		d.Tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick - builds the digests that are due then sends
+// every digest waiting to go out. Errors are recorded on
+// the span and logged against the digest, the next tick retries
+func (d *Digester) Tick(ctx context.Context) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(ctx, "Tick", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	now := d.now().UTC()
+	if _, err := d.Store.CreateDueDigests(ctx, now); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	digests, err := d.Store.LeaseDueDigests(ctx, now, batchSize, leaseDuration)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	for _, digest := range digests {
+		d.send(ctx, digest)
+	}
+}
+
+// send - one attempt at a digest, the lease already counted it
+func (d *Digester) send(ctx context.Context, digest datastructs.Digest) {
+
+	span := tr.SpanFromContext(ctx)
+
+	msg, err := RenderDigest(digest, d.BaseURL, d.CommentURL)
+	if err == nil {
+		msg.From = d.From
+		err = d.Sender.Send(ctx, msg)
+	}
+
+	now := d.now().UTC()
+	var nextAttempt time.Time
+	switch {
+	case err == nil:
+		digest.Status = datastructs.DigestSent
+		digest.LastError = ""
+		digest.SentAt = &now
+	case IsBounce(err):
+		digest.Status = datastructs.DigestBounced
+		digest.LastError = err.Error()
+	case digest.Attempts >= MaxAttempts:
+		digest.Status = datastructs.DigestFailed
+		digest.LastError = err.Error()
+	default:
+		digest.Status = datastructs.DigestRetrying
+		digest.LastError = err.Error()
+		nextAttempt = now.Add(backoff(digest.Attempts))
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+
+	if err := d.Store.RecordDigestAttempt(ctx, digest, nextAttempt); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// backoff - doubles from a minute after each failed attempt
+func backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	wait := time.Minute << (attempts - 1)
+	if wait <= 0 || wait > maxBackoff {
+		return maxBackoff
+	}
+	return wait
+}
+
+type digestItem struct {
+	Line           string
+	CommentURL     string
+	UnsubscribeURL string
+}
+
+type digestData struct {
+	UserID    string
+	Frequency string
+	Summary   string
+	Items     []digestItem
+}
+
+// RenderDigest - the email for a digest, without a From address.
+// Comments are linked to where readers see them, see Digester.CommentURL
+func RenderDigest(digest datastructs.Digest, baseURL string, commentURL string) (Message, error) {
+
+	baseURL = strings.TrimRight(baseURL, "/")
+	if commentURL == "" {
+		commentURL = baseURL + "/{slug}#comment-{id}"
+	}
+	data := digestData{
+		UserID:    digest.UserID,
+		Frequency: digest.Frequency,
+		Summary:   summarise(len(digest.Notifications)),
+	}
+	for _, n := range digest.Notifications {
+		item := digestItem{
+			Line:       describe(n),
+			CommentURL: commentLink(commentURL, n),
+		}
+		if n.UnsubscribeToken != "" {
+			item.UnsubscribeURL = baseURL + "/api/v1/unsubscribe/" + url.PathEscape(n.UnsubscribeToken)
+		}
+		data.Items = append(data.Items, item)
+	}
+
+	var text, html bytes.Buffer
+	if err := textTemplate.Execute(&text, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render digest: %w", err)
+	}
+	if err := htmlTemplate.Execute(&html, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render digest: %w", err)
+	}
+
+	return Message{
+		To:      digest.Email,
+		Subject: data.Summary,
+		Text:    text.String(),
+		HTML:    html.String(),
+		Headers: map[string]string{
+			"X-Digest-ID": digest.ID,
+			// One click unsubscribe (RFC 8058) turns digests off
+			"List-Unsubscribe":      "<" + baseURL + "/api/v1/digests/" + url.PathEscape(digest.ID) + "/unsubscribe>",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}, nil
+}
+
+// commentLink - the comment URL with the notification's comment filled in
+func commentLink(commentURL string, n datastructs.Notification) string {
+	slug := (&url.URL{Path: strings.TrimPrefix(n.Slug, "/")}).EscapedPath()
+	return strings.NewReplacer("{slug}", slug, "{id}", url.PathEscape(n.CommentID)).Replace(commentURL)
+}
+
+func summarise(count int) string {
+	if count == 1 {
+		return "You have 1 new notification"
+	}
+	return fmt.Sprintf("You have %d new notifications", count)
+}
+
+func describe(n datastructs.Notification) string {
+	switch n.Kind {
+	case datastructs.NotificationReply:
+		return fmt.Sprintf("%s replied to your comment on %s", n.Actor, n.Slug)
+	case datastructs.NotificationMention:
+		return fmt.Sprintf("%s mentioned you on %s", n.Actor, n.Slug)
+	case datastructs.NotificationNewComment:
+		return fmt.Sprintf("%s commented on %s", n.Actor, n.Slug)
+	}
+	return fmt.Sprintf("%s was active on %s", n.Actor, n.Slug)
+}
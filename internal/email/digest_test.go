@@ -0,0 +1,135 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDigestStore struct {
+	due      []datastructs.Digest
+	recorded []datastructs.Digest
+	next     []time.Time
+}
+
+func (s *fakeDigestStore) CreateDueDigests(ctx context.Context, now time.Time) (int, error) {
+	return 0, nil
+}
+
+func (s *fakeDigestStore) LeaseDueDigests(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]datastructs.Digest, error) {
+	due := s.due
+	s.due = nil
+	return due, nil
+}
+
+func (s *fakeDigestStore) RecordDigestAttempt(ctx context.Context, digest datastructs.Digest, nextAttempt time.Time) error {
+	s.recorded = append(s.recorded, digest)
+	s.next = append(s.next, nextAttempt)
+	return nil
+}
+
+type fakeSender struct {
+	sent []Message
+	err  error
+}
+
+func (s *fakeSender) Send(ctx context.Context, msg Message) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+func testDigest(attempts int) datastructs.Digest {
+	return datastructs.Digest{
+		ID:        "d1",
+		UserID:    "alice",
+		Email:     "alice@example.com",
+		Frequency: datastructs.DigestDaily,
+		Attempts:  attempts,
+		Notifications: []datastructs.Notification{
+			{Kind: datastructs.NotificationReply, Actor: "bob", Slug: "post-1", CommentID: "c1"},
+			{Kind: datastructs.NotificationNewComment, Actor: "carol", Slug: "post-2", CommentID: "c2", UnsubscribeToken: "tok"},
+		},
+	}
+}
+
+func TestRenderDigest(t *testing.T) {
+	msg, err := RenderDigest(testDigest(1), "https://comments.example.com/", "https://blog.example.com/{slug}#comment-{id}")
+	require.NoError(t, err)
+
+	assert.Equal(t, "alice@example.com", msg.To)
+	assert.Equal(t, "You have 2 new notifications", msg.Subject)
+	assert.Contains(t, msg.Text, "bob replied to your comment on post-1")
+	assert.Contains(t, msg.Text, "https://blog.example.com/post-1#comment-c1")
+	assert.Contains(t, msg.HTML, `href="https://comments.example.com/api/v1/unsubscribe/tok"`)
+	assert.Equal(t, "<https://comments.example.com/api/v1/digests/d1/unsubscribe>", msg.Headers["List-Unsubscribe"])
+	assert.Equal(t, "List-Unsubscribe=One-Click", msg.Headers["List-Unsubscribe-Post"])
+}
+
+func TestCommentLink(t *testing.T) {
+	n := datastructs.Notification{Slug: "/blog/a post", CommentID: "c1"}
+	assert.Equal(t, "https://blog.example.com/blog/a%20post#comment-c1", commentLink("https://blog.example.com/{slug}#comment-{id}", n))
+	assert.Equal(t, "https://example.com/c/c1", commentLink("https://example.com/c/{id}", n))
+}
+
+func TestDigesterTick(t *testing.T) {
+
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	newDigester := func(store *fakeDigestStore, sender *fakeSender) *Digester {
+		d := NewDigester(store, sender, "comments@example.com", "https://comments.example.com", "")
+		d.now = func() time.Time { return now }
+		return d
+	}
+
+	t.Run("marks a delivered digest sent", func(t *testing.T) {
+		store := &fakeDigestStore{due: []datastructs.Digest{testDigest(1)}}
+		sender := &fakeSender{}
+		newDigester(store, sender).Tick(context.Background())
+
+		require.Len(t, sender.sent, 1)
+		assert.Equal(t, "comments@example.com", sender.sent[0].From)
+		require.Len(t, store.recorded, 1)
+		assert.Equal(t, datastructs.DigestSent, store.recorded[0].Status)
+		assert.Equal(t, now, *store.recorded[0].SentAt)
+	})
+
+	t.Run("retries a temporary failure with backoff", func(t *testing.T) {
+		store := &fakeDigestStore{due: []datastructs.Digest{testDigest(3)}}
+		newDigester(store, &fakeSender{err: errors.New("connection refused")}).Tick(context.Background())
+
+		require.Len(t, store.recorded, 1)
+		assert.Equal(t, datastructs.DigestRetrying, store.recorded[0].Status)
+		assert.Equal(t, now.Add(4*time.Minute), store.next[0])
+	})
+
+	t.Run("gives up after the last attempt", func(t *testing.T) {
+		store := &fakeDigestStore{due: []datastructs.Digest{testDigest(MaxAttempts)}}
+		newDigester(store, &fakeSender{err: errors.New("connection refused")}).Tick(context.Background())
+
+		assert.Equal(t, datastructs.DigestFailed, store.recorded[0].Status)
+	})
+
+	t.Run("never retries a bounce", func(t *testing.T) {
+		store := &fakeDigestStore{due: []datastructs.Digest{testDigest(1)}}
+		bounce := &textproto.Error{Code: 550, Msg: "no such user"}
+		newDigester(store, &fakeSender{err: bounce}).Tick(context.Background())
+
+		assert.Equal(t, datastructs.DigestBounced, store.recorded[0].Status)
+		assert.True(t, store.next[0].IsZero())
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, time.Minute, backoff(1))
+	assert.Equal(t, 8*time.Minute, backoff(4))
+	assert.Equal(t, maxBackoff, backoff(40))
+	assert.Equal(t, maxBackoff, backoff(100))
+}
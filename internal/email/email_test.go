@@ -0,0 +1,121 @@
+package email
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smtpSink - a local SMTP server that keeps what it is sent,
+// answering RCPT with rcptCode
+func smtpSink(t *testing.T, rcptCode int) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		c := textproto.NewConn(conn)
+		c.PrintfLine("220 sink ready")
+		for {
+			line, err := c.ReadLine()
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+			case "EHLO", "HELO", "MAIL":
+				c.PrintfLine("250 ok")
+			case "RCPT":
+				if rcptCode == 250 {
+					c.PrintfLine("250 ok")
+				} else {
+					c.PrintfLine("%d mailbox unavailable", rcptCode)
+				}
+			case "DATA":
+				c.PrintfLine("354 go ahead")
+				lines, err := c.ReadDotLines()
+				if err != nil {
+					return
+				}
+				received <- strings.Join(lines, "\n")
+				c.PrintfLine("250 queued")
+			case "QUIT":
+				c.PrintfLine("221 bye")
+				return
+			default:
+				c.PrintfLine("250 ok")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestSMTPSender(t *testing.T) {
+
+	msg := Message{
+		From:    "Comments <comments@example.com>",
+		To:      "alice@example.com",
+		Subject: "You have 1 new notification",
+		Text:    "bob replied",
+		HTML:    "<p>bob replied</p>",
+		Headers: map[string]string{"x-digest-id": "123"},
+	}
+
+	t.Run("delivers a multipart message", func(t *testing.T) {
+		addr, received := smtpSink(t, 250)
+		require.NoError(t, (&SMTPSender{Addr: addr}).Send(context.Background(), msg))
+
+		data := <-received
+		assert.Contains(t, data, "To: alice@example.com")
+		assert.Contains(t, data, "X-Digest-Id: 123")
+		assert.Contains(t, data, "multipart/alternative")
+		assert.Contains(t, data, "bob replied")
+		assert.Contains(t, data, "text/html")
+	})
+
+	t.Run("a refused mailbox is a bounce", func(t *testing.T) {
+		addr, _ := smtpSink(t, 550)
+		err := (&SMTPSender{Addr: addr}).Send(context.Background(), msg)
+		require.Error(t, err)
+		assert.True(t, IsBounce(err))
+	})
+
+	t.Run("gives up on a server that stops answering", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+		go func() {
+			// Accepts and never greets
+			conn, err := listener.Accept()
+			if err == nil {
+				defer conn.Close()
+				time.Sleep(5 * time.Second)
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err = (&SMTPSender{Addr: listener.Addr().String()}).Send(ctx, msg)
+		require.Error(t, err)
+		assert.Less(t, time.Since(start), 2*time.Second)
+	})
+
+	t.Run("a temporary failure is not a bounce", func(t *testing.T) {
+		addr, _ := smtpSink(t, 451)
+		err := (&SMTPSender{Addr: addr}).Send(context.Background(), msg)
+		require.Error(t, err)
+		assert.False(t, IsBounce(err))
+	})
+}
@@ -0,0 +1,91 @@
+package events
+
+// Publishers for comment events, and the in-process bus every
+// server feeds them into for its own subscribers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+// name is the Tracer name used to identify this instrumentation library.
+const name = "events"
+
+type subscriber struct {
+	id       int
+	listener comment.EventListener
+}
+
+// Bus - an in-process publisher, subscribers are called in the
+// order they subscribed on the publisher's goroutine
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers []subscriber
+	nextID      int
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe - the listener hears every event published from now
+// on, until the returned func is called
+func (b *Bus) Subscribe(l comment.EventListener) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	id := b.nextID
+	b.subscribers = append(b.subscribers, subscriber{id: id, listener: l})
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, s := range b.subscribers {
+			if s.id == id {
+				b.subscribers = append(b.subscribers[:i:i], b.subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Publish - hands the event to every subscriber, even after one
+// fails, and returns what went wrong
+func (b *Bus) Publish(ctx context.Context, evt datastructs.Event) error {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(ctx, "BusPublish", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, s := range subscribers {
+		if err := s.listener.HandleCommentEvent(ctx, evt); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
+// HandleCommentEvent - lets the bus subscribe to another
+// publisher, events from it are published on the bus
+func (b *Bus) HandleCommentEvent(ctx context.Context, evt datastructs.Event) error {
+	return b.Publish(ctx, evt)
+}
@@ -0,0 +1,106 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	mu   sync.Mutex
+	seen []datastructs.Event
+	err  error
+}
+
+func (r *recorder) HandleCommentEvent(ctx context.Context, evt datastructs.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seen = append(r.seen, evt)
+	return r.err
+}
+
+func (r *recorder) ids() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := []string{}
+	for _, evt := range r.seen {
+		ids = append(ids, evt.ID)
+	}
+	return ids
+}
+
+func TestBus(t *testing.T) {
+
+	t.Run("publishes to every subscriber until they unsubscribe", func(t *testing.T) {
+		bus := NewBus()
+		a, b := &recorder{}, &recorder{}
+		bus.Subscribe(a)
+		unsubscribe := bus.Subscribe(b)
+
+		assert.NoError(t, bus.Publish(context.Background(), datastructs.Event{ID: "1"}))
+		unsubscribe()
+		assert.NoError(t, bus.Publish(context.Background(), datastructs.Event{ID: "2"}))
+
+		assert.Equal(t, []string{"1", "2"}, a.ids())
+		assert.Equal(t, []string{"1"}, b.ids())
+	})
+
+	t.Run("a failing subscriber does not stop the others", func(t *testing.T) {
+		bus := NewBus()
+		failing := &recorder{err: errors.New("subscriber down")}
+		ok := &recorder{}
+		bus.Subscribe(failing)
+		bus.Subscribe(ok)
+
+		assert.Error(t, bus.Publish(context.Background(), datastructs.Event{ID: "1"}))
+		assert.Equal(t, []string{"1"}, ok.ids())
+	})
+}
+
+func TestNATSPublisher(t *testing.T) {
+
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1})
+	require.NoError(t, err)
+	go srv.Start()
+	defer srv.Shutdown()
+	require.True(t, srv.ReadyForConnections(5*time.Second))
+
+	conn, err := nats.Connect(srv.ClientURL())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	publisher := NewNATSPublisher(conn, "")
+	bus := NewBus()
+	rec := &recorder{}
+	bus.Subscribe(rec)
+	sub, err := publisher.Subscribe(bus)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+	require.NoError(t, conn.Flush())
+
+	evt := datastructs.Event{
+		ID:         "1",
+		Type:       datastructs.EventCommentCreated,
+		Comment:    datastructs.Comment{ID: "c1", Slug: "post", Body: "hello me@example.com", ProcessedBody: "hello [email]"},
+		OccurredAt: time.Now().UTC().Truncate(time.Second),
+	}
+	require.NoError(t, publisher.Publish(context.Background(), evt))
+
+	assert.Eventually(t, func() bool { return len(rec.ids()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	assert.Equal(t, evt.ID, rec.seen[0].ID)
+	assert.Equal(t, evt.Type, rec.seen[0].Type)
+	assert.Equal(t, evt.Comment.ProcessedBody, rec.seen[0].Comment.ProcessedBody)
+	// What the author wrote never leaves the server it was posted to
+	assert.Empty(t, rec.seen[0].Comment.Body)
+	assert.True(t, evt.OccurredAt.Equal(rec.seen[0].OccurredAt))
+}
@@ -0,0 +1,194 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+)
+
+const (
+	// DefaultReplaySize - how many of the latest events are kept
+	// for clients resuming from the last event they saw
+	DefaultReplaySize = 1000
+	// DefaultQueueSize - how many events a subscriber may fall
+	// behind by before it is dropped
+	DefaultQueueSize = 64
+	// DefaultMaxSubscribers - the most subscribers at once
+	DefaultMaxSubscribers = 10000
+	// DefaultMaxPerClient - the most subscribers one client may
+	// have at once, so one client can not take every place
+	DefaultMaxPerClient = 16
+)
+
+var (
+	ErrTooManySubscribers = errors.New("too many subscribers")
+)
+
+// Hub - fans comment events out to the subscribers following
+// each slug, keeping the latest events so clients that reconnect
+// can catch up on what they missed
+type Hub struct {
+	ReplaySize     int
+	QueueSize      int
+	MaxSubscribers int
+	MaxPerClient   int
+
+	mu          sync.Mutex
+	replay      []datastructs.Event
+	subscribers map[*Subscription]struct{}
+	perClient   map[string]int
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		ReplaySize:     DefaultReplaySize,
+		QueueSize:      DefaultQueueSize,
+		MaxSubscribers: DefaultMaxSubscribers,
+		MaxPerClient:   DefaultMaxPerClient,
+		subscribers:    map[*Subscription]struct{}{},
+		perClient:      map[string]int{},
+	}
+}
+
+// Subscription - the events for the slugs a subscriber follows,
+// Done is closed once it is closed or has fallen too far behind
+type Subscription struct {
+	hub    *Hub
+	client string
+	events chan datastructs.Event
+	done   chan struct{}
+	// slugs and lagged are guarded by the hub's lock
+	slugs  map[string]bool
+	lagged bool
+}
+
+// Subscribe - a subscription following no slugs yet for the client,
+// such as the caller's address, which may only have MaxPerClient
+func (h *Hub) Subscribe(client string) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.subscribers) >= h.MaxSubscribers || h.perClient[client] >= h.MaxPerClient {
+		return nil, ErrTooManySubscribers
+	}
+	sub := &Subscription{
+		hub:    h,
+		client: client,
+		events: make(chan datastructs.Event, h.QueueSize),
+		done:   make(chan struct{}),
+		slugs:  map[string]bool{},
+	}
+	h.subscribers[sub] = struct{}{}
+	h.perClient[client]++
+	return sub, nil
+}
+
+// HandleCommentEvent - keeps the event for replay and queues it for
+// every subscriber following its slug. A subscriber whose queue is
+// full is dropped rather than holding up everybody else, events
+// seen before are ignored as the bus may deliver them more than once
+func (h *Hub) HandleCommentEvent(ctx context.Context, evt datastructs.Event) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, seen := range h.replay {
+		if seen.ID == evt.ID {
+			return nil
+		}
+	}
+	h.replay = append(h.replay, evt)
+	if over := len(h.replay) - h.ReplaySize; over > 0 {
+		h.replay = append([]datastructs.Event(nil), h.replay[over:]...)
+	}
+
+	for sub := range h.subscribers {
+		if !sub.slugs[evt.Comment.Slug] {
+			continue
+		}
+		select {
+		case sub.events <- evt:
+		default:
+			sub.lagged = true
+			h.remove(sub)
+		}
+	}
+	return nil
+}
+
+// remove - stops delivering to the subscriber, the hub's lock must be held
+func (h *Hub) remove(sub *Subscription) {
+	if _, ok := h.subscribers[sub]; !ok {
+		return
+	}
+	delete(h.subscribers, sub)
+	if h.perClient[sub.client]--; h.perClient[sub.client] <= 0 {
+		delete(h.perClient, sub.client)
+	}
+	close(sub.done)
+}
+
+// Follow - starts delivering the slug's events and returns the kept
+// events after lastEventID for it, which come before anything
+// delivered. Nothing is returned without a lastEventID, every kept
+// event is when it is not one of them as any could have been missed
+func (s *Subscription) Follow(slug string, lastEventID string) []datastructs.Event {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	s.slugs[slug] = true
+
+	missed := []datastructs.Event{}
+	if lastEventID == "" {
+		return missed
+	}
+
+	start := 0
+	for i, evt := range s.hub.replay {
+		if evt.ID == lastEventID {
+			start = i + 1
+			break
+		}
+	}
+	for _, evt := range s.hub.replay[start:] {
+		if evt.Comment.Slug == slug {
+			missed = append(missed, evt)
+		}
+	}
+	return missed
+}
+
+// Unfollow - stops delivering the slug's events
+func (s *Subscription) Unfollow(slug string) {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	delete(s.slugs, slug)
+}
+
+// Events - the events for the followed slugs in the order they happened
+func (s *Subscription) Events() <-chan datastructs.Event {
+	return s.events
+}
+
+// Done - closed once the subscription is closed or dropped
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Lagged - whether the subscription was dropped for falling behind
+func (s *Subscription) Lagged() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	return s.lagged
+}
+
+// Close - stops delivering events, closing twice is harmless
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	s.hub.remove(s)
+}
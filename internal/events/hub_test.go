@@ -0,0 +1,124 @@
+package events
+
+import (
+	"context"
+	"testing"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func slugEvent(id string, slug string) datastructs.Event {
+	return datastructs.Event{ID: id, Comment: datastructs.Comment{Slug: slug}}
+}
+
+func received(sub *Subscription) []string {
+	ids := []string{}
+	for {
+		select {
+		case evt := <-sub.Events():
+			ids = append(ids, evt.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func eventIDs(evts []datastructs.Event) []string {
+	ids := []string{}
+	for _, evt := range evts {
+		ids = append(ids, evt.ID)
+	}
+	return ids
+}
+
+func TestHub(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Run("delivers only the followed slugs, once each", func(t *testing.T) {
+		hub := NewHub()
+		sub, err := hub.Subscribe("client")
+		require.NoError(t, err)
+		sub.Follow("a", "")
+
+		hub.HandleCommentEvent(ctx, slugEvent("1", "a"))
+		hub.HandleCommentEvent(ctx, slugEvent("2", "b"))
+		hub.HandleCommentEvent(ctx, slugEvent("1", "a"))
+
+		assert.Equal(t, []string{"1"}, received(sub))
+	})
+
+	t.Run("replays what was missed after the last event seen", func(t *testing.T) {
+		hub := NewHub()
+		for _, evt := range []datastructs.Event{slugEvent("1", "a"), slugEvent("2", "b"), slugEvent("3", "a"), slugEvent("4", "a")} {
+			hub.HandleCommentEvent(ctx, evt)
+		}
+		sub, err := hub.Subscribe("client")
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{}, eventIDs(sub.Follow("a", "")))
+		assert.Equal(t, []string{"3", "4"}, eventIDs(sub.Follow("a", "1")))
+		// Too old to be kept, everything might have been missed
+		assert.Equal(t, []string{"1", "3", "4"}, eventIDs(sub.Follow("a", "gone")))
+	})
+
+	t.Run("keeps a bounded number of events", func(t *testing.T) {
+		hub := NewHub()
+		hub.ReplaySize = 2
+		for _, id := range []string{"1", "2", "3"} {
+			hub.HandleCommentEvent(ctx, slugEvent(id, "a"))
+		}
+		sub, err := hub.Subscribe("client")
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"2", "3"}, eventIDs(sub.Follow("a", "gone")))
+	})
+
+	t.Run("drops subscribers that fall behind", func(t *testing.T) {
+		hub := NewHub()
+		hub.QueueSize = 1
+		sub, err := hub.Subscribe("client")
+		require.NoError(t, err)
+		sub.Follow("a", "")
+
+		hub.HandleCommentEvent(ctx, slugEvent("1", "a"))
+		hub.HandleCommentEvent(ctx, slugEvent("2", "a"))
+
+		<-sub.Done()
+		assert.True(t, sub.Lagged())
+		sub.Close()
+	})
+
+	t.Run("caps the number of subscribers", func(t *testing.T) {
+		hub := NewHub()
+		hub.MaxSubscribers = 1
+		sub, err := hub.Subscribe("client")
+		require.NoError(t, err)
+
+		_, err = hub.Subscribe("client")
+		assert.ErrorIs(t, err, ErrTooManySubscribers)
+
+		sub.Close()
+		_, err = hub.Subscribe("client")
+		assert.NoError(t, err)
+	})
+
+	t.Run("caps the number of subscribers per client", func(t *testing.T) {
+		hub := NewHub()
+		hub.MaxPerClient = 1
+		sub, err := hub.Subscribe("client")
+		require.NoError(t, err)
+
+		_, err = hub.Subscribe("client")
+		assert.ErrorIs(t, err, ErrTooManySubscribers)
+		_, err = hub.Subscribe("other")
+		assert.NoError(t, err)
+
+		sub.Close()
+		sub.Close()
+		_, err = hub.Subscribe("client")
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,92 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+// DefaultNATSSubject - events are published on the subject
+// followed by their type, e.g. comments.comment.created
+const DefaultNATSSubject = "comments"
+
+// flushTimeout - how long Publish waits for the server when
+// the caller's context has no deadline of its own
+const flushTimeout = 5 * time.Second
+
+// NATSPublisher - publishes events as JSON to a NATS server
+type NATSPublisher struct {
+	Conn    *nats.Conn
+	Subject string
+}
+
+func NewNATSPublisher(conn *nats.Conn, subject string) *NATSPublisher {
+	if subject == "" {
+		subject = DefaultNATSSubject
+	}
+	return &NATSPublisher{Conn: conn, Subject: subject}
+}
+
+// Publish - only returns once the server has the event, so
+// the outbox does not mark it dispatched before then
+func (p *NATSPublisher) Publish(ctx context.Context, evt datastructs.Event) error {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(ctx, "NATSPublish", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	data, err := json.Marshal(evt)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	if err := p.Conn.Publish(p.Subject+"."+evt.Type, data); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, flushTimeout)
+		defer cancel()
+	}
+	if err := p.Conn.FlushWithContext(ctx); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	return nil
+}
+
+// Subscribe - hands every event published under the subject to
+// the listener until the subscription is unsubscribed. Events that
+// can not be decoded or that the listener fails are dropped, NATS
+// does not redeliver them
+func (p *NATSPublisher) Subscribe(l comment.EventListener) (*nats.Subscription, error) {
+	return p.Conn.Subscribe(p.Subject+".>", func(msg *nats.Msg) {
+
+		startTime := time.Now()
+		ctx, span := otel.Tracer(name).Start(context.Background(), "NATSReceive", tr.WithTimestamp(startTime))
+		defer span.End(tr.WithTimestamp(time.Now()))
+
+		var evt datastructs.Event
+		if err := json.Unmarshal(msg.Data, &evt); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return
+		}
+		if err := l.HandleCommentEvent(ctx, evt); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+	})
+}
@@ -0,0 +1,212 @@
+package outbox
+
+// Relays the comment events written to the outbox to every listener
+// at least once, the events about a comment in the order they happened
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+// name is the Tracer name used to identify this instrumentation library.
+const name = "outbox"
+
+const (
+	// DefaultInterval - how often the relay looks for new events
+	DefaultInterval = time.Second
+	// GiveUpAfter - a listener still failing an event this long after
+	// it was written is given up on for that event, so it stops holding
+	// up the events behind it. The other listeners still have it
+	GiveUpAfter = 24 * time.Hour
+	// baseBackoff - how long after failing an event is first relayed
+	// again, doubling with every attempt up to maxBackoff
+	baseBackoff = time.Second
+	maxBackoff  = 10 * time.Minute
+	// batchSize - the most events claimed at once
+	batchSize = 100
+	// claimLease - how long claimed events are held for, long enough
+	// for a batch to be dispatched. Events still claimed once it runs
+	// out can be claimed by another relay
+	claimLease = 5 * time.Minute
+	// retention - how long dispatched events are kept
+	retention = 7 * 24 * time.Hour
+	// pruneEvery - how often dispatched events are pruned
+	pruneEvery = time.Hour
+)
+
+// Store - the methods the relay needs to read the outbox
+type Store interface {
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]datastructs.OutboxEvent, error)
+	CompleteOutboxEvent(ctx context.Context, res datastructs.OutboxResult) error
+	ReleaseOutboxEvents(ctx context.Context, eventIDs []string) error
+	PruneOutbox(ctx context.Context, before time.Time) error
+}
+
+// Listener - a listener the relay hands events to, the outbox
+// records which listeners have had an event by name
+type Listener struct {
+	Name     string
+	Listener comment.EventListener
+}
+
+// Relay - hands every outbox event to the listeners
+type Relay struct {
+	Store     Store
+	Listeners []Listener
+	Interval  time.Duration
+	lastPrune time.Time
+}
+
+func NewRelay(store Store, listeners ...Listener) *Relay {
+	return &Relay{
+		Store:     store,
+		Listeners: listeners,
+		Interval:  DefaultInterval,
+	}
+}
+
+// Run - ticks until the context is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		r.Tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick - relays events until the outbox is drained or a listener fails
+func (r *Relay) Tick(ctx context.Context) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(ctx, "Tick", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	for ctx.Err() == nil {
+		n, more, err := r.relayBatch(ctx)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return
+		}
+		if !more || n < batchSize {
+			break
+		}
+	}
+
+	if time.Since(r.lastPrune) > pruneEvery {
+		r.lastPrune = time.Now()
+		if err := r.Store.PruneOutbox(ctx, time.Now().UTC().Add(-retention)); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+}
+
+// relayBatch - claims a batch of events and dispatches them in order,
+// the first event a listener fails stops the batch so later events
+// never overtake it. Returns how many events were relayed and whether
+// it is worth claiming another batch
+func (r *Relay) relayBatch(ctx context.Context) (int, bool, error) {
+
+	evts, err := r.Store.ClaimOutboxEvents(ctx, batchSize, claimLease)
+	if err != nil {
+		return 0, false, err
+	}
+
+	for i, evt := range evts {
+		res := r.Dispatch(ctx, evt)
+		if err := r.Store.CompleteOutboxEvent(ctx, res); err != nil {
+			r.release(ctx, evts[i+1:])
+			return i, false, err
+		}
+		if !res.Done {
+			r.release(ctx, evts[i+1:])
+			return i, false, nil
+		}
+	}
+	return len(evts), len(evts) > 0, nil
+}
+
+func (r *Relay) release(ctx context.Context, evts []datastructs.OutboxEvent) {
+	if len(evts) == 0 {
+		return
+	}
+	var ids []string
+	for _, evt := range evts {
+		ids = append(ids, evt.ID)
+	}
+	if err := r.Store.ReleaseOutboxEvents(ctx, ids); err != nil {
+		tr.SpanFromContext(ctx).RecordError(err)
+	}
+}
+
+// Dispatch - hands the event to every listener that has not had it yet,
+// even after one fails. The event is dispatched again to the listeners
+// that failed, backing off further each time, until they succeed or
+// GiveUpAfter has passed since it was written
+func (r *Relay) Dispatch(ctx context.Context, evt datastructs.OutboxEvent) datastructs.OutboxResult {
+
+	delivered := map[string]bool{}
+	for _, name := range evt.Delivered {
+		delivered[name] = true
+	}
+
+	res := datastructs.OutboxResult{EventID: evt.ID}
+	var failed []string
+	var errs []error
+	for _, l := range r.Listeners {
+		if delivered[l.Name] {
+			continue
+		}
+		if err := l.Listener.HandleCommentEvent(ctx, evt.Event); err != nil {
+			failed = append(failed, l.Name)
+			errs = append(errs, fmt.Errorf("%s: %w", l.Name, err))
+			continue
+		}
+		res.Delivered = append(res.Delivered, l.Name)
+	}
+
+	if len(errs) == 0 {
+		res.Done = true
+		return res
+	}
+	res.Error = errors.Join(errs...).Error()
+	if !evt.OccurredAt.IsZero() && time.Since(evt.OccurredAt) >= GiveUpAfter {
+		log.Printf("giving up on event %s for %s after %d attempts: %s", evt.ID, strings.Join(failed, ", "), evt.Attempts+1, res.Error)
+		res.GivenUp = failed
+		res.Done = true
+		return res
+	}
+	res.NextAttemptAt = time.Now().Add(backoff(evt.Attempts + 1))
+	return res
+}
+
+// backoff - doubles from a second after each failed attempt
+func backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts > 20 {
+		return maxBackoff
+	}
+	wait := baseBackoff << (attempts - 1)
+	if wait > maxBackoff {
+		return maxBackoff
+	}
+	return wait
+}
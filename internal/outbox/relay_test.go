@@ -0,0 +1,170 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeStore - an in memory outbox that keeps the store's
+// rules, recording which listeners have had each event
+type fakeStore struct {
+	events    []datastructs.Event
+	attempts  map[string]int
+	delivered map[string][]string
+	givenUp   map[string][]string
+	done      map[string]bool
+	claimed   map[string]bool
+	next      map[string]time.Time
+}
+
+func newFakeStore(events ...datastructs.Event) *fakeStore {
+	return &fakeStore{
+		events:    events,
+		attempts:  map[string]int{},
+		delivered: map[string][]string{},
+		givenUp:   map[string][]string{},
+		done:      map[string]bool{},
+		claimed:   map[string]bool{},
+		next:      map[string]time.Time{},
+	}
+}
+
+func (s *fakeStore) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]datastructs.OutboxEvent, error) {
+	var evts []datastructs.OutboxEvent
+	for _, evt := range s.events {
+		if s.claimed[evt.ID] {
+			return nil, nil
+		}
+	}
+	for _, evt := range s.events {
+		if s.done[evt.ID] || len(evts) == limit {
+			continue
+		}
+		if s.next[evt.ID].After(time.Now()) {
+			break
+		}
+		s.claimed[evt.ID] = true
+		evts = append(evts, datastructs.OutboxEvent{
+			Event:     evt,
+			Attempts:  s.attempts[evt.ID],
+			Delivered: append([]string(nil), s.delivered[evt.ID]...),
+		})
+	}
+	return evts, nil
+}
+
+func (s *fakeStore) CompleteOutboxEvent(ctx context.Context, res datastructs.OutboxResult) error {
+	s.attempts[res.EventID]++
+	s.delivered[res.EventID] = append(s.delivered[res.EventID], res.Delivered...)
+	s.givenUp[res.EventID] = append(s.givenUp[res.EventID], res.GivenUp...)
+	s.done[res.EventID] = res.Done
+	s.next[res.EventID] = res.NextAttemptAt
+	s.claimed[res.EventID] = false
+	return nil
+}
+
+func (s *fakeStore) ReleaseOutboxEvents(ctx context.Context, eventIDs []string) error {
+	for _, id := range eventIDs {
+		s.claimed[id] = false
+	}
+	return nil
+}
+
+func (s *fakeStore) PruneOutbox(ctx context.Context, before time.Time) error {
+	return nil
+}
+
+type recorder struct {
+	seen  []string
+	fails map[string]int
+}
+
+func (r *recorder) HandleCommentEvent(ctx context.Context, evt datastructs.Event) error {
+	r.seen = append(r.seen, evt.ID)
+	if r.fails[evt.ID] > 0 {
+		r.fails[evt.ID]--
+		return errors.New("listener down")
+	}
+	return nil
+}
+
+func TestRelay(t *testing.T) {
+
+	events := []datastructs.Event{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+
+	t.Run("relays events in order to every listener", func(t *testing.T) {
+		a, b := &recorder{}, &recorder{}
+		NewRelay(newFakeStore(events...), Listener{"a", a}, Listener{"b", b}).Tick(context.Background())
+
+		assert.Equal(t, []string{"1", "2", "3"}, a.seen)
+		assert.Equal(t, []string{"1", "2", "3"}, b.seen)
+	})
+
+	t.Run("a failure holds back later events until it succeeds", func(t *testing.T) {
+		ok := &recorder{}
+		flaky := &recorder{fails: map[string]int{"2": 1}}
+		store := newFakeStore(events...)
+		relay := NewRelay(store, Listener{"ok", ok}, Listener{"flaky", flaky})
+
+		relay.Tick(context.Background())
+		assert.Equal(t, []string{"1", "2"}, flaky.seen)
+		assert.Equal(t, []string{"1", "2"}, ok.seen)
+		assert.False(t, store.claimed["3"])
+
+		// Not until it is due
+		relay.Tick(context.Background())
+		assert.Equal(t, []string{"1", "2"}, flaky.seen)
+
+		store.next["2"] = time.Now()
+		relay.Tick(context.Background())
+		assert.Equal(t, []string{"1", "2", "2", "3"}, flaky.seen)
+		// Listeners that already had the event do not get it again
+		assert.Equal(t, []string{"1", "2", "3"}, ok.seen)
+	})
+
+	t.Run("keeps retrying a listener that is down", func(t *testing.T) {
+		down := &recorder{fails: map[string]int{"1": 100}}
+		store := newFakeStore(datastructs.Event{ID: "1", OccurredAt: time.Now()})
+		store.attempts["1"] = 50
+		relay := NewRelay(store, Listener{"down", down})
+
+		relay.Tick(context.Background())
+		assert.False(t, store.done["1"])
+		assert.Empty(t, store.givenUp["1"])
+		assert.WithinDuration(t, time.Now().Add(maxBackoff), store.next["1"], time.Second)
+	})
+
+	t.Run("only the failing listener is given up on, once the event is old", func(t *testing.T) {
+		ok := &recorder{}
+		down := &recorder{fails: map[string]int{"2": 1}}
+		old := []datastructs.Event{{ID: "1"}, {ID: "2", OccurredAt: time.Now().Add(-GiveUpAfter)}, {ID: "3"}}
+		store := newFakeStore(old...)
+		relay := NewRelay(store, Listener{"ok", ok}, Listener{"down", down})
+
+		relay.Tick(context.Background())
+		assert.Equal(t, []string{"1", "2", "3"}, ok.seen)
+		assert.Equal(t, []string{"ok"}, store.delivered["2"])
+		assert.Equal(t, []string{"down"}, store.givenUp["2"])
+		assert.True(t, store.done["3"])
+		assert.Equal(t, []string{"ok", "down"}, store.delivered["3"])
+	})
+
+	t.Run("nothing is relayed while another relay holds a claim", func(t *testing.T) {
+		a := &recorder{}
+		store := newFakeStore(events...)
+		store.claimed["1"] = true
+		NewRelay(store, Listener{"a", a}).Tick(context.Background())
+		assert.Empty(t, a.seen)
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, backoff(1))
+	assert.Equal(t, 4*time.Second, backoff(3))
+	assert.Equal(t, maxBackoff, backoff(30))
+}
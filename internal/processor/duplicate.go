@@ -0,0 +1,191 @@
+package processor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// DefaultDuplicateWindow - how far back an author's own
+	// comments are checked for exact re-posts
+	DefaultDuplicateWindow = 24 * time.Hour
+	// DefaultNearDuplicateWindow - how far back other authors'
+	// comments are checked for near duplicates
+	DefaultNearDuplicateWindow = 7 * 24 * time.Hour
+	// DefaultNearDuplicateDistance - the most bits two SimHash
+	// fingerprints can differ by and still be near duplicates,
+	// it must stay below SimHashBands for the band lookup to find them
+	DefaultNearDuplicateDistance = 6
+	// SimHashBands - fingerprints are split into this many 8 bit
+	// bands, two fingerprints within DefaultNearDuplicateDistance
+	// bits of each other share at least one band exactly
+	SimHashBands = 8
+	// simHashShingle - fingerprints are built from character
+	// trigrams, words are too coarse for comments this short
+	simHashShingle = 3
+)
+
+// DuplicateStore - what the duplicate stage needs from the database
+type DuplicateStore interface {
+	CountAuthorDuplicates(ctx context.Context, author string, bodyHash string, since time.Time, excludeID string) (int, error)
+	FindSimHashCandidates(ctx context.Context, simHash uint64, since time.Time, excludeAuthor string) ([]datastructs.Comment, error)
+}
+
+// DuplicateStage - rejects an author re-posting the same text and
+// flags text that is nearly the same as another author's comment
+type DuplicateStage struct {
+	Store        DuplicateStore
+	Window       time.Duration
+	NearWindow   time.Duration
+	NearDistance int
+}
+
+func NewDuplicateStage(store DuplicateStore) *DuplicateStage {
+	return &DuplicateStage{
+		Store:        store,
+		Window:       DefaultDuplicateWindow,
+		NearWindow:   DefaultNearDuplicateWindow,
+		NearDistance: DefaultNearDuplicateDistance,
+	}
+}
+
+func (d *DuplicateStage) Name() string {
+	return "duplicate"
+}
+
+func (d *DuplicateStage) Process(ctx context.Context, cmt *datastructs.Comment) error {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(ctx, "DuplicateStage", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	cmt.BodyHash = BodyHash(cmt.Body)
+	cmt.SimHash = SimHash(cmt.Body)
+
+	postedAt := cmt.CreatedAt
+	if postedAt.IsZero() {
+		postedAt = time.Now()
+	}
+
+	count, err := d.Store.CountAuthorDuplicates(ctx, cmt.Author, cmt.BodyHash, postedAt.Add(-d.Window), cmt.ID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	if count > 0 {
+		span.SetAttributes(attribute.Bool("duplicate.exact", true))
+		Escalate(cmt, datastructs.ModerationRejected)
+		return nil
+	}
+
+	// Nothing left of the body to compare once it is normalized
+	if cmt.SimHash == 0 {
+		return nil
+	}
+
+	candidates, err := d.Store.FindSimHashCandidates(ctx, cmt.SimHash, postedAt.Add(-d.NearWindow), cmt.Author)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	for _, c := range candidates {
+		if c.ID == cmt.ID {
+			continue
+		}
+		if HammingDistance(c.SimHash, cmt.SimHash) <= d.NearDistance {
+			span.SetAttributes(attribute.String("duplicate.near", c.ID))
+			Escalate(cmt, datastructs.ModerationFlagged)
+			break
+		}
+	}
+
+	return nil
+}
+
+// NormalizeBody - lower cases the text and strips punctuation and
+// extra whitespace so trivial edits still hash the same
+func NormalizeBody(body string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(body) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			if space && b.Len() > 0 {
+				b.WriteRune(' ')
+			}
+			space = false
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// BodyHash - hex encoded SHA-256 of the normalized body
+func BodyHash(body string) string {
+	sum := sha256.Sum256([]byte(NormalizeBody(body)))
+	return hex.EncodeToString(sum[:])
+}
+
+// SimHash - a 64 bit fingerprint of the body built from
+// overlapping character trigrams, similar text gives similar bits
+func SimHash(body string) uint64 {
+	runes := []rune(NormalizeBody(body))
+	if len(runes) == 0 {
+		return 0
+	}
+
+	shingles := []string{string(runes)}
+	if len(runes) > simHashShingle {
+		shingles = make([]string, 0, len(runes)-simHashShingle+1)
+		for i := 0; i+simHashShingle <= len(runes); i++ {
+			shingles = append(shingles, string(runes[i:i+simHashShingle]))
+		}
+	}
+
+	var weights [64]int
+	for _, s := range shingles {
+		h := fnv.New64a()
+		h.Write([]byte(s))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<uint(bit)) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var fingerprint uint64
+	for bit := 0; bit < 64; bit++ {
+		if weights[bit] > 0 {
+			fingerprint |= 1 << uint(bit)
+		}
+	}
+	return fingerprint
+}
+
+// SimHashBand - the i-th 8 bit band of a fingerprint
+func SimHashBand(fingerprint uint64, i int) uint64 {
+	return (fingerprint >> (8 * uint(i))) & 0xff
+}
+
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,67 @@
+package processor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDuplicateStore struct {
+	duplicates int
+	candidates []datastructs.Comment
+}
+
+func (f *fakeDuplicateStore) CountAuthorDuplicates(context.Context, string, string, time.Time, string) (int, error) {
+	return f.duplicates, nil
+}
+
+func (f *fakeDuplicateStore) FindSimHashCandidates(context.Context, uint64, time.Time, string) ([]datastructs.Comment, error) {
+	return f.candidates, nil
+}
+
+func TestDuplicateStage(t *testing.T) {
+
+	original := "Check out my amazing new site for cheap watches and great deals today"
+	variant := "check out my AMAZING new site for cheap watches and great deals today!!"
+
+	t.Run("normalized hash ignores case and punctuation", func(t *testing.T) {
+		assert.Equal(t, BodyHash(original), BodyHash(variant))
+		assert.NotEqual(t, BodyHash(original), BodyHash("something else entirely"))
+	})
+
+	t.Run("rejects an exact re-post from the same author", func(t *testing.T) {
+		p, _ := NewProcessor(NewDuplicateStage(&fakeDuplicateStore{duplicates: 1}))
+
+		cmt, err := p.ProcessComment(context.Background(), datastructs.Comment{Body: variant})
+		assert.NoError(t, err)
+		assert.Equal(t, datastructs.ModerationRejected, cmt.ModerationStatus)
+	})
+
+	t.Run("flags near duplicates from other authors", func(t *testing.T) {
+		near := "Check out my amazing new site for cheap watches and great deals tomorrow"
+		assert.LessOrEqual(t, HammingDistance(SimHash(original), SimHash(near)), DefaultNearDuplicateDistance)
+
+		store := &fakeDuplicateStore{
+			candidates: []datastructs.Comment{{ID: "other", SimHash: SimHash(near)}},
+		}
+		p, _ := NewProcessor(NewDuplicateStage(store))
+
+		cmt, err := p.ProcessComment(context.Background(), datastructs.Comment{Body: original})
+		assert.NoError(t, err)
+		assert.Equal(t, datastructs.ModerationFlagged, cmt.ModerationStatus)
+	})
+
+	t.Run("unrelated text is left alone", func(t *testing.T) {
+		store := &fakeDuplicateStore{
+			candidates: []datastructs.Comment{{ID: "other", SimHash: SimHash("a thoughtful reply about generics in go")}},
+		}
+		p, _ := NewProcessor(NewDuplicateStage(store))
+
+		cmt, err := p.ProcessComment(context.Background(), datastructs.Comment{Body: original})
+		assert.NoError(t, err)
+		assert.Equal(t, datastructs.ModerationApproved, cmt.ModerationStatus)
+	})
+}
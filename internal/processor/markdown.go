@@ -0,0 +1,101 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+// linkRel - every link in a comment is user generated
+// and should not pass on any ranking
+const linkRel = "nofollow ugc"
+
+// MarkdownStage - renders the processed body to HTML
+// and sanitizes the result against an allowlist
+type MarkdownStage struct {
+	md     goldmark.Markdown
+	policy *bluemonday.Policy
+}
+
+func NewMarkdownStage() *MarkdownStage {
+	return &MarkdownStage{
+		md: goldmark.New(
+			// Raw HTML in the source is left out by goldmark's default renderer
+			goldmark.WithExtensions(extension.Linkify, extension.Strikethrough),
+			goldmark.WithParserOptions(
+				parser.WithASTTransformers(util.Prioritized(linkRelTransformer{}, 100)),
+			),
+		),
+		policy: commentPolicy(),
+	}
+}
+
+// commentPolicy - the only HTML a rendered comment may contain
+func commentPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements("p", "br", "em", "strong", "del", "code", "pre", "blockquote", "ul", "ol", "li", "hr")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowAttrs("rel").Matching(regexp.MustCompile(`^` + linkRel + `$`)).OnElements("a")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.RequireParseableURLs(true)
+	return p
+}
+
+func (m *MarkdownStage) Name() string {
+	return "markdown"
+}
+
+func (m *MarkdownStage) Process(ctx context.Context, cmt *datastructs.Comment) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "MarkdownStage", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	html, err := m.Render(cmt.ProcessedBody)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	cmt.BodyHTML = html
+	return nil
+}
+
+// Render - markdown to sanitized HTML
+func (m *MarkdownStage) Render(src string) (string, error) {
+	var buf bytes.Buffer
+	if err := m.md.Convert([]byte(src), &buf); err != nil {
+		return "", err
+	}
+	return m.policy.Sanitize(buf.String()), nil
+}
+
+// linkRelTransformer - marks every link goldmark finds so
+// the renderer writes rel="nofollow ugc" on it
+type linkRelTransformer struct{}
+
+func (linkRelTransformer) Transform(doc *ast.Document, _ text.Reader, _ parser.Context) {
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n.Kind() {
+		case ast.KindLink, ast.KindAutoLink:
+			n.SetAttributeString("rel", []byte(linkRel))
+		}
+		return ast.WalkContinue, nil
+	})
+}
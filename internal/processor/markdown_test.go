@@ -0,0 +1,32 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkdownStage(t *testing.T) {
+	m := NewMarkdownStage()
+
+	t.Run("renders the supported subset", func(t *testing.T) {
+		html, err := m.Render("**bold** and _em_ with `code`\n\n- one\n- two")
+		assert.NoError(t, err)
+		assert.Equal(t, "<p><strong>bold</strong> and <em>em</em> with <code>code</code></p>\n<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n", html)
+	})
+
+	t.Run("links are nofollow ugc", func(t *testing.T) {
+		html, err := m.Render("[site](https://example.com) and https://example.org")
+		assert.NoError(t, err)
+		assert.Equal(t, `<p><a href="https://example.com" rel="nofollow ugc">site</a> and <a href="https://example.org" rel="nofollow ugc">https://example.org</a></p>`+"\n", html)
+	})
+
+	t.Run("strips scripts, raw html and unsafe urls", func(t *testing.T) {
+		html, err := m.Render("<script>alert(1)</script>\n\n[x](javascript:alert(1)) <img src=x onerror=alert(1)>\n\n![img](https://example.com/a.png)")
+		assert.NoError(t, err)
+		assert.NotContains(t, html, "<script")
+		assert.NotContains(t, html, "javascript:")
+		assert.NotContains(t, html, "<img")
+		assert.NotContains(t, html, "onerror")
+	})
+}
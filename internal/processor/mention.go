@@ -0,0 +1,62 @@
+package processor
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+// MaxMentions - mentions past this many are ignored
+// so one comment can not notify a crowd
+const MaxMentions = 20
+
+// An @ that follows a letter or digit is part of an email, not a mention
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([A-Za-z0-9_][A-Za-z0-9_.\-]{0,38})`)
+
+// MentionStage - finds the @username mentions in a comment
+type MentionStage struct{}
+
+func NewMentionStage() *MentionStage {
+	return &MentionStage{}
+}
+
+func (m *MentionStage) Name() string {
+	return "mention"
+}
+
+func (m *MentionStage) Process(ctx context.Context, cmt *datastructs.Comment) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "MentionStage", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	cmt.Mentions = ParseMentions(cmt.ProcessedBody)
+	span.SetAttributes(attribute.Int("mentions", len(cmt.Mentions)))
+	return nil
+}
+
+// ParseMentions - the usernames mentioned in the text in the
+// order they first appear, each one only once
+func ParseMentions(text string) []string {
+	mentions := []string{}
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		// Trailing dots and dashes are punctuation, "thanks @sam."
+		username := strings.TrimRight(match[1], ".-")
+		if username == "" || seen[username] {
+			continue
+		}
+		seen[username] = true
+		mentions = append(mentions, username)
+		if len(mentions) == MaxMentions {
+			break
+		}
+	}
+	return mentions
+}
@@ -0,0 +1,26 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMentions(t *testing.T) {
+
+	t.Run("finds each username once in order", func(t *testing.T) {
+		assert.Equal(t, []string{"alice", "bob_99"}, ParseMentions("@alice agreed with @bob_99, thanks @alice."))
+	})
+
+	t.Run("ignores email addresses", func(t *testing.T) {
+		assert.Empty(t, ParseMentions("write to jane@example.com"))
+	})
+
+	t.Run("caps how many are returned", func(t *testing.T) {
+		text := ""
+		for i := 0; i < MaxMentions+5; i++ {
+			text += " @user" + string(rune('a'+i))
+		}
+		assert.Len(t, ParseMentions(text), MaxMentions)
+	})
+}
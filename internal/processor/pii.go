@@ -0,0 +1,165 @@
+package processor
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+// Categories of personal information the PII stage looks for
+const (
+	PIIEmail      = "email"
+	PIIPhone      = "phone"
+	PIICreditCard = "credit_card"
+)
+
+// What a site wants done with comments containing personal information
+const (
+	PIIModeRedact = "redact"
+	PIIModeReject = "reject"
+	PIIModeFlag   = "flag"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// Runs of digits broken up by spaces, dashes, dots or brackets,
+	// the digit count decides whether it is a card or a phone number
+	cardPattern  = regexp.MustCompile(`\d(?:[ \-]?\d){12,18}`)
+	phonePattern = regexp.MustCompile(`\+?\(?\d(?:[\d \-.()]{6,18})\d`)
+)
+
+// PIIStore - what the PII stage needs from the database
+type PIIStore interface {
+	GetPIISettings(context.Context, string) (datastructs.PIISettings, error)
+}
+
+// PIIStage - finds emails, phone numbers and card numbers in comments
+// and redacts, rejects or flags them depending on the site's settings
+type PIIStage struct {
+	Store PIIStore
+}
+
+func NewPIIStage(store PIIStore) *PIIStage {
+	return &PIIStage{
+		Store: store,
+	}
+}
+
+func (p *PIIStage) Name() string {
+	return "pii"
+}
+
+func (p *PIIStage) Process(ctx context.Context, cmt *datastructs.Comment) error {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(ctx, "PIIStage", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	redacted, categories := RedactPII(cmt.ProcessedBody)
+	cmt.PIICategories = categories
+	if len(categories) == 0 {
+		return nil
+	}
+	span.SetAttributes(attribute.StringSlice("pii.categories", categories))
+
+	settings, err := p.Store.GetPIISettings(ctx, cmt.Site)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	switch settings.Mode {
+	case PIIModeReject:
+		Escalate(cmt, datastructs.ModerationRejected)
+	case PIIModeFlag:
+		Escalate(cmt, datastructs.ModerationFlagged)
+	default:
+		cmt.ProcessedBody = redacted
+	}
+	return nil
+}
+
+// ValidPIIMode - whether the mode is one the PII stage understands
+func ValidPIIMode(mode string) bool {
+	return mode == PIIModeRedact || mode == PIIModeReject || mode == PIIModeFlag
+}
+
+// RedactPII - replaces personal information in the text with a
+// placeholder and returns which categories were found, sorted
+func RedactPII(text string) (string, []string) {
+	found := map[string]bool{}
+
+	// Cards first, a card number would otherwise look like a phone number
+	text = cardPattern.ReplaceAllStringFunc(text, func(match string) string {
+		if !LuhnValid(match) {
+			return match
+		}
+		found[PIICreditCard] = true
+		return "[credit card removed]"
+	})
+
+	text = emailPattern.ReplaceAllStringFunc(text, func(match string) string {
+		found[PIIEmail] = true
+		return "[email removed]"
+	})
+
+	text = phonePattern.ReplaceAllStringFunc(text, func(match string) string {
+		digits := countDigits(match)
+		if digits < 10 || digits > 15 {
+			return match
+		}
+		found[PIIPhone] = true
+		return "[phone removed]"
+	})
+
+	categories := make([]string, 0, len(found))
+	for c := range found {
+		categories = append(categories, c)
+	}
+	sort.Strings(categories)
+	return text, categories
+}
+
+// LuhnValid - checks the digits in s against the Luhn checksum
+// used by card numbers, anything that is not a digit is skipped
+func LuhnValid(s string) bool {
+	sum := 0
+	double := false
+	digits := 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := rune(s[i])
+		if !unicode.IsDigit(c) {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+		digits++
+	}
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
+
+func countDigits(s string) int {
+	return len(strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s))
+}
@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePIIStore struct {
+	mode string
+}
+
+func (f *fakePIIStore) GetPIISettings(_ context.Context, site string) (datastructs.PIISettings, error) {
+	return datastructs.PIISettings{Site: site, Mode: f.mode}, nil
+}
+
+func TestRedactPII(t *testing.T) {
+
+	t.Run("redacts each category", func(t *testing.T) {
+		text, categories := RedactPII("mail me at jane.doe@example.com or call +1 (555) 123-4567, card 4111 1111 1111 1111")
+		assert.Equal(t, "mail me at [email removed] or call [phone removed], card [credit card removed]", text)
+		assert.Equal(t, []string{PIICreditCard, PIIEmail, PIIPhone}, categories)
+	})
+
+	t.Run("leaves numbers that fail the luhn check as cards", func(t *testing.T) {
+		assert.True(t, LuhnValid("4111-1111-1111-1111"))
+		assert.False(t, LuhnValid("4111-1111-1111-1112"))
+
+		_, categories := RedactPII("order 1234 5678 9012 3456 7 shipped")
+		assert.NotContains(t, categories, PIICreditCard)
+	})
+
+	t.Run("ignores short numbers", func(t *testing.T) {
+		text, categories := RedactPII("Go 1.20 came out in 2023 with 42 changes")
+		assert.Equal(t, "Go 1.20 came out in 2023 with 42 changes", text)
+		assert.Empty(t, categories)
+	})
+}
+
+func TestPIIStage(t *testing.T) {
+	body := "reach me at jane@example.com"
+
+	for mode, want := range map[string]string{
+		PIIModeRedact: datastructs.ModerationApproved,
+		PIIModeFlag:   datastructs.ModerationFlagged,
+		PIIModeReject: datastructs.ModerationRejected,
+	} {
+		t.Run(mode, func(t *testing.T) {
+			p, _ := NewProcessor(NewPIIStage(&fakePIIStore{mode: mode}))
+
+			cmt, err := p.ProcessComment(context.Background(), datastructs.Comment{Body: body})
+			assert.NoError(t, err)
+			assert.Equal(t, want, cmt.ModerationStatus)
+			assert.Equal(t, []string{PIIEmail}, cmt.PIICategories)
+			assert.Equal(t, body, cmt.Body)
+			if mode == PIIModeRedact {
+				assert.Equal(t, "reach me at [email removed]", cmt.ProcessedBody)
+			} else {
+				assert.Equal(t, body, cmt.ProcessedBody)
+			}
+		})
+	}
+}
@@ -3,103 +3,89 @@ package processor
 import (
 	"context"
 	"fmt"
+	"time"
 
-	//python3 "github.com/go-python/cpy3"
 	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
 )
 
 type ProcessStatus int
 
 const (
-	Failed      ProcessStatus = iota - 2 // -1
-	Processing                = iota     // 0
-	Processed                 = iota     // 1
-	UnProcessed               = iota     // 2
+	Failed      ProcessStatus = iota - 1 // -1
+	Processing                           // 0
+	Processed                            // 1
+	UnProcessed                          // 2
 )
 
-// Returns any type interface for our processor 
-// so any module can call this code
+// name is the Tracer name used to identify this instrumentation library.
+const name = "processor"
+
+// Stage - a single step of comment processing
+// Stages run in order and may change the processed
+// fields and moderation status of the comment
+type Stage interface {
+	Name() string
+	Process(ctx context.Context, cmt *datastructs.Comment) error
+}
+
+// PService - runs a comment through all of its stages
 type PService struct {
-	processor interface{}
+	stages []Stage
 }
 
 // Any code can call the process comment function when a NewProcessor is made
-func NewProcessor() (*PService, error) {
-
-	var any interface{}
+func NewProcessor(stages ...Stage) (*PService, error) {
 	return &PService{
-		processor: any,
+		stages: stages,
 	}, nil
 }
 
-type ProcessedComment struct {
-	ID               string
-	Processed_Slug   string
-	Processed_Body   string
-	Processed_Author string
-}
-
-// Takes in a PService and updates its values with the valid uuid
-// In a production environment never let user input be executed with eval
-// for demo purposes only
+// ProcessComment - runs every stage against the comment and
+// returns the comment with its processed fields filled in
 func (w *PService) ProcessComment(
 	ctx context.Context,
 	cmt datastructs.Comment) (datastructs.Comment, error) {
 
-	//defer python3.Py_Finalize()
-	//python3.Py_Initialize()
-	
-
-	var pcmt ProcessedComment
-	var err error
-	if err != nil {
-		fmt.Println("Failed to connect")
-		return datastructs.Comment{}, err
-	}
-
-	//var processed interface{}
-
-	//processed = python3.PyRun_SimpleString("print('hello world')")
-	pcmt.Processed_Author = fmt.Sprintf("%v", "processed")
-	pcmt.Processed_Body = fmt.Sprintf("%v", "processed")
-	pcmt.Processed_Slug = fmt.Sprintf("%v", "processed")
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(ctx, "ProcessComment", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
 
-	newCmt := datastructs.Comment{
-		ID:     cmt.ID,
-		Slug:   pcmt.Processed_Slug,
-		Body:   pcmt.Processed_Body,
-		Author: pcmt.Processed_Author,
+	cmt.ProcessStatus = int(Processing)
+	cmt.ProcessedBody = cmt.Body
+	if cmt.ModerationStatus == "" {
+		cmt.ModerationStatus = datastructs.ModerationApproved
 	}
 
-
-	/*
-	if err != nil {
-		fmt.Println("Failed to process data")
-		return datastructs.Comment{}, err
+	for _, stage := range w.stages {
+		if err := stage.Process(ctx, &cmt); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			cmt.ProcessStatus = int(Failed)
+			return cmt, fmt.Errorf("processing stage %s failed: %w", stage.Name(), err)
+		}
 	}
-	pcmt.Processed_Author = fmt.Sprintf("%v", processed)
 
-	processed, err = w.client.Eval("pi")
-	if err != nil {
-		fmt.Println("Failed to process data")
-		return datastructs.Comment{}, err
-	}
-	pcmt.Processed_Body = fmt.Sprintf("%v", processed)
+	cmt.ProcessStatus = int(Processed)
+	return cmt, nil
+}
 
-	processed, err = w.client.Eval("pi")
-	if err != nil {
-		fmt.Println("Failed to process data")
-		return datastructs.Comment{}, err
-	}
-	pcmt.Processed_Slug = fmt.Sprintf("%v", processed)
+// moderationSeverity - how strongly each moderation
+// status keeps a comment away from readers
+var moderationSeverity = map[string]int{
+	datastructs.ModerationApproved: 0,
+	datastructs.ModerationFlagged:  1,
+	datastructs.ModerationHeld:     2,
+	datastructs.ModerationSpam:     3,
+	datastructs.ModerationRejected: 4,
+}
 
-	newCmt := datastructs.Comment{
-		ID:     cmt.ID,
-		Slug:   pcmt.Processed_Slug,
-		Body:   pcmt.Processed_Body,
-		Author: pcmt.Processed_Author,
+// Escalate - moves the comment to the given moderation status
+// unless an earlier stage already put it somewhere stricter
+func Escalate(cmt *datastructs.Comment, status string) {
+	if moderationSeverity[status] > moderationSeverity[cmt.ModerationStatus] {
+		cmt.ModerationStatus = status
 	}
-	*/
-
-	return newCmt, nil
 }
@@ -0,0 +1,268 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrInvalidRule = errors.New("invalid rule")
+)
+
+// ruleActions - maps a rule action to the
+// moderation status it puts the comment in
+var ruleActions = map[string]string{
+	"flag":   datastructs.ModerationFlagged,
+	"hold":   datastructs.ModerationHeld,
+	"spam":   datastructs.ModerationSpam,
+	"reject": datastructs.ModerationRejected,
+}
+
+// RuleStore - what the rule stage needs from the database
+type RuleStore interface {
+	GetEnabledRules(context.Context) ([]datastructs.Rule, error)
+	IncrementRuleHits(context.Context, string) error
+	GetAuthorFirstSeen(context.Context, string) (time.Time, error)
+}
+
+// RuleStage - applies the moderation rules stored
+// in the database to every comment
+type RuleStage struct {
+	Store RuleStore
+
+	mu sync.Mutex
+	// compiled - the rules as last loaded, by id, so each
+	// is only compiled again once it has been changed
+	compiled map[string]CompiledRule
+}
+
+func NewRuleStage(store RuleStore) *RuleStage {
+	return &RuleStage{
+		Store:    store,
+		compiled: map[string]CompiledRule{},
+	}
+}
+
+func (r *RuleStage) Name() string {
+	return "rules"
+}
+
+func (r *RuleStage) Process(ctx context.Context, cmt *datastructs.Comment) error {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(ctx, "RuleStage", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	rules, err := r.Store.GetEnabledRules(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	authorAge, err := AuthorAge(ctx, r.Store, *cmt)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	for _, rule := range r.load(rules) {
+		if !rule.Matches(*cmt, authorAge) {
+			continue
+		}
+
+		Escalate(cmt, ruleActions[rule.Action])
+		if err := r.Store.IncrementRuleHits(ctx, rule.ID); err != nil {
+			span.RecordError(err)
+			fmt.Printf("failed to count hit for rule %s: %v\n", rule.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// load - compiles the rules that are new or have changed since they
+// were last loaded and forgets those no longer enabled. A broken rule
+// should not stop every comment from being processed, so it is skipped
+func (r *RuleStage) load(rules []datastructs.Rule) []CompiledRule {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	loaded := make([]CompiledRule, 0, len(rules))
+	compiled := make(map[string]CompiledRule, len(rules))
+	for _, rule := range rules {
+		c, ok := r.compiled[rule.ID]
+		if !ok || !sameRule(c.Rule, rule) {
+			var err error
+			c, err = CompileRule(rule)
+			if err != nil {
+				fmt.Printf("skipping rule %s: %v\n", rule.ID, err)
+				continue
+			}
+		}
+		compiled[rule.ID] = c
+		loaded = append(loaded, c)
+	}
+	r.compiled = compiled
+	return loaded
+}
+
+func sameRule(a, b datastructs.Rule) bool {
+	if a.Action != b.Action || len(a.Conditions) != len(b.Conditions) {
+		return false
+	}
+	for i := range a.Conditions {
+		if a.Conditions[i] != b.Conditions[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// AuthorAge - how long the author had been commenting
+// when this comment was written
+func AuthorAge(ctx context.Context, store RuleStore, cmt datastructs.Comment) (time.Duration, error) {
+	firstSeen, err := store.GetAuthorFirstSeen(ctx, cmt.Author)
+	if err != nil {
+		return 0, err
+	}
+
+	postedAt := cmt.CreatedAt
+	if postedAt.IsZero() {
+		postedAt = time.Now()
+	}
+	if firstSeen.IsZero() || firstSeen.After(postedAt) {
+		return 0, nil
+	}
+	return postedAt.Sub(firstSeen), nil
+}
+
+// ValidateRule - checks a rule can be evaluated before it is saved
+func ValidateRule(rule datastructs.Rule) error {
+	if strings.TrimSpace(rule.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidRule)
+	}
+	if _, ok := ruleActions[rule.Action]; !ok {
+		return fmt.Errorf("%w: unknown action %q", ErrInvalidRule, rule.Action)
+	}
+	if len(rule.Conditions) == 0 {
+		return fmt.Errorf("%w: at least one condition is required", ErrInvalidRule)
+	}
+	_, err := CompileRule(rule)
+	return err
+}
+
+// CompiledRule - a rule with its regular expressions and
+// durations parsed, ready to be matched against comments
+type CompiledRule struct {
+	datastructs.Rule
+	conditions []compiledCondition
+}
+
+type compiledCondition struct {
+	datastructs.RuleCondition
+	re    *regexp.Regexp
+	limit time.Duration
+}
+
+// CompileRule - parses every condition of the rule once, so
+// matching it against a comment can not fail
+func CompileRule(rule datastructs.Rule) (CompiledRule, error) {
+	compiled := CompiledRule{Rule: rule}
+	for _, cond := range rule.Conditions {
+		c, err := compileCondition(cond)
+		if err != nil {
+			return CompiledRule{}, fmt.Errorf("%w: %v", ErrInvalidRule, err)
+		}
+		compiled.conditions = append(compiled.conditions, c)
+	}
+	return compiled, nil
+}
+
+func compileCondition(cond datastructs.RuleCondition) (compiledCondition, error) {
+	c := compiledCondition{RuleCondition: cond}
+	switch cond.Field {
+	case "body", "author", "slug":
+		switch cond.Op {
+		case "matches", "not_matches":
+			re, err := regexp.Compile(cond.Value)
+			if err != nil {
+				return c, fmt.Errorf("bad regular expression: %w", err)
+			}
+			c.re = re
+		case "contains", "equals":
+		default:
+			return c, fmt.Errorf("unknown operator %q for %s", cond.Op, cond.Field)
+		}
+		return c, nil
+	case "author_age":
+		limit, err := time.ParseDuration(cond.Value)
+		if err != nil {
+			return c, fmt.Errorf("author_age needs a duration like 24h: %w", err)
+		}
+		if cond.Op != "lt" && cond.Op != "gt" {
+			return c, fmt.Errorf("unknown operator %q for author_age", cond.Op)
+		}
+		c.limit = limit
+		return c, nil
+	}
+	return c, fmt.Errorf("unknown field %q", cond.Field)
+}
+
+// Matches - returns true when every condition of the rule matches
+func (r CompiledRule) Matches(cmt datastructs.Comment, authorAge time.Duration) bool {
+	if len(r.conditions) == 0 {
+		return false
+	}
+	for _, cond := range r.conditions {
+		if !cond.matches(cmt, authorAge) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c compiledCondition) matches(cmt datastructs.Comment, authorAge time.Duration) bool {
+	switch c.Field {
+	case "body":
+		return c.matchString(cmt.Body)
+	case "author":
+		return c.matchString(cmt.Author)
+	case "slug":
+		return c.matchString(cmt.Slug)
+	case "author_age":
+		if c.Op == "lt" {
+			return authorAge < c.limit
+		}
+		return authorAge > c.limit
+	}
+	return false
+}
+
+func (c compiledCondition) matchString(value string) bool {
+	switch c.Op {
+	case "matches":
+		return c.re.MatchString(value)
+	case "not_matches":
+		return !c.re.MatchString(value)
+	case "contains":
+		return strings.Contains(strings.ToLower(value), strings.ToLower(c.Value))
+	case "equals":
+		return value == c.Value
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package processor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRuleStore struct {
+	rules     []datastructs.Rule
+	firstSeen time.Time
+	hits      map[string]int
+}
+
+func (f *fakeRuleStore) GetEnabledRules(context.Context) ([]datastructs.Rule, error) {
+	return f.rules, nil
+}
+
+func (f *fakeRuleStore) IncrementRuleHits(_ context.Context, id string) error {
+	f.hits[id]++
+	return nil
+}
+
+func (f *fakeRuleStore) GetAuthorFirstSeen(context.Context, string) (time.Time, error) {
+	return f.firstSeen, nil
+}
+
+func TestRuleStage(t *testing.T) {
+
+	newAccountSpam := datastructs.Rule{
+		ID:     "new-account-links",
+		Name:   "links from new accounts",
+		Action: "hold",
+		Conditions: []datastructs.RuleCondition{
+			{Field: "body", Op: "matches", Value: `https?://`},
+			{Field: "author_age", Op: "lt", Value: "24h"},
+		},
+	}
+
+	t.Run("holds matching comments and counts the hit", func(t *testing.T) {
+		store := &fakeRuleStore{
+			rules:     []datastructs.Rule{newAccountSpam},
+			firstSeen: time.Now().Add(-time.Hour),
+			hits:      map[string]int{},
+		}
+		p, _ := NewProcessor(NewRuleStage(store))
+
+		cmt, err := p.ProcessComment(context.Background(), datastructs.Comment{
+			Body:      "visit http://example.com",
+			CreatedAt: time.Now(),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, datastructs.ModerationHeld, cmt.ModerationStatus)
+		assert.Equal(t, int(Processed), cmt.ProcessStatus)
+		assert.Equal(t, 1, store.hits["new-account-links"])
+	})
+
+	t.Run("leaves older authors alone", func(t *testing.T) {
+		store := &fakeRuleStore{
+			rules:     []datastructs.Rule{newAccountSpam},
+			firstSeen: time.Now().Add(-48 * time.Hour),
+			hits:      map[string]int{},
+		}
+		p, _ := NewProcessor(NewRuleStage(store))
+
+		cmt, err := p.ProcessComment(context.Background(), datastructs.Comment{
+			Body:      "visit http://example.com",
+			CreatedAt: time.Now(),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, datastructs.ModerationApproved, cmt.ModerationStatus)
+		assert.Equal(t, 0, store.hits["new-account-links"])
+	})
+
+	t.Run("compiles a rule once until it is changed", func(t *testing.T) {
+		store := &fakeRuleStore{rules: []datastructs.Rule{newAccountSpam}}
+		stage := NewRuleStage(store)
+
+		first := stage.load(store.rules)
+		again := stage.load(store.rules)
+		assert.Same(t, first[0].conditions[0].re, again[0].conditions[0].re)
+
+		changed := newAccountSpam
+		changed.Conditions = []datastructs.RuleCondition{{Field: "body", Op: "matches", Value: `casino`}}
+		loaded := stage.load([]datastructs.Rule{changed})
+		assert.Equal(t, "casino", loaded[0].conditions[0].re.String())
+	})
+
+	t.Run("skips broken rules and forgets removed ones", func(t *testing.T) {
+		broken := datastructs.Rule{ID: "broken", Action: "spam",
+			Conditions: []datastructs.RuleCondition{{Field: "body", Op: "matches", Value: "("}}}
+		stage := NewRuleStage(&fakeRuleStore{})
+
+		loaded := stage.load([]datastructs.Rule{broken, newAccountSpam})
+		assert.Len(t, loaded, 1)
+		assert.Equal(t, "new-account-links", loaded[0].ID)
+
+		stage.load(nil)
+		assert.Empty(t, stage.compiled)
+	})
+}
+
+func TestValidateRule(t *testing.T) {
+	assert.NoError(t, ValidateRule(datastructs.Rule{
+		Name:       "casino",
+		Action:     "spam",
+		Conditions: []datastructs.RuleCondition{{Field: "body", Op: "contains", Value: "casino"}},
+	}))
+
+	assert.ErrorIs(t, ValidateRule(datastructs.Rule{
+		Name:       "bad regex",
+		Action:     "spam",
+		Conditions: []datastructs.RuleCondition{{Field: "body", Op: "matches", Value: "("}},
+	}), ErrInvalidRule)
+
+	assert.ErrorIs(t, ValidateRule(datastructs.Rule{
+		Name:       "bad operator",
+		Action:     "spam",
+		Conditions: []datastructs.RuleCondition{{Field: "author_age", Op: "contains", Value: "24h"}},
+	}), ErrInvalidRule)
+
+	assert.ErrorIs(t, ValidateRule(datastructs.Rule{
+		Name:       "bad action",
+		Action:     "explode",
+		Conditions: []datastructs.RuleCondition{{Field: "body", Op: "contains", Value: "x"}},
+	}), ErrInvalidRule)
+}
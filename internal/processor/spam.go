@@ -0,0 +1,217 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrInvalidSpamModel = errors.New("invalid spam model")
+)
+
+// DefaultSpamThreshold - comments scoring at or above
+// this are sent straight to spam
+const DefaultSpamThreshold = 0.9
+
+// SpamModel - the token counts a naive Bayes classifier
+// is built from, this is what gets exported and imported
+type SpamModel struct {
+	SpamDocs   int            `json:"spam_docs"`
+	HamDocs    int            `json:"ham_docs"`
+	SpamTokens int            `json:"spam_tokens"`
+	HamTokens  int            `json:"ham_tokens"`
+	SpamCounts map[string]int `json:"spam_counts"`
+	HamCounts  map[string]int `json:"ham_counts"`
+}
+
+// SpamClassifier - a multinomial naive Bayes classifier,
+// safe to score with while it is being retrained
+type SpamClassifier struct {
+	mu    sync.RWMutex
+	model SpamModel
+}
+
+func NewSpamClassifier() *SpamClassifier {
+	return &SpamClassifier{
+		model: emptySpamModel(),
+	}
+}
+
+func emptySpamModel() SpamModel {
+	return SpamModel{
+		SpamCounts: map[string]int{},
+		HamCounts:  map[string]int{},
+	}
+}
+
+// Train - replaces the model with one built from the given examples
+func (c *SpamClassifier) Train(examples []datastructs.TrainingExample) {
+	model := emptySpamModel()
+	for _, ex := range examples {
+		tokens := Tokenize(ex.Body)
+		if ex.IsSpam {
+			model.SpamDocs++
+			model.SpamTokens += len(tokens)
+			for _, t := range tokens {
+				model.SpamCounts[t]++
+			}
+		} else {
+			model.HamDocs++
+			model.HamTokens += len(tokens)
+			for _, t := range tokens {
+				model.HamCounts[t]++
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.model = model
+}
+
+// Trained - a model needs examples of both classes to score anything
+func (c *SpamClassifier) Trained() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.model.SpamDocs > 0 && c.model.HamDocs > 0
+}
+
+// Score - the probability the text is spam, 0 while the model is untrained
+func (c *SpamClassifier) Score(text string) float64 {
+	if !c.Trained() {
+		return 0
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	m := c.model
+
+	// Laplace smoothing over the combined vocabulary
+	vocab := len(m.SpamCounts)
+	for t := range m.HamCounts {
+		if _, ok := m.SpamCounts[t]; !ok {
+			vocab++
+		}
+	}
+
+	totalDocs := float64(m.SpamDocs + m.HamDocs)
+	logSpam := math.Log(float64(m.SpamDocs) / totalDocs)
+	logHam := math.Log(float64(m.HamDocs) / totalDocs)
+	for _, t := range Tokenize(text) {
+		logSpam += math.Log(float64(m.SpamCounts[t]+1) / float64(m.SpamTokens+vocab))
+		logHam += math.Log(float64(m.HamCounts[t]+1) / float64(m.HamTokens+vocab))
+	}
+
+	return 1 / (1 + math.Exp(logHam-logSpam))
+}
+
+// Export - a copy of the current model
+func (c *SpamClassifier) Export() SpamModel {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	model := SpamModel{
+		SpamDocs:   c.model.SpamDocs,
+		HamDocs:    c.model.HamDocs,
+		SpamTokens: c.model.SpamTokens,
+		HamTokens:  c.model.HamTokens,
+		SpamCounts: make(map[string]int, len(c.model.SpamCounts)),
+		HamCounts:  make(map[string]int, len(c.model.HamCounts)),
+	}
+	for t, n := range c.model.SpamCounts {
+		model.SpamCounts[t] = n
+	}
+	for t, n := range c.model.HamCounts {
+		model.HamCounts[t] = n
+	}
+	return model
+}
+
+// Import - replaces the current model after checking it is consistent
+func (c *SpamClassifier) Import(model SpamModel) error {
+	if model.SpamDocs < 0 || model.HamDocs < 0 || model.SpamTokens < 0 || model.HamTokens < 0 {
+		return ErrInvalidSpamModel
+	}
+	if model.SpamCounts == nil {
+		model.SpamCounts = map[string]int{}
+	}
+	if model.HamCounts == nil {
+		model.HamCounts = map[string]int{}
+	}
+	for _, n := range model.SpamCounts {
+		if n < 0 {
+			return ErrInvalidSpamModel
+		}
+	}
+	for _, n := range model.HamCounts {
+		if n < 0 {
+			return ErrInvalidSpamModel
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.model = model
+	return nil
+}
+
+// Tokenize - lower cased words and numbers, urls keep
+// their host so link spam is easy to pick up on
+func Tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '.' && r != '$'
+	})
+
+	tokens := make([]string, 0, len(fields))
+	for _, f := range fields {
+		f = strings.Trim(f, ".")
+		if len(f) < 2 || len(f) > 40 {
+			continue
+		}
+		tokens = append(tokens, f)
+	}
+	return tokens
+}
+
+// SpamStage - scores every comment and routes
+// anything over the threshold to spam
+type SpamStage struct {
+	Classifier *SpamClassifier
+	Threshold  float64
+}
+
+func NewSpamStage(classifier *SpamClassifier, threshold float64) *SpamStage {
+	return &SpamStage{
+		Classifier: classifier,
+		Threshold:  threshold,
+	}
+}
+
+func (s *SpamStage) Name() string {
+	return "spam"
+}
+
+func (s *SpamStage) Process(ctx context.Context, cmt *datastructs.Comment) error {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "SpamStage", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	cmt.SpamScore = s.Classifier.Score(cmt.Body)
+	span.SetAttributes(attribute.Float64("spam.score", cmt.SpamScore))
+
+	if cmt.SpamScore >= s.Threshold {
+		Escalate(cmt, datastructs.ModerationSpam)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package processor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpamClassifier(t *testing.T) {
+
+	examples := []datastructs.TrainingExample{
+		{Body: "cheap pills buy now at pills.example", IsSpam: true},
+		{Body: "win free money casino bonus buy now", IsSpam: true},
+		{Body: "free casino spins click here", IsSpam: true},
+		{Body: "great article, thanks for the clear explanation", IsSpam: false},
+		{Body: "I disagree with the second point about interfaces", IsSpam: false},
+		{Body: "thanks, this helped me fix my build", IsSpam: false},
+	}
+
+	t.Run("untrained classifier scores nothing", func(t *testing.T) {
+		c := NewSpamClassifier()
+		assert.Equal(t, 0.0, c.Score("free casino money"))
+	})
+
+	t.Run("separates spam from ham", func(t *testing.T) {
+		c := NewSpamClassifier()
+		c.Train(examples)
+
+		assert.Greater(t, c.Score("free casino bonus, buy now"), 0.9)
+		assert.Less(t, c.Score("thanks for the explanation"), 0.1)
+	})
+
+	t.Run("spam stage routes high scores to spam", func(t *testing.T) {
+		c := NewSpamClassifier()
+		c.Train(examples)
+		p, _ := NewProcessor(NewSpamStage(c, DefaultSpamThreshold))
+
+		cmt, err := p.ProcessComment(context.Background(), datastructs.Comment{Body: "free casino bonus buy now"})
+		assert.NoError(t, err)
+		assert.Equal(t, datastructs.ModerationSpam, cmt.ModerationStatus)
+	})
+
+	t.Run("export and import round trip", func(t *testing.T) {
+		c := NewSpamClassifier()
+		c.Train(examples)
+
+		other := NewSpamClassifier()
+		assert.NoError(t, other.Import(c.Export()))
+		assert.InDelta(t, c.Score("free casino"), other.Score("free casino"), 1e-9)
+
+		assert.ErrorIs(t, other.Import(SpamModel{SpamDocs: -1}), ErrInvalidSpamModel)
+	})
+}
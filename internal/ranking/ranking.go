@@ -0,0 +1,40 @@
+package ranking
+
+// Scores used to order comments, they are worked out from a
+// comment's votes and stored with it so sorting can use an index
+
+import "math"
+
+// wilsonZ - the z score for a 95% confidence interval
+const wilsonZ = 1.96
+
+// Score - up votes minus down votes, used by the "top" sort
+func Score(ups, downs int) int {
+	return ups - downs
+}
+
+// WilsonScore - the lower bound of the Wilson score interval for the
+// share of up votes, a few votes count for less than many, used by "best"
+func WilsonScore(ups, downs int) float64 {
+	n := float64(ups + downs)
+	if n == 0 {
+		return 0
+	}
+	p := float64(ups) / n
+	z2 := wilsonZ * wilsonZ
+	return (p + z2/(2*n) - wilsonZ*math.Sqrt((p*(1-p)+z2/(4*n))/n)) / (1 + z2/n)
+}
+
+// Controversy - high when there are many votes split evenly
+// between up and down, zero when every vote agrees
+func Controversy(ups, downs int) float64 {
+	if ups <= 0 || downs <= 0 {
+		return 0
+	}
+	magnitude := float64(ups + downs)
+	balance := float64(ups) / float64(downs)
+	if ups > downs {
+		balance = float64(downs) / float64(ups)
+	}
+	return math.Pow(magnitude, balance)
+}
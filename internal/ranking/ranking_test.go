@@ -0,0 +1,32 @@
+package ranking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWilsonScore(t *testing.T) {
+	assert.Equal(t, 0.0, WilsonScore(0, 0))
+
+	t.Run("many votes beat a few with the same share", func(t *testing.T) {
+		assert.Greater(t, WilsonScore(90, 10), WilsonScore(9, 1))
+	})
+
+	t.Run("a single up vote is not a perfect score", func(t *testing.T) {
+		assert.Less(t, WilsonScore(1, 0), WilsonScore(50, 5))
+	})
+}
+
+func TestControversy(t *testing.T) {
+	assert.Equal(t, 0.0, Controversy(10, 0))
+	assert.Equal(t, 0.0, Controversy(0, 10))
+
+	t.Run("an even split beats a one sided vote", func(t *testing.T) {
+		assert.Greater(t, Controversy(50, 50), Controversy(90, 10))
+	})
+
+	t.Run("more votes beat fewer with the same split", func(t *testing.T) {
+		assert.Greater(t, Controversy(50, 50), Controversy(5, 5))
+	})
+}
@@ -0,0 +1,116 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// DefaultSaveInterval - how often the index file is brought up to date
+const DefaultSaveInterval = 5 * time.Minute
+
+// LoadFile - loads an index written by SaveFile, or rebuilds it from
+// the store when there is no file at path yet, it can not be read or
+// comments have changed since it was written, as they can while the
+// server is stopped
+func (idx *Index) LoadFile(ctx context.Context, path string, store Store) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return idx.rebuildFile(ctx, path, store)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open search index: %w", err)
+	}
+	defer f.Close()
+
+	if err := idx.Load(f); err != nil {
+		log.Print(err)
+		return idx.rebuildFile(ctx, path, store)
+	}
+	position, err := store.OutboxPosition(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check search index: %w", err)
+	}
+	if position > idx.outboxPosition() {
+		return idx.rebuildFile(ctx, path, store)
+	}
+	return nil
+}
+
+func (idx *Index) rebuildFile(ctx context.Context, path string, store Store) error {
+	if err := idx.Rebuild(ctx, store); err != nil {
+		return err
+	}
+	return idx.SaveFile(path)
+}
+
+// SaveEvery - saves the index to path whenever it has changed, every
+// interval, until the context is cancelled and once more after that.
+// Events take a moment to reach the index, so the outbox position
+// read at one save is only counted as indexed from the next on
+func (idx *Index) SaveEvery(ctx context.Context, path string, store Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	saved := idx.changeCount()
+	save := func() {
+		changes := idx.changeCount()
+		if changes == saved {
+			return
+		}
+		if err := idx.SaveFile(path); err != nil {
+			log.Print(err)
+			return
+		}
+		saved = changes
+	}
+	position, err := store.OutboxPosition(ctx)
+	if err != nil {
+		log.Print(err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			save()
+			return
+		case <-ticker.C:
+			idx.advance(position)
+			save()
+			if next, err := store.OutboxPosition(ctx); err != nil {
+				log.Print(err)
+			} else {
+				position = next
+			}
+		}
+	}
+}
+
+func (idx *Index) changeCount() uint64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.changes
+}
+
+// SaveFile - writes the index to path, replacing the old file
+// only once the new one has been written in full
+func (idx *Index) SaveFile(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create search index: %w", err)
+	}
+
+	if err := idx.Save(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write search index: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write search index: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,139 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStore - comments and the outbox position of their latest change
+type fakeStore struct {
+	cmts     []datastructs.Comment
+	position int64
+	scans    int
+}
+
+func (s *fakeStore) ScanComments(ctx context.Context, fn func(datastructs.Comment) error) error {
+	s.scans++
+	for _, cmt := range s.cmts {
+		if err := fn(cmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) OutboxPosition(ctx context.Context) (int64, error) {
+	return atomic.LoadInt64(&s.position), nil
+}
+
+func TestIndexFile(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("rebuilds when comments changed after the file was saved", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "search.index")
+		store := &fakeStore{cmts: []datastructs.Comment{{ID: "1", ProcessedBody: "garbage collector"}}, position: 1}
+		require.NoError(t, NewIndex().LoadFile(ctx, path, store))
+		assert.Equal(t, 1, store.scans)
+
+		// Nothing changed, the file is loaded
+		idx := NewIndex()
+		require.NoError(t, idx.LoadFile(ctx, path, store))
+		assert.Equal(t, 1, store.scans)
+		assert.Equal(t, 1, idx.Len())
+
+		// Deleted while the server was stopped
+		store.cmts, store.position = nil, 2
+		idx = NewIndex()
+		require.NoError(t, idx.LoadFile(ctx, path, store))
+		assert.Equal(t, 2, store.scans)
+		assert.Equal(t, 0, idx.Len())
+	})
+
+	t.Run("rebuilds when the file can not be read", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "search.index")
+		require.NoError(t, os.WriteFile(path, []byte("not an index"), 0o600))
+		store := &fakeStore{cmts: []datastructs.Comment{{ID: "1", ProcessedBody: "garbage collector"}}}
+		idx := NewIndex()
+		require.NoError(t, idx.LoadFile(ctx, path, store))
+		assert.Equal(t, 1, store.scans)
+		assert.Equal(t, 1, idx.Len())
+	})
+
+	t.Run("only what is searched and shown is saved", func(t *testing.T) {
+		idx := NewIndex()
+		idx.Add(datastructs.Comment{ID: "1", Author: "alice", Body: "call me on 555-0100", ProcessedBody: "call me on [phone]"})
+		var buf bytes.Buffer
+		require.NoError(t, idx.Save(&buf))
+		assert.NotContains(t, buf.String(), "555-0100")
+		assert.NotContains(t, buf.String(), "alice")
+
+		loaded := NewIndex()
+		require.NoError(t, loaded.Load(&buf))
+		res, err := loaded.SearchComments(ctx, datastructs.SearchQuery{Query: "phone"})
+		require.NoError(t, err)
+		require.Len(t, res.Results, 1)
+		assert.Equal(t, "1", res.Results[0].Comment.ID)
+	})
+
+	t.Run("saves changes and once more when stopped", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "search.index")
+		idx := NewIndex()
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			idx.SaveEvery(ctx, path, &fakeStore{}, 10*time.Millisecond)
+			close(done)
+		}()
+
+		// Unchanged, nothing to save
+		time.Sleep(30 * time.Millisecond)
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+
+		idx.Add(datastructs.Comment{ID: "1", ProcessedBody: "garbage collector"})
+		assert.Eventually(t, func() bool {
+			_, err := os.Stat(path)
+			return err == nil
+		}, time.Second, 10*time.Millisecond)
+
+		// Changed again just before stopping
+		idx.Add(datastructs.Comment{ID: "2", ProcessedBody: "pauses"})
+		cancel()
+		<-done
+
+		loaded := NewIndex()
+		f, err := os.Open(path)
+		require.NoError(t, err)
+		defer f.Close()
+		require.NoError(t, loaded.Load(f))
+		assert.Equal(t, 2, loaded.Len())
+	})
+
+	t.Run("saves the outbox position a save behind", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "search.index")
+		store := &fakeStore{position: 5}
+		idx := NewIndex()
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go idx.SaveEvery(ctx, path, store, 10*time.Millisecond)
+
+		assert.Eventually(t, func() bool {
+			f, err := os.Open(path)
+			if err != nil {
+				return false
+			}
+			defer f.Close()
+			loaded := NewIndex()
+			return loaded.Load(f) == nil && loaded.outboxPosition() == 5
+		}, time.Second, 10*time.Millisecond)
+	})
+}
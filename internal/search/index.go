@@ -0,0 +1,546 @@
+package search
+
+// An embedded inverted index over comments, used for search
+// when comments are not stored in Postgres
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+// name is the Tracer name used to identify this instrumentation library.
+const name = "search"
+
+// BM25 tuning, the usual defaults
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// DefaultIndexPath - where the index file is kept
+// when SEARCH_INDEX_PATH is not set
+const DefaultIndexPath = "search.index"
+
+// snippetWords - how many words either side of
+// the first match a snippet shows
+const snippetWords = 12
+
+// Store - where a rebuild reads every comment from
+type Store interface {
+	ScanComments(context.Context, func(datastructs.Comment) error) error
+	// OutboxPosition - the id of the latest comment event written, zero
+	// when there are none. Every change to a comment writes one, and
+	// the position never goes back even as old events are pruned
+	OutboxPosition(context.Context) (int64, error)
+}
+
+type document struct {
+	Comment datastructs.Comment
+	// Terms - every indexed term in order, positions index into this
+	Terms []string
+}
+
+// Index - an in memory inverted index of comment bodies
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[string]document
+	postings map[string]map[string][]int
+	totalLen int
+	// changes - counts every change, so unchanged indexes are not saved again
+	changes uint64
+	// position - the outbox position the index has every event up to
+	position int64
+}
+
+func NewIndex() *Index {
+	return &Index{
+		docs:     map[string]document{},
+		postings: map[string]map[string][]int{},
+	}
+}
+
+type token struct {
+	term       string
+	start, end int
+}
+
+// tokenize - lower cased runs of letters and digits with their byte offsets
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsNumber(r)
+		if isWord && start < 0 {
+			start = i
+		}
+		if !isWord && start >= 0 {
+			tokens = append(tokens, token{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{strings.ToLower(text[start:]), start, len(text)})
+	}
+	return tokens
+}
+
+// indexedText - what readers see, so redacted PII can not be searched for
+func indexedText(cmt datastructs.Comment) string {
+	if cmt.ProcessedBody != "" {
+		return cmt.ProcessedBody
+	}
+	return cmt.Body
+}
+
+// Add - indexes the comment, replacing any earlier version of it
+func (idx *Index) Add(cmt datastructs.Comment) {
+	tokens := tokenize(indexedText(cmt))
+	terms := make([]string, len(tokens))
+	for i, t := range tokens {
+		terms[i] = t.term
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.changes++
+	idx.remove(cmt.ID)
+	idx.docs[cmt.ID] = document{Comment: cmt, Terms: terms}
+	idx.totalLen += len(terms)
+	for pos, term := range terms {
+		if idx.postings[term] == nil {
+			idx.postings[term] = map[string][]int{}
+		}
+		idx.postings[term][cmt.ID] = append(idx.postings[term][cmt.ID], pos)
+	}
+}
+
+// Remove - drops the comment from the index
+func (idx *Index) Remove(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.changes++
+	idx.remove(id)
+}
+
+func (idx *Index) remove(id string) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for _, term := range doc.Terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	idx.totalLen -= len(doc.Terms)
+	delete(idx.docs, id)
+}
+
+// Len - how many comments are indexed
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// HandleCommentEvent - keeps the index in step with comment.Service
+func (idx *Index) HandleCommentEvent(ctx context.Context, evt datastructs.Event) error {
+	switch evt.Type {
+	case datastructs.EventCommentDeleted:
+		idx.Remove(evt.Comment.ID)
+	default:
+		idx.Add(evt.Comment)
+	}
+	return nil
+}
+
+// Rebuild - replaces the whole index with what is in the store
+func (idx *Index) Rebuild(ctx context.Context, store Store) error {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(ctx, "Rebuild", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	// Read first, so changes made during the scan are after it
+	position, err := store.OutboxPosition(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to rebuild search index: %w", err)
+	}
+
+	fresh := NewIndex()
+	err = store.ScanComments(ctx, func(cmt datastructs.Comment) error {
+		fresh.Add(cmt)
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to rebuild search index: %w", err)
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.docs = fresh.docs
+	idx.postings = fresh.postings
+	idx.totalLen = fresh.totalLen
+	idx.position = position
+	idx.changes++
+	return nil
+}
+
+// savedIndex - what Save writes, no more of each comment than is
+// searched and shown, so the file holds no raw bodies or authors
+type savedIndex struct {
+	Position int64
+	Comments []savedComment
+}
+
+type savedComment struct {
+	ID               string
+	Slug             string
+	ProcessedBody    string
+	CreatedAt        time.Time
+	ModerationStatus string
+}
+
+// Save - writes the indexed comments out with the outbox position
+// the index is up to, postings are rebuilt on Load. Comments are
+// searched by their raw body until they are processed, those
+// are saved without one
+func (idx *Index) Save(w io.Writer) error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	saved := savedIndex{
+		Position: idx.position,
+		Comments: make([]savedComment, 0, len(idx.docs)),
+	}
+	for _, doc := range idx.docs {
+		saved.Comments = append(saved.Comments, savedComment{
+			ID:               doc.Comment.ID,
+			Slug:             doc.Comment.Slug,
+			ProcessedBody:    doc.Comment.ProcessedBody,
+			CreatedAt:        doc.Comment.CreatedAt,
+			ModerationStatus: doc.Comment.ModerationStatus,
+		})
+	}
+	return gob.NewEncoder(w).Encode(saved)
+}
+
+// Load - replaces the index with one written by Save
+func (idx *Index) Load(r io.Reader) error {
+	var saved savedIndex
+	if err := gob.NewDecoder(r).Decode(&saved); err != nil {
+		return fmt.Errorf("failed to load search index: %w", err)
+	}
+
+	fresh := NewIndex()
+	for _, cmt := range saved.Comments {
+		fresh.Add(datastructs.Comment{
+			ID:               cmt.ID,
+			Slug:             cmt.Slug,
+			ProcessedBody:    cmt.ProcessedBody,
+			CreatedAt:        cmt.CreatedAt,
+			ModerationStatus: cmt.ModerationStatus,
+		})
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.docs = fresh.docs
+	idx.postings = fresh.postings
+	idx.totalLen = fresh.totalLen
+	idx.position = saved.Position
+	return nil
+}
+
+// advance - records that the index has every event up to the position
+func (idx *Index) advance(position int64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if position > idx.position {
+		idx.position = position
+		idx.changes++
+	}
+}
+
+func (idx *Index) outboxPosition() int64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.position
+}
+
+// SearchComments - the same search the Postgres store offers, quoted
+// phrases, OR between groups and -excluded words are supported
+func (idx *Index) SearchComments(ctx context.Context, q datastructs.SearchQuery) (datastructs.SearchResults, error) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(ctx, "SearchComments", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	groups := parseQuery(q.Query)
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	// Every match of a group has its rarest term, so only the
+	// comments in that term's postings need to be looked at
+	candidates := map[string]bool{}
+	for _, g := range groups {
+		for id := range idx.postings[idx.rarestTerm(g)] {
+			candidates[id] = true
+		}
+	}
+
+	results := []datastructs.SearchResult{}
+	for id := range candidates {
+		doc := idx.docs[id]
+		if q.Slug != "" && doc.Comment.Slug != q.Slug {
+			continue
+		}
+
+		matched := false
+		rank := 0.0
+		var highlight []string
+		for _, g := range groups {
+			if !idx.matches(id, doc, g) {
+				continue
+			}
+			matched = true
+			if score := idx.score(id, doc, g); score > rank {
+				rank = score
+			}
+			highlight = append(highlight, g.positiveTerms()...)
+		}
+		if !matched {
+			continue
+		}
+
+		results = append(results, datastructs.SearchResult{
+			Comment: doc.Comment,
+			Rank:    rank,
+			Snippet: snippet(indexedText(doc.Comment), highlight),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].Comment.CreatedAt.After(results[j].Comment.CreatedAt)
+	})
+
+	total := len(results)
+	if q.Offset >= len(results) {
+		results = []datastructs.SearchResult{}
+	} else {
+		results = results[q.Offset:]
+	}
+	if q.Limit > 0 && len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+
+	return datastructs.SearchResults{Results: results, Total: total}, nil
+}
+
+// clause - one word or quoted phrase of a query
+type clause struct {
+	terms   []string
+	exclude bool
+}
+
+// group - clauses that must all match, groups are OR'd together
+type group []clause
+
+func (g group) positiveTerms() []string {
+	var terms []string
+	for _, c := range g {
+		if !c.exclude {
+			terms = append(terms, c.terms...)
+		}
+	}
+	return terms
+}
+
+// parseQuery - splits a websearch style query into OR'd groups
+func parseQuery(query string) []group {
+	var groups []group
+	var current group
+	for len(query) > 0 {
+		query = strings.TrimLeftFunc(query, unicode.IsSpace)
+		if query == "" {
+			break
+		}
+
+		exclude := false
+		if query[0] == '-' {
+			exclude = true
+			query = query[1:]
+		}
+
+		var raw string
+		if strings.HasPrefix(query, `"`) {
+			end := strings.Index(query[1:], `"`)
+			if end < 0 {
+				raw, query = query[1:], ""
+			} else {
+				raw, query = query[1:end+1], query[end+2:]
+			}
+		} else {
+			end := strings.IndexFunc(query, unicode.IsSpace)
+			if end < 0 {
+				raw, query = query, ""
+			} else {
+				raw, query = query[:end], query[end:]
+			}
+			if raw == "OR" && !exclude {
+				if len(current) > 0 {
+					groups = append(groups, current)
+				}
+				current = nil
+				continue
+			}
+		}
+
+		var terms []string
+		for _, t := range tokenize(raw) {
+			terms = append(terms, t.term)
+		}
+		if len(terms) > 0 {
+			current = append(current, clause{terms: terms, exclude: exclude})
+		}
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+
+	// A group of only exclusions would match nearly everything
+	valid := groups[:0]
+	for _, g := range groups {
+		if len(g.positiveTerms()) > 0 {
+			valid = append(valid, g)
+		}
+	}
+	return valid
+}
+
+// rarestTerm - the group's positive term in the fewest comments, or
+// one in none when there is one as then the group matches nothing
+func (idx *Index) rarestTerm(g group) string {
+	rarest := ""
+	for i, term := range g.positiveTerms() {
+		if i == 0 || len(idx.postings[term]) < len(idx.postings[rarest]) {
+			rarest = term
+		}
+	}
+	return rarest
+}
+
+func (idx *Index) matches(id string, doc document, g group) bool {
+	for _, c := range g {
+		if idx.containsPhrase(id, c.terms) == c.exclude {
+			return false
+		}
+	}
+	return true
+}
+
+// containsPhrase - whether the terms appear next to each other in the document
+func (idx *Index) containsPhrase(id string, terms []string) bool {
+	first := idx.postings[terms[0]][id]
+	for _, start := range first {
+		found := true
+		for i := 1; i < len(terms); i++ {
+			if !containsInt(idx.postings[terms[i]][id], start+i) {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(positions []int, want int) bool {
+	i := sort.SearchInts(positions, want)
+	return i < len(positions) && positions[i] == want
+}
+
+// score - BM25 over the positive terms of the group
+func (idx *Index) score(id string, doc document, g group) float64 {
+	n := float64(len(idx.docs))
+	avgLen := float64(idx.totalLen) / math.Max(n, 1)
+	docLen := float64(len(doc.Terms))
+
+	score := 0.0
+	for _, term := range g.positiveTerms() {
+		df := float64(len(idx.postings[term]))
+		tf := float64(len(idx.postings[term][id]))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*docLen/math.Max(avgLen, 1)))
+	}
+	return score
+}
+
+// snippet - a window of the text around the first matching word,
+// escaped, with matching words wrapped in <mark>
+func snippet(text string, terms []string) string {
+	want := map[string]bool{}
+	for _, t := range terms {
+		want[t] = true
+	}
+
+	tokens := tokenize(text)
+	first := 0
+	for i, t := range tokens {
+		if want[t.term] {
+			first = i
+			break
+		}
+	}
+	if len(tokens) == 0 {
+		return html.EscapeString(text)
+	}
+
+	from := first - snippetWords
+	if from < 0 {
+		from = 0
+	}
+	to := first + snippetWords
+	if to >= len(tokens) {
+		to = len(tokens) - 1
+	}
+
+	var b strings.Builder
+	pos := tokens[from].start
+	for _, t := range tokens[from : to+1] {
+		b.WriteString(html.EscapeString(text[pos:t.start]))
+		if want[t.term] {
+			b.WriteString("<mark>" + html.EscapeString(text[t.start:t.end]) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(text[t.start:t.end]))
+		}
+		pos = t.end
+	}
+	return b.String()
+}
@@ -0,0 +1,97 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/stretchr/testify/assert"
+)
+
+func ids(results datastructs.SearchResults) []string {
+	out := []string{}
+	for _, r := range results.Results {
+		out = append(out, r.Comment.ID)
+	}
+	return out
+}
+
+func TestIndex(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	newIndex := func() *Index {
+		idx := NewIndex()
+		idx.HandleCommentEvent(ctx, datastructs.Event{Type: datastructs.EventCommentCreated, Comment: datastructs.Comment{
+			ID: "1", Slug: "go", Body: "The garbage collector pauses are short", ProcessedBody: "The garbage collector pauses are short", CreatedAt: now,
+		}})
+		idx.HandleCommentEvent(ctx, datastructs.Event{Type: datastructs.EventCommentCreated, Comment: datastructs.Comment{
+			ID: "2", Slug: "go", Body: "short pauses from the collector, garbage is fine", ProcessedBody: "short pauses from the collector, garbage is fine", CreatedAt: now.Add(time.Second),
+		}})
+		idx.HandleCommentEvent(ctx, datastructs.Event{Type: datastructs.EventCommentCreated, Comment: datastructs.Comment{
+			ID: "3", Slug: "rust", Body: "no garbage collector at all <script>", ProcessedBody: "no garbage collector at all <script>", CreatedAt: now.Add(2 * time.Second),
+		}})
+		return idx
+	}
+
+	t.Run("matches every word", func(t *testing.T) {
+		res, err := newIndex().SearchComments(ctx, datastructs.SearchQuery{Query: "garbage collector"})
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"1", "2", "3"}, ids(res))
+		assert.Equal(t, 3, res.Total)
+	})
+
+	t.Run("phrases, exclusions, OR and slug filter", func(t *testing.T) {
+		idx := newIndex()
+
+		res, _ := idx.SearchComments(ctx, datastructs.SearchQuery{Query: `"garbage collector"`})
+		assert.ElementsMatch(t, []string{"1", "3"}, ids(res))
+
+		res, _ = idx.SearchComments(ctx, datastructs.SearchQuery{Query: `garbage -pauses`})
+		assert.Equal(t, []string{"3"}, ids(res))
+
+		res, _ = idx.SearchComments(ctx, datastructs.SearchQuery{Query: `fine OR "at all"`})
+		assert.ElementsMatch(t, []string{"2", "3"}, ids(res))
+
+		res, _ = idx.SearchComments(ctx, datastructs.SearchQuery{Query: "garbage", Slug: "rust"})
+		assert.Equal(t, []string{"3"}, ids(res))
+
+		// A word in no comment rules its group out
+		res, _ = idx.SearchComments(ctx, datastructs.SearchQuery{Query: `garbage nowhere OR fine`})
+		assert.Equal(t, []string{"2"}, ids(res))
+	})
+
+	t.Run("paginates and escapes snippets", func(t *testing.T) {
+		res, _ := newIndex().SearchComments(ctx, datastructs.SearchQuery{Query: "at all", Limit: 1})
+		assert.Len(t, res.Results, 1)
+		assert.Equal(t, "no garbage collector <mark>at</mark> <mark>all</mark> &lt;script", res.Results[0].Snippet)
+
+		res, _ = newIndex().SearchComments(ctx, datastructs.SearchQuery{Query: "garbage", Limit: 2, Offset: 2})
+		assert.Len(t, res.Results, 1)
+		assert.Equal(t, 3, res.Total)
+	})
+
+	t.Run("follows updates and deletes", func(t *testing.T) {
+		idx := newIndex()
+		idx.HandleCommentEvent(ctx, datastructs.Event{Type: datastructs.EventCommentUpdated, Comment: datastructs.Comment{
+			ID: "1", Slug: "go", Body: "edited away", ProcessedBody: "edited away",
+		}})
+		idx.HandleCommentEvent(ctx, datastructs.Event{Type: datastructs.EventCommentDeleted, Comment: datastructs.Comment{ID: "3"}})
+
+		res, _ := idx.SearchComments(ctx, datastructs.SearchQuery{Query: "garbage"})
+		assert.Equal(t, []string{"2"}, ids(res))
+		assert.Equal(t, 2, idx.Len())
+	})
+
+	t.Run("save and load round trip", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, newIndex().Save(&buf))
+
+		loaded := NewIndex()
+		assert.NoError(t, loaded.Load(&buf))
+		res, _ := loaded.SearchComments(ctx, datastructs.SearchQuery{Query: `"garbage collector"`})
+		assert.ElementsMatch(t, []string{"1", "3"}, ids(res))
+	})
+}
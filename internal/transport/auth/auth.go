@@ -0,0 +1,84 @@
+package auth
+
+// Checks the JWTs callers send with their requests, shared
+// by every transport so they all authenticate the same way
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
+)
+
+type contextKey string
+
+// claimsContextKey - where the claims of the
+// caller's token are kept on the context
+const claimsContextKey contextKey = "claims"
+
+// ValidateToken - the token's claims, false when it is not a valid token
+func ValidateToken(accessToken string) (jwt.MapClaims, bool) {
+	var mySigningKey = []byte("mission impossible")
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(accessToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("could not validate error token")
+		}
+
+		return mySigningKey, nil
+
+	})
+
+	if err != nil {
+		return nil, false
+	}
+
+	return claims, token.Valid
+}
+
+// WithClaims - stores the token claims and the caller's
+// user id and role for the service layer on the context
+func WithClaims(ctx context.Context, claims jwt.MapClaims) context.Context {
+	ctx = context.WithValue(ctx, claimsContextKey, claims)
+	if sub, ok := claims["sub"].(string); ok && sub != "" {
+		ctx = comment.WithViewer(ctx, sub)
+	}
+	if role, ok := claims["role"].(string); ok && role != "" {
+		ctx = comment.WithViewerRole(ctx, role)
+	}
+	return ctx
+}
+
+// Expired - whether the caller's token has expired since it was
+// checked, for connections that outlive it. Tokens without an
+// expiry never do, nor does the lack of one
+func Expired(ctx context.Context) bool {
+	claims, ok := ctx.Value(claimsContextKey).(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return false
+	}
+	return !time.Now().Before(exp.Time)
+}
+
+// Authenticated - whether the caller sent a valid token
+func Authenticated(ctx context.Context) bool {
+	_, ok := ctx.Value(claimsContextKey).(jwt.MapClaims)
+	return ok
+}
+
+// ClaimString - reads a string claim from the caller's token,
+// empty when the request was not authenticated
+func ClaimString(ctx context.Context, key string) string {
+	claims, ok := ctx.Value(claimsContextKey).(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	value, _ := claims[key].(string)
+	return value
+}
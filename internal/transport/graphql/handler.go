@@ -0,0 +1,116 @@
+package graphql
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+// name is the Tracer name used to identify this instrumentation library.
+const name = "graphql"
+
+// Request - a GraphQL request, sent as the JSON body of a
+// POST or as the query string of a GET
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Handler - serves GraphQL requests over the comment service
+type Handler struct {
+	Service CommentService
+	Schema  graphql.Schema
+}
+
+func NewHandler(service CommentService) (*Handler, error) {
+	schema, err := NewSchema(service)
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{
+		Service: service,
+		Schema:  schema,
+	}, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "GraphQL", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var req Request
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if vars := r.URL.Query().Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				http.Error(w, "variables must be a JSON object", http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			http.Error(w, "not a valid GraphQL request", http.StatusBadRequest)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if req.Query == "" {
+		http.Error(w, "query is required", http.StatusBadRequest)
+		return
+	}
+
+	var result *graphql.Result
+	doc, err := parseQuery(req.Query)
+	if err == nil {
+		// A GET can be made by any page the caller visits, so only
+		// a POST may change anything
+		if r.Method != http.MethodPost && isMutation(doc, req.OperationName) {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "mutations must be sent with POST", http.StatusMethodNotAllowed)
+			return
+		}
+		err = checkLimits(doc, req.OperationName, req.Variables)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		result = &graphql.Result{Errors: []gqlerrors.FormattedError{gqlerrors.FormatError(err)}}
+	} else {
+		result = graphql.Do(graphql.Params{
+			Schema:         h.Schema,
+			RequestString:  req.Query,
+			VariableValues: req.Variables,
+			OperationName:  req.OperationName,
+			// Loaders are per request so nothing one caller
+			// fetched is handed to another
+			Context: withLoaders(ctx, newLoaders(h.Service)),
+		})
+	}
+	if result.HasErrors() {
+		span.SetStatus(codes.Error, result.Errors[0].Message)
+	}
+
+	// Errors are reported in the result, as GraphQL clients expect
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
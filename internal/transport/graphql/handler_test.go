@@ -0,0 +1,292 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/imraan1901/comment-section-rest-api/internal/transport/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeService - a thread of three comments each with two replies,
+// counting how often the batched reads are made
+type fakeService struct {
+	CommentService
+	calls map[string]int
+}
+
+func newFakeService() *fakeService {
+	return &fakeService{calls: map[string]int{}}
+}
+
+func (s *fakeService) GetThread(ctx context.Context, slug string) (datastructs.Thread, error) {
+	return datastructs.Thread{Slug: slug, State: datastructs.ThreadOpen}, nil
+}
+
+func (s *fakeService) ListComments(ctx context.Context, q datastructs.ListQuery) ([]datastructs.Comment, error) {
+	s.calls["ListComments"]++
+	var cmts []datastructs.Comment
+	for _, id := range []string{"a", "b", "c"} {
+		cmts = append(cmts, datastructs.Comment{ID: id, Slug: q.Slug, Author: "author-" + id})
+	}
+	return cmts, nil
+}
+
+func (s *fakeService) ListThreads(ctx context.Context, q datastructs.ThreadQuery) ([]datastructs.Thread, error) {
+	s.calls["ListThreads"]++
+	var threads []datastructs.Thread
+	for _, slug := range []string{"one", "two", "three"} {
+		threads = append(threads, datastructs.Thread{Slug: slug})
+	}
+	return threads, nil
+}
+
+func (s *fakeService) ListCommentPages(ctx context.Context, qs []datastructs.ListQuery) (map[datastructs.ListQuery][]datastructs.Comment, error) {
+	s.calls["ListCommentPages"]++
+	pages := map[datastructs.ListQuery][]datastructs.Comment{}
+	for _, q := range qs {
+		cmts, _ := s.ListComments(ctx, q)
+		pages[q] = cmts
+	}
+	return pages, nil
+}
+
+func (s *fakeService) ListReplies(ctx context.Context, parentIDs []string) (map[string][]datastructs.Comment, error) {
+	s.calls["ListReplies"]++
+	replies := map[string][]datastructs.Comment{}
+	for _, id := range parentIDs {
+		for _, n := range []string{"1", "2"} {
+			replies[id] = append(replies[id], datastructs.Comment{ID: id + n, ParentID: id, Author: "author-" + n})
+		}
+	}
+	return replies, nil
+}
+
+func (s *fakeService) GetComments(ctx context.Context, ids []string) (map[string]datastructs.Comment, error) {
+	s.calls["GetComments"]++
+	cmts := map[string]datastructs.Comment{}
+	for _, id := range ids {
+		// Only approved comments are read back
+		if strings.HasPrefix(id, "unapproved") {
+			continue
+		}
+		cmts[id] = datastructs.Comment{ID: id, Author: "author-" + id}
+	}
+	return cmts, nil
+}
+
+func (s *fakeService) GetAuthorProfiles(ctx context.Context, authors []string) (map[string]datastructs.AuthorProfile, error) {
+	s.calls["GetAuthorProfiles"]++
+	profiles := map[string]datastructs.AuthorProfile{}
+	for _, author := range authors {
+		profiles[author] = datastructs.AuthorProfile{Name: author, CommentCount: 1}
+	}
+	return profiles, nil
+}
+
+func (s *fakeService) PostComment(ctx context.Context, cmt datastructs.Comment) (datastructs.Comment, error) {
+	cmt.ID = "posted"
+	return cmt, nil
+}
+
+// unapprovedService - comments whose parents and threads whose
+// accepted answers are waiting on moderation
+type unapprovedService struct {
+	*fakeService
+}
+
+func (s *unapprovedService) GetThread(ctx context.Context, slug string) (datastructs.Thread, error) {
+	return datastructs.Thread{Slug: slug, AcceptedAnswerID: "unapproved-answer"}, nil
+}
+
+func (s *unapprovedService) ListComments(ctx context.Context, q datastructs.ListQuery) ([]datastructs.Comment, error) {
+	return []datastructs.Comment{{ID: "a", Slug: q.Slug, ParentID: "unapproved-parent", Author: "author-a"}}, nil
+}
+
+type result struct {
+	Data   map[string]interface{}
+	Errors []struct{ Message string }
+}
+
+func do(t *testing.T, h *Handler, ctx context.Context, query string) result {
+	t.Helper()
+	body, err := json.Marshal(Request{Query: query})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body))).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var res result
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	return res
+}
+
+func TestHandler(t *testing.T) {
+
+	t.Run("a thread, its replies and authors are fetched once per level", func(t *testing.T) {
+		service := newFakeService()
+		h, err := NewHandler(service)
+		require.NoError(t, err)
+
+		res := do(t, h, context.Background(), `{
+			thread(slug: "post") {
+				slug
+				comments {
+					id
+					author { name }
+					replies { id author { name commentCount } }
+				}
+			}
+		}`)
+		require.Empty(t, res.Errors)
+
+		cmts := res.Data["thread"].(map[string]interface{})["comments"].([]interface{})
+		assert.Len(t, cmts, 3)
+		replies := cmts[1].(map[string]interface{})["replies"].([]interface{})
+		assert.Equal(t, "b1", replies[0].(map[string]interface{})["id"])
+
+		assert.Equal(t, 1, service.calls["ListCommentPages"])
+		assert.Equal(t, 1, service.calls["ListReplies"])
+		// Once for the comments' authors and once for the replies', or
+		// once for both when the replies are resolved first
+		assert.LessOrEqual(t, service.calls["GetAuthorProfiles"], 2)
+	})
+
+	t.Run("parents are fetched together", func(t *testing.T) {
+		service := newFakeService()
+		h, err := NewHandler(service)
+		require.NoError(t, err)
+
+		res := do(t, h, context.Background(), `{
+			comments(slug: "post") { replies { parent { id } } }
+		}`)
+		require.Empty(t, res.Errors)
+		assert.Equal(t, 1, service.calls["GetComments"])
+	})
+
+	t.Run("the comments of a list of threads are fetched together", func(t *testing.T) {
+		service := newFakeService()
+		h, err := NewHandler(service)
+		require.NoError(t, err)
+
+		res := do(t, h, context.Background(), `{ threads { slug comments(limit: 5) { id } } }`)
+		require.Empty(t, res.Errors)
+		assert.Len(t, res.Data["threads"], 3)
+		assert.Equal(t, 1, service.calls["ListCommentPages"])
+	})
+
+	t.Run("comments that are not approved resolve to null", func(t *testing.T) {
+		service := &unapprovedService{newFakeService()}
+		h, err := NewHandler(service)
+		require.NoError(t, err)
+
+		res := do(t, h, context.Background(), `{ thread(slug: "post") { acceptedAnswer { id } } }`)
+		require.Empty(t, res.Errors)
+		assert.Nil(t, res.Data["thread"].(map[string]interface{})["acceptedAnswer"])
+
+		res = do(t, h, context.Background(), `{ comments(slug: "post") { parent { id } } }`)
+		require.Empty(t, res.Errors)
+		for _, cmt := range res.Data["comments"].([]interface{}) {
+			assert.Nil(t, cmt.(map[string]interface{})["parent"])
+		}
+	})
+
+	t.Run("mutations need an authenticated caller", func(t *testing.T) {
+		h, err := NewHandler(newFakeService())
+		require.NoError(t, err)
+		mutation := `mutation { postComment(slug: "post", author: "author", body: "body") { id } }`
+
+		res := do(t, h, context.Background(), mutation)
+		require.Len(t, res.Errors, 1)
+		assert.Equal(t, "not authorized", res.Errors[0].Message)
+
+		ctx := auth.WithClaims(context.Background(), jwt.MapClaims{"sub": "user"})
+		res = do(t, h, ctx, mutation)
+		require.Empty(t, res.Errors)
+		assert.Equal(t, "posted", res.Data["postComment"].(map[string]interface{})["id"])
+
+		res = do(t, h, ctx, `mutation { postComment(slug: "post", parentId: "nope", author: "author", body: "body") { id } }`)
+		require.Len(t, res.Errors, 1)
+		assert.Equal(t, "not a valid comment", res.Errors[0].Message)
+	})
+
+	t.Run("mutations are only run for a POST", func(t *testing.T) {
+		h, err := NewHandler(newFakeService())
+		require.NoError(t, err)
+		ctx := auth.WithClaims(context.Background(), jwt.MapClaims{"sub": "user"})
+
+		query := url.Values{"query": {`mutation { postComment(slug: "post", author: "author", body: "body") { id } }`}}
+		req := httptest.NewRequest(http.MethodGet, "/graphql?"+query.Encode(), nil).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+		query = url.Values{"query": {`{ comments(slug: "post") { id } }`}}
+		req = httptest.NewRequest(http.MethodGet, "/graphql?"+query.Encode(), nil)
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("queries that do not parse are refused", func(t *testing.T) {
+		h, err := NewHandler(newFakeService())
+		require.NoError(t, err)
+
+		res := do(t, h, context.Background(), `{ comments(slug: "post") { id `)
+		require.Len(t, res.Errors, 1)
+		assert.Nil(t, res.Data)
+	})
+}
+
+func parse(t *testing.T, query string) *ast.Document {
+	t.Helper()
+	doc, err := parseQuery(query)
+	require.NoError(t, err)
+	return doc
+}
+
+func TestCheckLimits(t *testing.T) {
+
+	t.Run("deep queries are refused", func(t *testing.T) {
+		query := `{ comment(id: "a") { parent { parent { parent { parent { parent { parent { parent { id } } } } } } } } }`
+		assert.ErrorIs(t, checkLimits(parse(t, query), "", nil), ErrQueryTooDeep)
+
+		query = `{ comment(id: "a") { parent { parent { id } } } }`
+		assert.NoError(t, checkLimits(parse(t, query), "", nil))
+	})
+
+	t.Run("the comments of every thread listed are counted", func(t *testing.T) {
+		query := `{ threads { slug comments { id replies { id } } } }`
+		assert.NoError(t, checkLimits(parse(t, query), "", nil))
+
+		query = `{ threads(limit: 100) { comments(limit: 50) { id } } }`
+		assert.ErrorIs(t, checkLimits(parse(t, query), "", nil), ErrQueryTooComplex)
+	})
+
+	t.Run("lists count once per item", func(t *testing.T) {
+		query := `query($n: Int) { comments(slug: "post", limit: $n) { id replies(limit: 50) { id body } } }`
+		assert.NoError(t, checkLimits(parse(t, query), "", map[string]interface{}{"n": float64(10)}))
+		assert.ErrorIs(t, checkLimits(parse(t, query), "", map[string]interface{}{"n": float64(200)}), ErrQueryTooComplex)
+	})
+
+	t.Run("fragments are counted where they are spread", func(t *testing.T) {
+		query := `
+			{ comments(slug: "post", limit: 200) { ...deep } }
+			fragment deep on Comment { replies(limit: 50) { id } }`
+		assert.ErrorIs(t, checkLimits(parse(t, query), "", nil), ErrQueryTooComplex)
+
+		// Cycles are left for validation to reject
+		query = `{ comment(id: "a") { ...loop } } fragment loop on Comment { parent { ...loop } }`
+		assert.NoError(t, checkLimits(parse(t, query), "", nil))
+	})
+}
@@ -0,0 +1,169 @@
+package graphql
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+const (
+	// MaxDepth - how deeply a query may nest its fields
+	MaxDepth = 8
+	// MaxComplexity - the most a query may cost, every field costs
+	// one and the fields under a list cost once per item it may hold
+	MaxComplexity = 2000
+	// defaultListSize - how many items a list fetched without a limit holds
+	defaultListSize = 10
+)
+
+var (
+	ErrQueryTooDeep    = errors.New("query is nested too deeply")
+	ErrQueryTooComplex = errors.New("query is too complex")
+)
+
+// listFields - the fields that fetch a list from the store,
+// everything selected under one is resolved for every item
+var listFields = map[string]bool{
+	"comments": true,
+	"threads":  true,
+	"replies":  true,
+}
+
+// parseQuery - the query's document, a query that does not parse is
+// refused as it can not be checked against the limits
+func parseQuery(query string) (*ast.Document, error) {
+	return parser.Parse(parser.ParseParams{Source: query})
+}
+
+// isMutation - whether the operation that would be run is a
+// mutation, any operation could be when none is named
+func isMutation(doc *ast.Document, operationName string) bool {
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok || (operationName != "" && (op.Name == nil || op.Name.Value != operationName)) {
+			continue
+		}
+		if op.Operation == ast.OperationTypeMutation {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLimits - refuses a query nesting deeper than MaxDepth or
+// costing more than MaxComplexity before any of it is resolved
+func checkLimits(doc *ast.Document, operationName string, variables map[string]interface{}) error {
+	m := measurer{
+		fragments: map[string]*ast.FragmentDefinition{},
+		variables: variables,
+		visiting:  map[string]bool{},
+	}
+	var ops []*ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch d := def.(type) {
+		case *ast.FragmentDefinition:
+			m.fragments[d.Name.Value] = d
+		case *ast.OperationDefinition:
+			ops = append(ops, d)
+		}
+	}
+
+	for _, op := range ops {
+		if operationName != "" && (op.Name == nil || op.Name.Value != operationName) {
+			continue
+		}
+		depth, cost := m.selectionSet(op.SelectionSet)
+		if depth > MaxDepth {
+			return ErrQueryTooDeep
+		}
+		if cost > MaxComplexity {
+			return ErrQueryTooComplex
+		}
+	}
+	return nil
+}
+
+type measurer struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	// visiting - the fragments being measured, validation
+	// rejects cycles but they are measured before it runs
+	visiting map[string]bool
+}
+
+// selectionSet - how deeply the selections nest and what they cost,
+// the cost stops counting once it is over MaxComplexity
+func (m *measurer) selectionSet(set *ast.SelectionSet) (int, int) {
+	if set == nil {
+		return 0, 0
+	}
+
+	depth, cost := 0, 0
+	for _, sel := range set.Selections {
+		var d, c int
+		switch s := sel.(type) {
+		case *ast.Field:
+			// Introspection is bounded by the schema
+			if strings.HasPrefix(s.Name.Value, "__") {
+				continue
+			}
+			d, c = m.selectionSet(s.SelectionSet)
+			d++
+			if listFields[s.Name.Value] {
+				c *= m.listSize(s)
+			}
+			c++
+		case *ast.InlineFragment:
+			d, c = m.selectionSet(s.SelectionSet)
+		case *ast.FragmentSpread:
+			frag, ok := m.fragments[s.Name.Value]
+			if !ok || m.visiting[s.Name.Value] {
+				continue
+			}
+			m.visiting[s.Name.Value] = true
+			d, c = m.selectionSet(frag.SelectionSet)
+			delete(m.visiting, s.Name.Value)
+		}
+
+		if d > depth {
+			depth = d
+		}
+		cost += c
+		if cost > MaxComplexity {
+			cost = MaxComplexity + 1
+		}
+	}
+	return depth, cost
+}
+
+// listSize - how many items the list field may hold, its
+// limit argument when it has one and defaultListSize if not
+func (m *measurer) listSize(field *ast.Field) int {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "limit" {
+			continue
+		}
+		size := 0
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			size, _ = strconv.Atoi(v.Value)
+		case *ast.Variable:
+			switch n := m.variables[v.Name.Value].(type) {
+			case float64:
+				size = int(n)
+			case int:
+				size = n
+			}
+		}
+		if size > MaxComplexity {
+			return MaxComplexity + 1
+		}
+		if size > 0 {
+			return size
+		}
+	}
+	return defaultListSize
+}
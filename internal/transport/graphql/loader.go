@@ -0,0 +1,101 @@
+package graphql
+
+import (
+	"context"
+	"sync"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+)
+
+// loader - queues the keys asked for while a level of a query is
+// resolved and fetches them all at once when the first is needed.
+// Queries resolve a level at a time, so a level costs one fetch
+// however many objects it has, and nothing is fetched twice
+type loader[K comparable, V any] struct {
+	fetch func(context.Context, []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending []K
+	queued  map[K]bool
+	results map[K]V
+	errs    map[K]error
+}
+
+func newLoader[K comparable, V any](fetch func(context.Context, []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{
+		fetch:   fetch,
+		queued:  map[K]bool{},
+		results: map[K]V{},
+		errs:    map[K]error{},
+	}
+}
+
+// load - queues the key, the returned func fetches it along with
+// every other queued key unless that has already been done
+func (l *loader[K, V]) load(ctx context.Context, key K) func() (V, error) {
+	l.mu.Lock()
+	_, fetched := l.results[key]
+	if !fetched && l.errs[key] == nil && !l.queued[key] {
+		l.queued[key] = true
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (V, error) {
+		return l.get(ctx, key)
+	}
+}
+
+func (l *loader[K, V]) get(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.queued[key] {
+		keys := l.pending
+		l.pending = nil
+		results, err := l.fetch(ctx, keys)
+		for _, k := range keys {
+			delete(l.queued, k)
+			if err != nil {
+				l.errs[k] = err
+				continue
+			}
+			l.results[k] = results[k]
+		}
+	}
+
+	if err := l.errs[key]; err != nil {
+		var zero V
+		return zero, err
+	}
+	return l.results[key], nil
+}
+
+// loaders - the loaders of one request, results are not
+// shared between requests so callers only see what they may
+type loaders struct {
+	comments *loader[string, datastructs.Comment]
+	replies  *loader[string, []datastructs.Comment]
+	authors  *loader[string, datastructs.AuthorProfile]
+	pages    *loader[datastructs.ListQuery, []datastructs.Comment]
+}
+
+func newLoaders(service CommentService) *loaders {
+	return &loaders{
+		comments: newLoader(service.GetComments),
+		replies:  newLoader(service.ListReplies),
+		authors:  newLoader(service.GetAuthorProfiles),
+		pages:    newLoader(service.ListCommentPages),
+	}
+}
+
+type loadersKey struct{}
+
+func withLoaders(ctx context.Context, l *loaders) context.Context {
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+func loadersFromContext(ctx context.Context) *loaders {
+	l, _ := ctx.Value(loadersKey{}).(*loaders)
+	return l
+}
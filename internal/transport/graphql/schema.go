@@ -0,0 +1,502 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/graphql-go/graphql"
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/imraan1901/comment-section-rest-api/internal/transport/auth"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type CommentService interface {
+	PostComment(context.Context, datastructs.Comment) (datastructs.Comment, error)
+	GetComment(ctx context.Context, ID string) (datastructs.Comment, error)
+	UpdateComment(ctx context.Context, ID string, newCmt datastructs.Comment) (datastructs.Comment, error)
+	DeleteComment(ctx context.Context, ID string) error
+	ListComments(ctx context.Context, q datastructs.ListQuery) ([]datastructs.Comment, error)
+	GetThread(ctx context.Context, slug string) (datastructs.Thread, error)
+	ListThreads(ctx context.Context, q datastructs.ThreadQuery) ([]datastructs.Thread, error)
+	GetComments(ctx context.Context, ids []string) (map[string]datastructs.Comment, error)
+	ListReplies(ctx context.Context, parentIDs []string) (map[string][]datastructs.Comment, error)
+	ListCommentPages(ctx context.Context, qs []datastructs.ListQuery) (map[datastructs.ListQuery][]datastructs.Comment, error)
+	GetAuthorProfiles(ctx context.Context, authors []string) (map[string]datastructs.AuthorProfile, error)
+}
+
+var (
+	errNotAuthorized  = errors.New("not authorized")
+	errInvalidRequest = errors.New("not a valid comment")
+	errInternal       = errors.New("internal error")
+)
+
+// Validate input from graphql request, the same rules as the REST API
+type postCommentRequest struct {
+	Slug     string `validate:"required"`
+	ParentID string `validate:"omitempty,uuid"`
+	Author   string `validate:"required"`
+	Body     string `validate:"required"`
+}
+
+// reactionCount - how many of one reaction a comment has
+type reactionCount struct {
+	Reaction string
+	Count    int
+}
+
+// clientError - the error the caller is shown, errors
+// that are not the caller's doing are logged and hidden
+func clientError(err error) error {
+	switch {
+	case errors.Is(err, errInvalidRequest):
+		return errInvalidRequest
+	case errors.Is(err, comment.ErrInvalidParent),
+		errors.Is(err, comment.ErrCommentTooLong),
+		errors.Is(err, comment.ErrInvalidListing),
+		errors.Is(err, comment.ErrInvalidThread),
+		errors.Is(err, comment.ErrCommentRejected),
+		errors.Is(err, comment.ErrThreadClosed),
+		errors.Is(err, comment.ErrThreadLocked),
+		errors.Is(err, comment.ErrForbidden):
+		return err
+	case errors.Is(err, comment.ErrNotAuthenticated):
+		return errNotAuthorized
+	}
+	log.Print(err)
+	return errInternal
+}
+
+// resolver - runs fn in a span named after the field,
+// recording and hiding its errors as clientError does
+func resolver(fieldName string, fn graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+
+		startTime := time.Now()
+		ctx, span := otel.Tracer(name).Start(p.Context, fieldName, tr.WithTimestamp(startTime))
+		defer span.End(tr.WithTimestamp(time.Now()))
+
+		p.Context = ctx
+		res, err := fn(p)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, clientError(err)
+		}
+		return res, nil
+	}
+}
+
+// mutation - a resolver for a field that changes comments,
+// only authenticated callers may use one, as with JWTAuth
+func mutation(fieldName string, fn graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return resolver(fieldName, func(p graphql.ResolveParams) (interface{}, error) {
+		if !auth.Authenticated(p.Context) {
+			return nil, comment.ErrNotAuthenticated
+		}
+		return fn(p)
+	})
+}
+
+// commentThunk - wraps a loader's result so a missing comment resolves to
+// null, errors are hidden as clientError does
+func commentThunk(get func() (datastructs.Comment, error)) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		cmt, err := get()
+		if err != nil {
+			return nil, clientError(err)
+		}
+		if cmt.ID == "" {
+			return nil, nil
+		}
+		return cmt, nil
+	}
+}
+
+func stringArg(p graphql.ResolveParams, arg string) string {
+	s, _ := p.Args[arg].(string)
+	return s
+}
+
+func intArg(p graphql.ResolveParams, arg string) int {
+	n, _ := p.Args[arg].(int)
+	return n
+}
+
+// limitArg - the field's limit, a list fetched without one holds
+// as many items as the limits count it as
+func limitArg(p graphql.ResolveParams) int {
+	if limit := intArg(p, "limit"); limit != 0 {
+		return limit
+	}
+	return defaultListSize
+}
+
+func boolArg(p graphql.ResolveParams, arg string) bool {
+	b, _ := p.Args[arg].(bool)
+	return b
+}
+
+// listArgs - the arguments of a page of comments on a slug
+func listArgs() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"sort":     &graphql.ArgumentConfig{Type: graphql.String},
+		"featured": &graphql.ArgumentConfig{Type: graphql.Boolean},
+		"limit":    &graphql.ArgumentConfig{Type: graphql.Int},
+		"offset":   &graphql.ArgumentConfig{Type: graphql.Int},
+	}
+}
+
+func listQuery(p graphql.ResolveParams, slug string) datastructs.ListQuery {
+	return datastructs.ListQuery{
+		Slug:     slug,
+		Sort:     stringArg(p, "sort"),
+		Featured: boolArg(p, "featured"),
+		Limit:    limitArg(p),
+		Offset:   intArg(p, "offset"),
+	}
+}
+
+// NewSchema - the schema served at /graphql. Comments' authors,
+// replies and parents and threads' comments are fetched through the
+// request's loaders, so each costs one query per level of the result
+func NewSchema(service CommentService) (graphql.Schema, error) {
+
+	authorType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Author",
+		Description: "What is known of an author, worked out from their approved comments",
+		Fields: graphql.Fields{
+			"name": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(datastructs.AuthorProfile).Name, nil
+				},
+			},
+			"firstSeen": &graphql.Field{
+				Type: graphql.DateTime,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					profile := p.Source.(datastructs.AuthorProfile)
+					if profile.FirstSeen.IsZero() {
+						return nil, nil
+					}
+					return profile.FirstSeen, nil
+				},
+			},
+			"commentCount": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(datastructs.AuthorProfile).CommentCount, nil
+				},
+			},
+		},
+	})
+
+	reactionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Reaction",
+		Fields: graphql.Fields{
+			"reaction": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(reactionCount).Reaction, nil
+				},
+			},
+			"count": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(reactionCount).Count, nil
+				},
+			},
+		},
+	})
+
+	commentType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Comment",
+		Fields: graphql.Fields{
+			"id":       commentField(graphql.NewNonNull(graphql.ID), func(c datastructs.Comment) interface{} { return c.ID }),
+			"site":     commentField(graphql.String, func(c datastructs.Comment) interface{} { return c.Site }),
+			"slug":     commentField(graphql.String, func(c datastructs.Comment) interface{} { return c.Slug }),
+			"body":     commentField(graphql.String, func(c datastructs.Comment) interface{} { return c.ProcessedBody }),
+			"bodyHtml": commentField(graphql.String, func(c datastructs.Comment) interface{} { return c.BodyHTML }),
+			"parentId": &graphql.Field{
+				Type: graphql.ID,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if id := p.Source.(datastructs.Comment).ParentID; id != "" {
+						return id, nil
+					}
+					return nil, nil
+				},
+			},
+			"pinned":    commentField(graphql.Boolean, func(c datastructs.Comment) interface{} { return c.Pinned }),
+			"featured":  commentField(graphql.Boolean, func(c datastructs.Comment) interface{} { return c.Featured }),
+			"createdAt": commentField(graphql.DateTime, func(c datastructs.Comment) interface{} { return c.CreatedAt }),
+			"reactions": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(reactionType))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					reactions := []reactionCount{}
+					for reaction, count := range p.Source.(datastructs.Comment).Reactions {
+						reactions = append(reactions, reactionCount{Reaction: reaction, Count: count})
+					}
+					sort.Slice(reactions, func(i, j int) bool { return reactions[i].Reaction < reactions[j].Reaction })
+					return reactions, nil
+				},
+			},
+			"myReactions": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if r := p.Source.(datastructs.Comment).MyReactions; r != nil {
+						return r, nil
+					}
+					return []string{}, nil
+				},
+			},
+			"author": &graphql.Field{
+				Type: graphql.NewNonNull(authorType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					get := loadersFromContext(p.Context).authors.load(p.Context, p.Source.(datastructs.Comment).Author)
+					return func() (interface{}, error) {
+						profile, err := get()
+						if err != nil {
+							return nil, clientError(err)
+						}
+						return profile, nil
+					}, nil
+				},
+			},
+		},
+	})
+
+	// Added once the type exists as they refer back to it
+	commentType.AddFieldConfig("parent", &graphql.Field{
+		Type: commentType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			parentID := p.Source.(datastructs.Comment).ParentID
+			if parentID == "" {
+				return nil, nil
+			}
+			return commentThunk(loadersFromContext(p.Context).comments.load(p.Context, parentID)), nil
+		},
+	})
+	commentType.AddFieldConfig("replies", &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(commentType))),
+		Description: "The approved replies, oldest first",
+		Args: graphql.FieldConfigArgument{
+			"limit": &graphql.ArgumentConfig{Type: graphql.Int},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			get := loadersFromContext(p.Context).replies.load(p.Context, p.Source.(datastructs.Comment).ID)
+			limit := limitArg(p)
+			return func() (interface{}, error) {
+				replies, err := get()
+				if err != nil {
+					return nil, clientError(err)
+				}
+				if limit > 0 && limit < len(replies) {
+					replies = replies[:limit]
+				}
+				if replies == nil {
+					replies = []datastructs.Comment{}
+				}
+				return replies, nil
+			}, nil
+		},
+	})
+
+	threadType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Thread",
+		Fields: graphql.Fields{
+			"slug":           threadField(graphql.NewNonNull(graphql.String), func(t datastructs.Thread) interface{} { return t.Slug }),
+			"state":          threadField(graphql.String, func(t datastructs.Thread) interface{} { return t.State }),
+			"kind":           threadField(graphql.String, func(t datastructs.Thread) interface{} { return t.Kind }),
+			"maxLength":      threadField(graphql.Int, func(t datastructs.Thread) interface{} { return t.MaxLength }),
+			"moderationMode": threadField(graphql.String, func(t datastructs.Thread) interface{} { return t.ModerationMode }),
+			"owner":          threadField(graphql.String, func(t datastructs.Thread) interface{} { return t.Owner }),
+			"updatedAt":      threadField(graphql.DateTime, func(t datastructs.Thread) interface{} { return t.UpdatedAt }),
+			"acceptedAnswer": &graphql.Field{
+				Type: commentType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					thread := p.Source.(datastructs.Thread)
+					if thread.AcceptedAnswer != nil {
+						return *thread.AcceptedAnswer, nil
+					}
+					if thread.AcceptedAnswerID == "" {
+						return nil, nil
+					}
+					return commentThunk(loadersFromContext(p.Context).comments.load(p.Context, thread.AcceptedAnswerID)), nil
+				},
+			},
+			// The threads' pages are fetched together, the
+			// limits count them once per thread as they are
+			"comments": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(commentType))),
+				Args: listArgs(),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					q := listQuery(p, p.Source.(datastructs.Thread).Slug)
+					get := loadersFromContext(p.Context).pages.load(p.Context, q)
+					return func() (interface{}, error) {
+						cmts, err := get()
+						if err != nil {
+							return nil, clientError(err)
+						}
+						return cmts, nil
+					}, nil
+				},
+			},
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"comment": &graphql.Field{
+				Type: commentType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: resolver("comment", func(p graphql.ResolveParams) (interface{}, error) {
+					cmt, err := service.GetComment(p.Context, stringArg(p, "id"))
+					if errors.Is(err, comment.ErrFetchingComment) {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, err
+					}
+					return cmt, nil
+				}),
+			},
+			"comments": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(commentType))),
+				Description: "The approved comments on a slug, as GET /api/v1/comments lists them",
+				Args: func() graphql.FieldConfigArgument {
+					args := listArgs()
+					args["slug"] = &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)}
+					return args
+				}(),
+				Resolve: resolver("comments", func(p graphql.ResolveParams) (interface{}, error) {
+					return service.ListComments(p.Context, listQuery(p, stringArg(p, "slug")))
+				}),
+			},
+			"thread": &graphql.Field{
+				Type: threadType,
+				Args: graphql.FieldConfigArgument{
+					"slug": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: resolver("thread", func(p graphql.ResolveParams) (interface{}, error) {
+					return service.GetThread(p.Context, stringArg(p, "slug"))
+				}),
+			},
+			"threads": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(threadType))),
+				Args: graphql.FieldConfigArgument{
+					"state":    &graphql.ArgumentConfig{Type: graphql.String},
+					"kind":     &graphql.ArgumentConfig{Type: graphql.String},
+					"answered": &graphql.ArgumentConfig{Type: graphql.Boolean},
+					"limit":    &graphql.ArgumentConfig{Type: graphql.Int},
+				},
+				Resolve: resolver("threads", func(p graphql.ResolveParams) (interface{}, error) {
+					q := datastructs.ThreadQuery{
+						State: stringArg(p, "state"),
+						Kind:  stringArg(p, "kind"),
+						Limit: limitArg(p),
+					}
+					if answered, ok := p.Args["answered"].(bool); ok {
+						q.Answered = &answered
+					}
+					return service.ListThreads(p.Context, q)
+				}),
+			},
+		},
+	})
+
+	mutationType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"postComment": &graphql.Field{
+				Type: graphql.NewNonNull(commentType),
+				Args: graphql.FieldConfigArgument{
+					"slug":     &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"parentId": &graphql.ArgumentConfig{Type: graphql.ID},
+					"author":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"body":     &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"site":     &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: mutation("postComment", func(p graphql.ResolveParams) (interface{}, error) {
+					req := postCommentRequest{
+						Slug:     stringArg(p, "slug"),
+						ParentID: stringArg(p, "parentId"),
+						Author:   stringArg(p, "author"),
+						Body:     stringArg(p, "body"),
+					}
+					validate := validator.New()
+					if err := validate.Struct(req); err != nil {
+						return nil, fmt.Errorf("%w: %v", errInvalidRequest, err)
+					}
+					return service.PostComment(p.Context, datastructs.Comment{
+						Site:     stringArg(p, "site"),
+						Slug:     req.Slug,
+						ParentID: req.ParentID,
+						Author:   req.Author,
+						Body:     req.Body,
+					})
+				}),
+			},
+			"updateComment": &graphql.Field{
+				Type: graphql.NewNonNull(commentType),
+				Args: graphql.FieldConfigArgument{
+					"id":     &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"slug":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"author": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"body":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: mutation("updateComment", func(p graphql.ResolveParams) (interface{}, error) {
+					return service.UpdateComment(p.Context, stringArg(p, "id"), datastructs.Comment{
+						Slug:   stringArg(p, "slug"),
+						Author: stringArg(p, "author"),
+						Body:   stringArg(p, "body"),
+					})
+				}),
+			},
+			"deleteComment": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: mutation("deleteComment", func(p graphql.ResolveParams) (interface{}, error) {
+					if err := service.DeleteComment(p.Context, stringArg(p, "id")); err != nil {
+						return nil, err
+					}
+					return true, nil
+				}),
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:    queryType,
+		Mutation: mutationType,
+	})
+}
+
+func commentField(t graphql.Output, get func(datastructs.Comment) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: t,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return get(p.Source.(datastructs.Comment)), nil
+		},
+	}
+}
+
+func threadField(t graphql.Output, get func(datastructs.Thread) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: t,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return get(p.Source.(datastructs.Thread)), nil
+		},
+	}
+}
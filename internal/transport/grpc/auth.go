@@ -0,0 +1,86 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/transport/auth"
+	"github.com/imraan1901/comment-section-rest-api/internal/transport/grpc/commentv1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// authRequired - the methods that, like the REST endpoints behind
+// JWTAuth, need a token. The rest check one only when it is sent
+var authRequired = map[string]bool{
+	commentv1.CommentService_PostComment_FullMethodName:   true,
+	commentv1.CommentService_UpdateComment_FullMethodName: true,
+	commentv1.CommentService_DeleteComment_FullMethodName: true,
+}
+
+var errNotAuthorized = status.Error(codes.Unauthenticated, "not authorized")
+
+// authenticate - adds the caller's claims to the context when they
+// sent an "authorization: Bearer <token>" header, calls that need one
+// and calls with a token that is not valid are refused
+func authenticate(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		if authRequired[method] {
+			return nil, errNotAuthorized
+		}
+		return ctx, nil
+	}
+
+	// Bearer: token-string
+	parts := strings.Split(values[0], " ")
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return nil, errNotAuthorized
+	}
+	claims, ok := auth.ValidateToken(parts[1])
+	if !ok {
+		return nil, errNotAuthorized
+	}
+	return auth.WithClaims(ctx, claims), nil
+}
+
+// UnaryAuthInterceptor - authenticates unary calls
+func UnaryAuthInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	ctx, err := authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authenticatedStream - a stream carrying the caller's claims on its context
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamAuthInterceptor - authenticates streaming calls
+func StreamAuthInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	ctx, err := authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
@@ -0,0 +1,272 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/imraan1901/comment-section-rest-api/internal/events"
+	"github.com/imraan1901/comment-section-rest-api/internal/transport/grpc/commentv1"
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Validate input from grpc request, the same rules as the REST API
+type postCommentRequest struct {
+	Slug     string `validate:"required"`
+	ParentID string `validate:"omitempty,uuid"`
+	Author   string `validate:"required"`
+	Body     string `validate:"required"`
+}
+
+func convertCommentToProto(c datastructs.Comment) *commentv1.Comment {
+	reactions := map[string]int64{}
+	for reaction, count := range c.Reactions {
+		reactions[reaction] = int64(count)
+	}
+	return &commentv1.Comment{
+		Id:               c.ID,
+		Site:             c.Site,
+		Slug:             c.Slug,
+		ParentId:         c.ParentID,
+		Body:             c.ProcessedBody,
+		Author:           c.Author,
+		BodyHtml:         c.BodyHTML,
+		ModerationStatus: c.ModerationStatus,
+		Mentions:         c.Mentions,
+		Reactions:        reactions,
+		MyReactions:      c.MyReactions,
+		Pinned:           c.Pinned,
+		PinPosition:      int64(c.PinPosition),
+		Featured:         c.Featured,
+		CreatedAt:        timestamppb.New(c.CreatedAt),
+	}
+}
+
+// errorStatus - the gRPC status for an error from the service
+func errorStatus(err error) error {
+	switch {
+	case errors.Is(err, comment.ErrInvalidParent),
+		errors.Is(err, comment.ErrCommentTooLong),
+		errors.Is(err, comment.ErrInvalidListing):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, comment.ErrCommentRejected):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, comment.ErrThreadClosed),
+		errors.Is(err, comment.ErrThreadLocked),
+		errors.Is(err, comment.ErrForbidden):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, comment.ErrNotAuthenticated):
+		return errNotAuthorized
+	case errors.Is(err, comment.ErrFetchingComment):
+		return status.Error(codes.NotFound, err.Error())
+	}
+	log.Print(err)
+	return status.Error(codes.Internal, "internal error")
+}
+
+func (s *Server) PostComment(ctx context.Context, req *commentv1.PostCommentRequest) (*commentv1.Comment, error) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(ctx, "PostComment", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	validate := validator.New()
+	err := validate.Struct(postCommentRequest{
+		Slug:     req.GetSlug(),
+		ParentID: req.GetParentId(),
+		Author:   req.GetAuthor(),
+		Body:     req.GetBody(),
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return nil, status.Error(codes.InvalidArgument, "not a valid comment")
+	}
+
+	cmt, err := s.Service.PostComment(ctx, datastructs.Comment{
+		Site:     req.GetSite(),
+		Slug:     req.GetSlug(),
+		ParentID: req.GetParentId(),
+		Author:   req.GetAuthor(),
+		Body:     req.GetBody(),
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return nil, errorStatus(err)
+	}
+	return convertCommentToProto(cmt), nil
+}
+
+// GetComment - the comment as the REST endpoint finds it, comments
+// out of view are NotFound for anyone but moderators and their author
+func (s *Server) GetComment(ctx context.Context, req *commentv1.GetCommentRequest) (*commentv1.Comment, error) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(ctx, "GetComment", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	cmt, err := s.Service.GetComment(ctx, req.GetId())
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return nil, errorStatus(err)
+	}
+	return convertCommentToProto(cmt), nil
+}
+
+func (s *Server) UpdateComment(ctx context.Context, req *commentv1.UpdateCommentRequest) (*commentv1.Comment, error) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(ctx, "UpdateComment", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	cmt, err := s.Service.UpdateComment(ctx, req.GetId(), datastructs.Comment{
+		Slug:   req.GetSlug(),
+		Author: req.GetAuthor(),
+		Body:   req.GetBody(),
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return nil, errorStatus(err)
+	}
+	return convertCommentToProto(cmt), nil
+}
+
+func (s *Server) DeleteComment(ctx context.Context, req *commentv1.DeleteCommentRequest) (*commentv1.DeleteCommentResponse, error) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(ctx, "DeleteComment", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	if err := s.Service.DeleteComment(ctx, req.GetId()); err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return nil, errorStatus(err)
+	}
+	return &commentv1.DeleteCommentResponse{}, nil
+}
+
+func (s *Server) ListComments(ctx context.Context, req *commentv1.ListCommentsRequest) (*commentv1.ListCommentsResponse, error) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(ctx, "ListComments", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	cmts, err := s.Service.ListComments(ctx, datastructs.ListQuery{
+		Slug:     req.GetSlug(),
+		Sort:     req.GetSort(),
+		Featured: req.GetFeatured(),
+		Limit:    int(req.GetLimit()),
+		Offset:   int(req.GetOffset()),
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return nil, errorStatus(err)
+	}
+
+	resp := &commentv1.ListCommentsResponse{}
+	for _, cmt := range cmts {
+		resp.Comments = append(resp.Comments, convertCommentToProto(cmt))
+	}
+	return resp, nil
+}
+
+// StreamComments - sends the slug's comment events as readers see
+// them, after the kept events since the last one the caller saw
+func (s *Server) StreamComments(req *commentv1.StreamCommentsRequest, stream commentv1.CommentService_StreamCommentsServer) error {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(stream.Context(), "StreamComments", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if req.GetSlug() == "" {
+		return status.Error(codes.InvalidArgument, "slug is required")
+	}
+	if s.Hub == nil {
+		return status.Error(codes.Unavailable, "streaming is not enabled")
+	}
+
+	sub, err := s.Hub.Subscribe(peerAddr(stream.Context()))
+	if errors.Is(err, events.ErrTooManySubscribers) {
+		return status.Error(codes.Unavailable, "too many streams, try again later")
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return status.Error(codes.Internal, "internal error")
+	}
+	defer sub.Close()
+
+	for _, evt := range sub.Follow(req.GetSlug(), req.GetLastEventId()) {
+		if err := sendEvent(stream, evt); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sub.Done():
+			return status.Error(codes.ResourceExhausted, "too far behind, resume from the last event seen")
+		case evt := <-sub.Events():
+			if err := sendEvent(stream, evt); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sendEvent - sends the event as readers see it, events
+// readers should not see are skipped
+func sendEvent(stream commentv1.CommentService_StreamCommentsServer, evt datastructs.Event) error {
+	evt, ok := comment.PublicEvent(evt)
+	if !ok {
+		return nil
+	}
+	return stream.Send(&commentv1.CommentEvent{
+		Id:         evt.ID,
+		Type:       evt.Type,
+		Comment:    convertCommentToProto(evt.Comment),
+		OccurredAt: timestamppb.New(evt.OccurredAt),
+	})
+}
+
+// peerAddr - the address of the caller, without its port
+func peerAddr(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
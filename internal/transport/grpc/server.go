@@ -0,0 +1,82 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/imraan1901/comment-section-rest-api/internal/events"
+	"github.com/imraan1901/comment-section-rest-api/internal/transport/grpc/commentv1"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+)
+
+// name is the Tracer name used to identify this instrumentation library.
+const name = "grpc"
+
+// DefaultAddr - where the gRPC server listens unless told otherwise
+const DefaultAddr = "0.0.0.0:9090"
+
+// shutdownTimeout - how long in flight calls get to finish
+// before the server stops, streams never finish by themselves
+const shutdownTimeout = 15 * time.Second
+
+// CommentService - the business layer operations served over gRPC
+type CommentService interface {
+	PostComment(context.Context, datastructs.Comment) (datastructs.Comment, error)
+	GetComment(ctx context.Context, ID string) (datastructs.Comment, error)
+	UpdateComment(ctx context.Context, ID string, newCmt datastructs.Comment) (datastructs.Comment, error)
+	DeleteComment(ctx context.Context, ID string) error
+	ListComments(ctx context.Context, q datastructs.ListQuery) ([]datastructs.Comment, error)
+}
+
+type Server struct {
+	commentv1.UnimplementedCommentServiceServer
+	Service CommentService
+	// Hub - where comment streams get their events,
+	// streams are unavailable when it is nil
+	Hub    *events.Hub
+	Addr   string
+	Server *grpc.Server
+}
+
+func NewServer(service CommentService) *Server {
+	s := &Server{
+		Service: service,
+		Addr:    DefaultAddr,
+	}
+	s.Server = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(otelgrpc.UnaryServerInterceptor(), UnaryAuthInterceptor),
+		grpc.ChainStreamInterceptor(otelgrpc.StreamServerInterceptor(), StreamAuthInterceptor),
+	)
+	commentv1.RegisterCommentServiceServer(s.Server, s)
+	return s
+}
+
+// Serve - serves on Addr until the context is cancelled
+func (s *Server) Serve(ctx context.Context) error {
+	lis, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %w", s.Addr, err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		stopped := make(chan struct{})
+		go func() {
+			s.Server.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(shutdownTimeout):
+			s.Server.Stop()
+		}
+		log.Println("gRPC server stopped")
+	}()
+
+	return s.Server.Serve(lis)
+}
@@ -0,0 +1,135 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/imraan1901/comment-section-rest-api/internal/events"
+	"github.com/imraan1901/comment-section-rest-api/internal/transport/grpc/commentv1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeService - posts comments as the viewer and
+// finds no comment but "known"
+type fakeService struct {
+	CommentService
+}
+
+func (fakeService) PostComment(ctx context.Context, cmt datastructs.Comment) (datastructs.Comment, error) {
+	cmt.ID = "posted-by-" + comment.ViewerFromContext(ctx)
+	return cmt, nil
+}
+
+func (fakeService) GetComment(ctx context.Context, id string) (datastructs.Comment, error) {
+	if id != "known" {
+		return datastructs.Comment{}, comment.ErrFetchingComment
+	}
+	return datastructs.Comment{ID: id, Body: "mail me@example.com", ProcessedBody: "mail [email]"}, nil
+}
+
+func newTestClient(t *testing.T, hub *events.Hub) commentv1.CommentServiceClient {
+	s := NewServer(fakeService{})
+	s.Hub = hub
+	lis := bufconn.Listen(1024 * 1024)
+	go s.Server.Serve(lis)
+	t.Cleanup(s.Server.Stop)
+
+	conn, err := grpc.Dial(
+		"bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return commentv1.NewCommentServiceClient(conn)
+}
+
+func withToken(t *testing.T, sub string) context.Context {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": sub}).
+		SignedString([]byte("mission impossible"))
+	require.NoError(t, err)
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestServer(t *testing.T) {
+
+	client := newTestClient(t, events.NewHub())
+	post := &commentv1.PostCommentRequest{Slug: "post", Author: "author", Body: "body"}
+
+	t.Run("posting needs a valid token", func(t *testing.T) {
+		_, err := client.PostComment(context.Background(), post)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer nonsense")
+		_, err = client.PostComment(ctx, post)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+		cmt, err := client.PostComment(withToken(t, "user"), post)
+		require.NoError(t, err)
+		assert.Equal(t, "posted-by-user", cmt.GetId())
+	})
+
+	t.Run("comments are validated like the REST API", func(t *testing.T) {
+		_, err := client.PostComment(withToken(t, "user"), &commentv1.PostCommentRequest{Slug: "post", Author: "author"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("reads need no token and map service errors", func(t *testing.T) {
+		cmt, err := client.GetComment(context.Background(), &commentv1.GetCommentRequest{Id: "known"})
+		require.NoError(t, err)
+		assert.Equal(t, "known", cmt.GetId())
+		// Readers only see the body once personal information is redacted
+		assert.Equal(t, "mail [email]", cmt.GetBody())
+
+		_, err = client.GetComment(context.Background(), &commentv1.GetCommentRequest{Id: "missing"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
+
+func TestStreamComments(t *testing.T) {
+
+	hub := events.NewHub()
+	client := newTestClient(t, hub)
+	approved := func(id string) datastructs.Event {
+		return datastructs.Event{
+			ID:      id,
+			Type:    datastructs.EventCommentCreated,
+			Comment: datastructs.Comment{ID: "c" + id, Slug: "post", ModerationStatus: datastructs.ModerationApproved},
+		}
+	}
+	hub.HandleCommentEvent(context.Background(), approved("1"))
+	hub.HandleCommentEvent(context.Background(), approved("2"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.StreamComments(ctx, &commentv1.StreamCommentsRequest{Slug: "post", LastEventId: "1"})
+	require.NoError(t, err)
+
+	evt, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "2", evt.GetId())
+
+	// Following began before the missed events were sent.
+	// Held comments are not streamed
+	held := approved("3")
+	held.Comment.ModerationStatus = datastructs.ModerationHeld
+	hub.HandleCommentEvent(context.Background(), held)
+	hub.HandleCommentEvent(context.Background(), approved("4"))
+
+	evt, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "4", evt.GetId())
+	assert.Equal(t, "c4", evt.GetComment().GetId())
+}
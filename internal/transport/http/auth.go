@@ -1,16 +1,23 @@
 package http
 
 import (
-	"errors"
 	"net/http"
 	"strings"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/imraan1901/comment-section-rest-api/internal/transport/auth"
 )
 
 func JWTAuth(
 	orignal func(w http.ResponseWriter, r *http.Request),
 ) func(w http.ResponseWriter, r *http.Request) {
+	return authenticate(validated(orignal))
+}
+
+// authenticate - only lets through callers with a valid token,
+// with its claims on the request context
+func authenticate(
+	orignal func(w http.ResponseWriter, r *http.Request),
+) func(w http.ResponseWriter, r *http.Request) {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header["Authorization"]
@@ -26,8 +33,8 @@ func JWTAuth(
 			return
 		}
 
-		if validateToken(authHeaderParts[1]) {
-			orignal(w, r)
+		if claims, ok := auth.ValidateToken(authHeaderParts[1]); ok {
+			orignal(w, r.WithContext(auth.WithClaims(r.Context(), claims)))
 		} else {
 			http.Error(w, "not authorized", http.StatusUnauthorized)
 			return
@@ -35,20 +42,44 @@ func JWTAuth(
 	}
 }
 
-func validateToken(accessToken string) bool {
-	var mySigningKey = []byte("mission impossible")
-	token, err := jwt.Parse(accessToken, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("could not validate error token")
-		}
+// OptionalJWTAuth - lets anonymous callers through but still
+// checks a token when one is sent, so reads can be personalised
+func OptionalJWTAuth(
+	orignal func(w http.ResponseWriter, r *http.Request),
+) func(w http.ResponseWriter, r *http.Request) {
 
-		return mySigningKey, nil
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header["Authorization"] == nil {
+			validated(orignal)(w, r)
+			return
+		}
+		JWTAuth(orignal)(w, r)
+	}
+}
 
-	})
+// AdminAuth - only lets through callers whose
+// token carries the admin role
+func AdminAuth(
+	orignal func(w http.ResponseWriter, r *http.Request),
+) func(w http.ResponseWriter, r *http.Request) {
+	return RoleAuth(orignal, "admin")
+}
 
-	if err != nil {
-		return false
-	}
+// RoleAuth - only lets through callers whose token
+// carries one of the given roles in its "role" claim
+func RoleAuth(
+	orignal func(w http.ResponseWriter, r *http.Request),
+	roles ...string,
+) func(w http.ResponseWriter, r *http.Request) {
 
-	return token.Valid
+	return authenticate(func(w http.ResponseWriter, r *http.Request) {
+		role := auth.ClaimString(r.Context(), "role")
+		for _, allowed := range roles {
+			if role == allowed {
+				validated(orignal)(w, r)
+				return
+			}
+		}
+		http.Error(w, "forbidden", http.StatusForbidden)
+	})
 }
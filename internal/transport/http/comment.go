@@ -3,6 +3,7 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
 	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/codes"
@@ -25,21 +27,57 @@ type CommentService interface {
 	GetComment(ctx context.Context, ID string) (datastructs.Comment, error)
 	UpdateComment(ctx context.Context, ID string, newCmt datastructs.Comment) (datastructs.Comment, error)
 	DeleteComment(ctx context.Context, ID string) error
+	RuleService
+	ModerationService
+	SpamService
+	PIIService
+	SearchService
+	ReactionService
+	ListService
+	CountService
+	ThreadService
+	PinService
+	NotificationService
+	SubscriptionService
+	WebhookService
 }
 
 // Validate input from http request
 type PostCommentRequest struct {
-	Slug   string `json:"slug" validate:"required"`
-	Author string `json:"author" validate:"required"`
-	Body   string `json:"body" validate:"required"`
+	Site     string `json:"site"`
+	Slug     string `json:"slug" validate:"required"`
+	ParentID string `json:"parent_id" validate:"omitempty,uuid"`
+	Author   string `json:"author" validate:"required"`
+	Body     string `json:"body" validate:"required"`
+}
+
+// UpdateCommentRequest - the fields of a comment that can be edited
+type UpdateCommentRequest struct {
+	Slug   string `json:"slug"`
+	Author string `json:"author"`
+	Body   string `json:"body"`
 }
 
 func convertPostCommentRequestToComment(c PostCommentRequest) datastructs.Comment {
 	return datastructs.Comment{
-		Slug:   c.Slug,
-		Author: c.Author,
-		Body:   c.Body,
+		Site:     c.Site,
+		Slug:     c.Slug,
+		ParentID: c.ParentID,
+		Author:   c.Author,
+		Body:     c.Body,
+	}
+}
+
+// postCommentErrorStatus - the status for errors posting a comment
+// that are the caller's doing, 0 for anything else
+func postCommentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, comment.ErrInvalidParent):
+		return http.StatusBadRequest
+	case errors.Is(err, comment.ErrCommentRejected):
+		return http.StatusUnprocessableEntity
 	}
+	return threadErrorStatus(err)
 }
 
 func (h *Handler) PostComment(w http.ResponseWriter, r *http.Request) {
@@ -66,6 +104,12 @@ func (h *Handler) PostComment(w http.ResponseWriter, r *http.Request) {
 
 	convertedComment := convertPostCommentRequestToComment(cmt)
 	postedComment, err := h.Service.PostComment(ctx, convertedComment)
+	if status := postCommentErrorStatus(err); status != 0 {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), status)
+		return
+	}
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
@@ -122,14 +166,30 @@ func (h *Handler) UpdateComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var cmt datastructs.Comment
-	if err := json.NewDecoder(r.Body).Decode(&cmt); err != nil {
+	var req UpdateCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		return
 	}
 
-	cmt, err := h.Service.UpdateComment(ctx, id, cmt)
+	cmt, err := h.Service.UpdateComment(ctx, id, datastructs.Comment{
+		Slug:   req.Slug,
+		Author: req.Author,
+		Body:   req.Body,
+	})
+	if status := threadErrorStatus(err); status != 0 {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if errors.Is(err, comment.ErrCommentRejected) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
@@ -0,0 +1,49 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type CountService interface {
+	CountComments(ctx context.Context, slugs []string) (map[string]int, error)
+}
+
+// CountComments - GET /api/v1/counts?slug=a&slug=b, answers
+// with a count for every slug keyed by the slug
+func (h *Handler) CountComments(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "CountComments", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	counts, err := h.Service.CountComments(ctx, r.URL.Query()["slug"])
+	if errors.Is(err, comment.ErrInvalidCountQuery) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(counts); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
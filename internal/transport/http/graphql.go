@@ -0,0 +1,13 @@
+package http
+
+import "net/http"
+
+// ServeGraphQL - GET or POST /graphql, hands the request to the
+// GraphQL handler with the caller's claims, if any, in its context
+func (h *Handler) ServeGraphQL(w http.ResponseWriter, r *http.Request) {
+	if h.GraphQL == nil {
+		http.Error(w, "graphql is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	h.GraphQL.ServeHTTP(w, r)
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/imraan1901/comment-section-rest-api/internal/events"
 	"go.opentelemetry.io/otel"
 
 	tr "go.opentelemetry.io/otel/trace"
@@ -19,6 +20,17 @@ type Handler struct {
 	Router  *mux.Router
 	Service CommentService
 	Server  *http.Server
+	// Hub - where comment streams get their events,
+	// streams are unavailable when it is nil
+	Hub *events.Hub
+	// GraphQL - serves /graphql, which is unavailable when it is nil
+	GraphQL http.Handler
+	// AllowedOrigins - the origins browsers may open WebSockets
+	// from, "*" for any, only this host's when empty
+	AllowedOrigins []string
+	// shutdown - closed when the server shuts down so
+	// streams, which never finish by themselves, end
+	shutdown chan struct{}
 }
 
 // name is the Tracer name used to identify this instrumentation library.
@@ -26,7 +38,8 @@ const name = "http"
 
 func NewHandler(service CommentService) *Handler {
 	h := &Handler{
-		Service: service,
+		Service:  service,
+		shutdown: make(chan struct{}),
 	}
 	h.Router = mux.NewRouter()
 	h.mapRoutes()
@@ -34,10 +47,24 @@ func NewHandler(service CommentService) *Handler {
 	h.Router.Use(LoggingMiddleware)
 	h.Router.Use(TimeoutMiddleware)
 
+	// The document is embedded, tests make sure it loads
+	doc, err := LoadOpenAPISpec(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	validate, err := ValidationMiddleware(doc)
+	if err != nil {
+		panic(err)
+	}
+	h.Router.Use(validate)
+
 	h.Server = &http.Server{
 		Addr:    "0.0.0.0:8080",
 		Handler: h.Router,
 	}
+	h.Server.RegisterOnShutdown(func() {
+		close(h.shutdown)
+	})
 
 	return h
 }
@@ -47,11 +74,77 @@ func (h *Handler) mapRoutes() {
 		fmt.Fprintf(w, "I am alive")
 	})
 
+	h.Router.HandleFunc("/api/v1/openapi.json", h.OpenAPI).Methods("GET")
+
 	h.Router.HandleFunc("/api/v1/comment", JWTAuth(h.PostComment)).Methods("POST")
-	h.Router.HandleFunc("/api/v1/comment/{id}", h.GetComment).Methods("GET")
+	h.Router.HandleFunc("/api/v1/comment/{id}", OptionalJWTAuth(h.GetComment)).Methods("GET")
 	h.Router.HandleFunc("/api/v1/comment/{id}", JWTAuth(h.UpdateComment)).Methods("PUT")
 	h.Router.HandleFunc("/api/v1/comment/{id}", JWTAuth(h.DeleteComment)).Methods("DELETE")
 
+	h.Router.HandleFunc("/api/v1/comment/{id}/reactions/{reaction}", JWTAuth(h.AddReaction)).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/comment/{id}/reactions/{reaction}", JWTAuth(h.RemoveReaction)).Methods("DELETE")
+
+	h.Router.HandleFunc("/api/v1/comment/{id}/pin", RoleAuth(h.PinComment, "editor", "moderator", "admin")).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/comment/{id}/pin", RoleAuth(h.UnpinComment, "editor", "moderator", "admin")).Methods("DELETE")
+	h.Router.HandleFunc("/api/v1/comment/{id}/feature", RoleAuth(h.FeatureComment, "editor", "moderator", "admin")).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/comment/{id}/feature", RoleAuth(h.UnfeatureComment, "editor", "moderator", "admin")).Methods("DELETE")
+
+	h.Router.HandleFunc("/api/v1/comments", OptionalJWTAuth(h.ListComments)).Methods("GET")
+	h.Router.HandleFunc("/api/v1/comments/stream", h.StreamComments).Methods("GET").Name(streamRoute)
+	// Clients that can set headers authenticate when connecting, browsers with an auth message
+	h.Router.HandleFunc("/api/v1/ws", OptionalJWTAuth(h.Socket)).Methods("GET").Name(socketRoute)
+	h.Router.HandleFunc("/graphql", OptionalJWTAuth(h.ServeGraphQL)).Methods("GET", "POST")
+	h.Router.HandleFunc("/api/v1/counts", h.CountComments).Methods("GET")
+	h.Router.HandleFunc("/api/v1/threads", h.ListThreads).Methods("GET")
+	h.Router.HandleFunc("/api/v1/threads/{slug}", OptionalJWTAuth(h.GetThread)).Methods("GET")
+	h.Router.HandleFunc("/api/v1/threads/{slug}/answer", JWTAuth(h.AcceptAnswer)).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/threads/{slug}/answer", JWTAuth(h.UnacceptAnswer)).Methods("DELETE")
+
+	h.Router.HandleFunc("/api/v1/me/notifications", JWTAuth(h.ListNotifications)).Methods("GET")
+	h.Router.HandleFunc("/api/v1/me/notifications/read", JWTAuth(h.MarkNotificationsRead)).Methods("POST")
+	h.Router.HandleFunc("/api/v1/me/notification-preferences", JWTAuth(h.GetNotificationPreferences)).Methods("GET")
+	h.Router.HandleFunc("/api/v1/me/notification-preferences", JWTAuth(h.UpdateNotificationPreferences)).Methods("PUT")
+
+	h.Router.HandleFunc("/api/v1/me/subscriptions", JWTAuth(h.ListSubscriptions)).Methods("GET")
+	h.Router.HandleFunc("/api/v1/me/subscriptions", JWTAuth(h.Subscribe)).Methods("POST")
+	h.Router.HandleFunc("/api/v1/me/subscriptions/{id}", JWTAuth(h.Unsubscribe)).Methods("DELETE")
+	// Links in emails only ask, the POST they lead to unsubscribes
+	h.Router.HandleFunc("/api/v1/unsubscribe/{token}", h.ConfirmUnsubscribe).Methods("GET")
+	h.Router.HandleFunc("/api/v1/unsubscribe/{token}", h.UnsubscribeByToken).Methods("POST")
+	h.Router.HandleFunc("/api/v1/digests/{id}/unsubscribe", h.ConfirmUnsubscribe).Methods("GET")
+	h.Router.HandleFunc("/api/v1/digests/{id}/unsubscribe", h.UnsubscribeFromDigests).Methods("POST")
+
+	h.Router.HandleFunc("/api/v1/comments/search", RoleAuth(h.SearchComments, "support", "moderator", "admin")).Methods("GET")
+	h.Router.HandleFunc("/api/v1/comment/{id}/moderation", RoleAuth(h.ModerateComment, "moderator", "admin")).Methods("PUT")
+
+	h.Router.HandleFunc("/api/v1/admin/rules", AdminAuth(h.ListRules)).Methods("GET")
+	h.Router.HandleFunc("/api/v1/admin/rules", AdminAuth(h.PostRule)).Methods("POST")
+	h.Router.HandleFunc("/api/v1/admin/rules/dry-run", AdminAuth(h.DryRunRule)).Methods("POST")
+	h.Router.HandleFunc("/api/v1/admin/rules/{id}", AdminAuth(h.GetRule)).Methods("GET")
+	h.Router.HandleFunc("/api/v1/admin/rules/{id}", AdminAuth(h.UpdateRule)).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/admin/rules/{id}", AdminAuth(h.DeleteRule)).Methods("DELETE")
+	h.Router.HandleFunc("/api/v1/admin/rules/{id}/dry-run", AdminAuth(h.DryRunSavedRule)).Methods("POST")
+
+	h.Router.HandleFunc("/api/v1/admin/spam/retrain", AdminAuth(h.RetrainSpamModel)).Methods("POST")
+	h.Router.HandleFunc("/api/v1/admin/spam/model", AdminAuth(h.ExportSpamModel)).Methods("GET")
+	h.Router.HandleFunc("/api/v1/admin/spam/model", AdminAuth(h.ImportSpamModel)).Methods("PUT")
+
+	h.Router.HandleFunc("/api/v1/admin/threads", RoleAuth(h.ListThreads, "editor", "admin")).Methods("GET")
+	h.Router.HandleFunc("/api/v1/admin/threads/{slug}", RoleAuth(h.GetThread, "editor", "admin")).Methods("GET")
+	h.Router.HandleFunc("/api/v1/admin/threads/{slug}", RoleAuth(h.UpdateThread, "editor", "admin")).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/admin/threads/{slug}", RoleAuth(h.DeleteThread, "editor", "admin")).Methods("DELETE")
+
+	h.Router.HandleFunc("/api/v1/admin/webhooks", AdminAuth(h.ListWebhooks)).Methods("GET")
+	h.Router.HandleFunc("/api/v1/admin/webhooks", AdminAuth(h.PostWebhook)).Methods("POST")
+	h.Router.HandleFunc("/api/v1/admin/webhooks/{id}", AdminAuth(h.GetWebhook)).Methods("GET")
+	h.Router.HandleFunc("/api/v1/admin/webhooks/{id}", AdminAuth(h.UpdateWebhook)).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/admin/webhooks/{id}", AdminAuth(h.DeleteWebhook)).Methods("DELETE")
+	h.Router.HandleFunc("/api/v1/admin/webhooks/{id}/deliveries", AdminAuth(h.ListWebhookDeliveries)).Methods("GET")
+	h.Router.HandleFunc("/api/v1/admin/webhooks/{id}/deliveries/{delivery}/replay", AdminAuth(h.ReplayWebhookDelivery)).Methods("POST")
+
+	h.Router.HandleFunc("/api/v1/admin/sites/{site}/pii", AdminAuth(h.GetPIISettings)).Methods("GET")
+	h.Router.HandleFunc("/api/v1/admin/sites/{site}/pii", AdminAuth(h.UpdatePIISettings)).Methods("PUT")
+
 }
 
 func (h *Handler) Serve(ctx context.Context) error {
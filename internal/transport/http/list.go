@@ -0,0 +1,66 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type ListService interface {
+	ListComments(ctx context.Context, q datastructs.ListQuery) ([]datastructs.Comment, error)
+}
+
+// ListComments - GET /api/v1/comments?slug=...&sort=new|old|top|controversial|best&featured=true&limit=...&offset=...
+func (h *Handler) ListComments(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "ListComments", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		http.Error(w, "limit must be a number", http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(r, "offset")
+	if err != nil {
+		http.Error(w, "offset must be a number", http.StatusBadRequest)
+		return
+	}
+
+	cmts, err := h.Service.ListComments(ctx, datastructs.ListQuery{
+		Slug:     r.URL.Query().Get("slug"),
+		Sort:     r.URL.Query().Get("sort"),
+		Featured: r.URL.Query().Get("featured") == "true",
+		Limit:    limit,
+		Offset:   offset,
+	})
+	if errors.Is(err, comment.ErrInvalidListing) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(cmts); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
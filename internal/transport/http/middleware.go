@@ -2,12 +2,43 @@ package http
 
 import (
 	"context"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 )
 
+// Names of the routes that stay open for as long
+// as the client listens, they have no timeout
+const (
+	streamRoute = "stream"
+	socketRoute = "socket"
+)
+
+var longLivedRoutes = map[string]bool{streamRoute: true, socketRoute: true}
+
+// clientAddr - the address a request came from. A request from our own
+// network came through a proxy, it is from the address the proxy added
+// last to X-Forwarded-For as any before it could have been made up
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip != nil && (ip.IsLoopback() || ip.IsPrivate()) {
+		if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+			hops := strings.Split(fwd[len(fwd)-1], ",")
+			if last := strings.TrimSpace(hops[len(hops)-1]); last != "" {
+				return last
+			}
+		}
+	}
+	return host
+}
+
 func JSONMiddleware(next http.Handler) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -34,6 +65,10 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 func TimeoutMiddleware(next http.Handler) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil && longLivedRoutes[route.GetName()] {
+			next.ServeHTTP(w, r)
+			return
+		}
 		ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
 		defer cancel()
 		next.ServeHTTP(w, r.WithContext(ctx))
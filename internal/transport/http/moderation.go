@@ -0,0 +1,80 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type ModerationService interface {
+	ModerateComment(ctx context.Context, ID string, status string) (datastructs.Comment, error)
+}
+
+// Validate input from http request
+type ModerationRequest struct {
+	Status string `json:"status" validate:"required,oneof=approved flagged held spam rejected"`
+}
+
+// ModerateComment - lets a moderator approve, hold or
+// reject a comment, or mark it as spam
+func (h *Handler) ModerateComment(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "ModerateComment", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var req ModerationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not a valid moderation decision", http.StatusBadRequest)
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not a valid moderation decision", http.StatusBadRequest)
+		return
+	}
+
+	cmt, err := h.Service.ModerateComment(ctx, id, req.Status)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		switch {
+		case errors.Is(err, comment.ErrFetchingComment):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, comment.ErrInvalidModerationStatus):
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(cmt); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
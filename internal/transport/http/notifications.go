@@ -0,0 +1,190 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type NotificationService interface {
+	ListNotifications(ctx context.Context, unreadOnly bool, limit int, offset int) (datastructs.NotificationList, error)
+	MarkNotificationsRead(ctx context.Context, ids []string) error
+	GetNotificationPreferences(ctx context.Context) (datastructs.NotificationPreferences, error)
+	UpdateNotificationPreferences(ctx context.Context, prefs datastructs.NotificationPreferences) (datastructs.NotificationPreferences, error)
+}
+
+// Validate input from http request, no ids marks everything read
+type MarkNotificationsReadRequest struct {
+	IDs []string `json:"ids" validate:"dive,uuid"`
+}
+
+// Validate input from http request
+type NotificationPreferencesRequest struct {
+	Mentions      *bool `json:"mentions" validate:"required"`
+	Replies       *bool `json:"replies" validate:"required"`
+	Subscriptions *bool `json:"subscriptions" validate:"required"`
+	// Digests are only sent with an email address to send them to
+	Email           string `json:"email" validate:"omitempty,email"`
+	DigestFrequency string `json:"digest_frequency" validate:"omitempty,oneof=off hourly daily"`
+}
+
+// notificationErrorStatus - the status for errors any notification endpoint can return
+func notificationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, comment.ErrNotAuthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, comment.ErrInvalidNotificationQuery),
+		errors.Is(err, comment.ErrInvalidNotificationPreferences):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// ListNotifications - GET /api/v1/me/notifications?unread=true&limit=...&offset=...
+func (h *Handler) ListNotifications(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "ListNotifications", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		http.Error(w, "limit must be a number", http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(r, "offset")
+	if err != nil {
+		http.Error(w, "offset must be a number", http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.Service.ListNotifications(ctx, r.URL.Query().Get("unread") == "true", limit, offset)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(notificationErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+// MarkNotificationsRead - POST /api/v1/me/notifications/read with an optional {"ids": [...]}
+func (h *Handler) MarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "MarkNotificationsRead", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var req MarkNotificationsReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not a valid list of notifications", http.StatusBadRequest)
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not a valid list of notifications", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.MarkNotificationsRead(ctx, req.IDs); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(notificationErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(Response{Message: "Successfully marked read"}); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+func (h *Handler) GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "GetNotificationPreferences", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	prefs, err := h.Service.GetNotificationPreferences(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(notificationErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(prefs); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+func (h *Handler) UpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "UpdateNotificationPreferences", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var req NotificationPreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not valid notification preferences", http.StatusBadRequest)
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not valid notification preferences", http.StatusBadRequest)
+		return
+	}
+
+	prefs, err := h.Service.UpdateNotificationPreferences(ctx, datastructs.NotificationPreferences{
+		Mentions:        *req.Mentions,
+		Replies:         *req.Replies,
+		Subscriptions:   *req.Subscriptions,
+		Email:           req.Email,
+		DigestFrequency: req.DigestFrequency,
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(notificationErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(prefs); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
@@ -0,0 +1,160 @@
+package http
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+// openAPISpec - the OpenAPI 3 document describing every route in
+// mapRoutes, requests are validated against it before being handled
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+func init() {
+	// Formats the validator tags check that OpenAPI leaves to servers
+	openapi3.DefineStringFormat("uuid", openapi3.FormatOfStringForUUIDOfRFC4122)
+	openapi3.DefineStringFormat("email", openapi3.FormatOfStringForEmail)
+}
+
+// LoadOpenAPISpec - parses and checks the embedded OpenAPI document
+func LoadOpenAPISpec(ctx context.Context) (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(openAPISpec)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Validate(ctx); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// OpenAPI - GET /api/v1/openapi.json, the document requests are validated against
+func (h *Handler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	if _, err := w.Write(openAPISpec); err != nil {
+		panic(err)
+	}
+}
+
+// ValidationMiddleware - refuses requests whose parameters or body do
+// not match the OpenAPI document with a 400, so the document and the
+// handlers can not drift apart. Routes the document secures are only
+// checked once JWTAuth or RoleAuth has let the caller in, so callers
+// can not learn what a route accepts without being allowed to use it.
+// Routes the document does not describe are left to the router to refuse
+func ValidationMiddleware(doc *openapi3.T) (func(http.Handler) http.Handler, error) {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			route, pathParams, err := router.FindRoute(r)
+			if errors.Is(err, routers.ErrPathNotFound) || errors.Is(err, routers.ErrMethodNotAllowed) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			check := func(w http.ResponseWriter, r *http.Request) bool {
+				return validateRequest(w, r, route, pathParams)
+			}
+			if route.Operation.Security != nil && len(*route.Operation.Security) > 0 {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), validationContextKey, check)))
+				return
+			}
+			if check(w, r) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}, nil
+}
+
+type contextKey string
+
+// validationContextKey - holds the check ValidationMiddleware
+// left for the auth wrappers to run once they let a caller in
+const validationContextKey contextKey = "validation"
+
+// validated - runs the check ValidationMiddleware left on
+// the request, if any, before handing it to orignal
+func validated(
+	orignal func(w http.ResponseWriter, r *http.Request),
+) func(w http.ResponseWriter, r *http.Request) {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		check, ok := r.Context().Value(validationContextKey).(func(http.ResponseWriter, *http.Request) bool)
+		if ok && !check(w, r) {
+			return
+		}
+		orignal(w, r)
+	}
+}
+
+// validateRequest - checks the request against its operation,
+// answering with a 400 and returning false when it does not match
+func validateRequest(w http.ResponseWriter, r *http.Request, route *routers.Route, pathParams map[string]string) bool {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "ValidateRequest", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	// Handlers read every body as JSON whether or not it says so
+	if r.ContentLength != 0 && r.Header.Get("Content-Type") == "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+
+	err := openapi3filter.ValidateRequest(ctx, &openapi3filter.RequestValidationInput{
+		Request:    r,
+		PathParams: pathParams,
+		Route:      route,
+		Options: &openapi3filter.Options{
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		},
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, validationErrorMessage(err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// validationErrorMessage - what was wrong with the request, without
+// the schema the validator appends to its errors
+func validationErrorMessage(err error) string {
+	var reqErr *openapi3filter.RequestError
+	if !errors.As(err, &reqErr) {
+		return err.Error()
+	}
+	var schemaErr *openapi3.SchemaError
+	if errors.As(reqErr.Err, &schemaErr) {
+		msg := schemaErr.Reason
+		if path := schemaErr.JSONPointer(); len(path) > 0 {
+			msg = "/" + strings.Join(path, "/") + ": " + msg
+		}
+		if reqErr.Parameter != nil {
+			return "parameter " + reqErr.Parameter.Name + " " + msg
+		}
+		return "request body " + msg
+	}
+	return reqErr.Error()
+}
@@ -0,0 +1,225 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+
+	doc, err := LoadOpenAPISpec(context.Background())
+	require.NoError(t, err)
+
+	t.Run("documents every route", func(t *testing.T) {
+		h := NewHandler(nil)
+		err := h.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+			path, err := route.GetPathTemplate()
+			require.NoError(t, err)
+			methods, err := route.GetMethods()
+			if err != nil {
+				methods = []string{http.MethodGet}
+			}
+
+			item := doc.Paths.Find(path)
+			if !assert.NotNil(t, item, path) {
+				return nil
+			}
+			for _, method := range methods {
+				assert.NotNil(t, item.GetOperation(method), method+" "+path)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+	})
+
+	validate, err := ValidationMiddleware(doc)
+	require.NoError(t, err)
+
+	serveAs := func(wrap func(func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request),
+		token, method, target, body string) (*httptest.ResponseRecorder, bool) {
+		handled := false
+		next := wrap(func(w http.ResponseWriter, r *http.Request) { handled = true })
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		validate(http.HandlerFunc(next)).ServeHTTP(rec, req)
+		return rec, handled
+	}
+	// Anonymous callers are let through, so every request is checked
+	serve := func(method, target, body string) (*httptest.ResponseRecorder, bool) {
+		return serveAs(OptionalJWTAuth, "", method, target, body)
+	}
+
+	t.Run("passes requests that match", func(t *testing.T) {
+		_, handled := serve(http.MethodPost, "/api/v1/comment", `{"slug": "/", "author": "Imraan", "body": "hello world"}`)
+		assert.True(t, handled)
+
+		_, handled = serve(http.MethodGet, "/api/v1/comments?slug=post&sort=top&limit=20", "")
+		assert.True(t, handled)
+
+		_, handled = serve(http.MethodGet, "/api/v1/counts?slug=a&slug=b", "")
+		assert.True(t, handled)
+
+		// The body of a pin is optional
+		_, handled = serve(http.MethodPut, "/api/v1/comment/1/pin", "")
+		assert.True(t, handled)
+	})
+
+	t.Run("refuses requests that do not", func(t *testing.T) {
+		rec, handled := serve(http.MethodPost, "/api/v1/comment", `{"slug": "/", "body": "hello world"}`)
+		assert.False(t, handled)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "author")
+
+		rec, handled = serve(http.MethodPost, "/api/v1/comment", `{"slug": "/", "author": "Imraan", "body": "hi", "parent_id": "nope"}`)
+		assert.False(t, handled)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec, handled = serve(http.MethodGet, "/api/v1/comments?slug=post&sort=sideways", "")
+		assert.False(t, handled)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec, handled = serve(http.MethodPut, "/api/v1/comment/1/reactions/shrug", "")
+		assert.False(t, handled)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("checks secured routes only once the caller is let in", func(t *testing.T) {
+		bad := `{"url": "https://example.com/hook", "secret": "short"}`
+
+		rec, _ := serveAs(AdminAuth, "", http.MethodPost, "/api/v1/admin/webhooks", bad)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		rec, _ = serveAs(AdminAuth, signToken(t, "editor"), http.MethodPost, "/api/v1/admin/webhooks", bad)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		rec, _ = serveAs(AdminAuth, signToken(t, "admin"), http.MethodPost, "/api/v1/admin/webhooks", bad)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "secret")
+
+		rec, _ = serveAs(JWTAuth, "", http.MethodPost, "/api/v1/comment", `{"slug": "/"}`)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		rec, handled := serveAs(JWTAuth, signToken(t, ""), http.MethodPost, "/api/v1/comment", `{"slug": "/"}`)
+		assert.False(t, handled)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("leaves routes it does not describe to the router", func(t *testing.T) {
+		_, handled := serve(http.MethodGet, "/nowhere", "")
+		assert.True(t, handled)
+	})
+}
+
+func signToken(t *testing.T, role string) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "user-1", "role": role}).
+		SignedString([]byte("mission impossible"))
+	require.NoError(t, err)
+	return token
+}
+
+// TestRequestSchemas - the document and the validator tags on
+// the request structs must agree on what a request may contain
+func TestRequestSchemas(t *testing.T) {
+
+	doc, err := LoadOpenAPISpec(context.Background())
+	require.NoError(t, err)
+
+	for _, req := range []any{
+		PostCommentRequest{}, UpdateCommentRequest{}, ModerationRequest{},
+		MarkNotificationsReadRequest{}, NotificationPreferencesRequest{},
+		PIISettingsRequest{}, PinRequest{}, RuleRequest{}, SubscribeRequest{},
+		ThreadRequest{}, AcceptAnswerRequest{}, WebhookRequest{}, SocketRequest{},
+	} {
+		typ := reflect.TypeOf(req)
+		ref, ok := doc.Components.Schemas[typ.Name()]
+		if !assert.True(t, ok, typ.Name()) {
+			continue
+		}
+		schema := ref.Value
+
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			jsonName := strings.Split(field.Tag.Get("json"), ",")[0]
+			where := typ.Name() + "." + jsonName
+			prop, ok := schema.Properties[jsonName]
+			if !assert.True(t, ok, where) {
+				continue
+			}
+			checkValidateTag(t, where, field, prop.Value, schema.Required)
+		}
+	}
+}
+
+func checkValidateTag(t *testing.T, where string, field reflect.StructField, prop *openapi3.Schema, required []string) {
+	jsonName := strings.Split(field.Tag.Get("json"), ",")[0]
+	rules := strings.Split(field.Tag.Get("validate"), ",")
+
+	isRequired := false
+	for i, rule := range rules {
+		name, value, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			isRequired = true
+		case "dive":
+			// The rules after dive are for the items
+			checkItemRules(t, where, rules[i+1:], prop.Items.Value)
+			return
+		case "oneof":
+			for _, allowed := range strings.Fields(value) {
+				assert.Contains(t, prop.Enum, allowed, where)
+			}
+		case "min":
+			n, err := strconv.ParseUint(value, 10, 64)
+			require.NoError(t, err, where)
+			if field.Type.Kind() == reflect.Slice {
+				assert.Equal(t, n, prop.MinItems, where)
+			} else {
+				assert.Equal(t, n, prop.MinLength, where)
+			}
+		case "gte":
+			n, err := strconv.ParseFloat(value, 64)
+			require.NoError(t, err, where)
+			if assert.NotNil(t, prop.Min, where) {
+				assert.Equal(t, n, *prop.Min, where)
+			}
+		case "uuid", "email":
+			assert.Equal(t, name, prop.Format, where)
+		}
+	}
+	inRequired := false
+	for _, name := range required {
+		inRequired = inRequired || name == jsonName
+	}
+	assert.Equal(t, isRequired, inRequired, where)
+}
+
+func checkItemRules(t *testing.T, where string, rules []string, items *openapi3.Schema) {
+	for _, rule := range rules {
+		name, value, _ := strings.Cut(rule, "=")
+		switch name {
+		case "oneof":
+			for _, allowed := range strings.Fields(value) {
+				assert.Contains(t, items.Enum, allowed, where)
+			}
+		case "uuid", "email":
+			assert.Equal(t, name, items.Format, where)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type PIIService interface {
+	GetPIISettings(ctx context.Context, site string) (datastructs.PIISettings, error)
+	UpdatePIISettings(ctx context.Context, settings datastructs.PIISettings) (datastructs.PIISettings, error)
+}
+
+// Validate input from http request
+type PIISettingsRequest struct {
+	Mode string `json:"mode" validate:"required,oneof=redact reject flag"`
+}
+
+func (h *Handler) GetPIISettings(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "GetPIISettings", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	site := mux.Vars(r)["site"]
+	if site == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	settings, err := h.Service.GetPIISettings(ctx, site)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(settings); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+func (h *Handler) UpdatePIISettings(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "UpdatePIISettings", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	site := mux.Vars(r)["site"]
+	if site == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var req PIISettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not valid pii settings", http.StatusBadRequest)
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not valid pii settings", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := h.Service.UpdatePIISettings(ctx, datastructs.PIISettings{
+		Site: site,
+		Mode: req.Mode,
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(settings); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
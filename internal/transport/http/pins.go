@@ -0,0 +1,130 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type PinService interface {
+	PinComment(ctx context.Context, ID string, position int) (datastructs.Comment, error)
+	UnpinComment(ctx context.Context, ID string) (datastructs.Comment, error)
+	FeatureComment(ctx context.Context, ID string, featured bool) (datastructs.Comment, error)
+}
+
+// Validate input from http request, the body is optional
+type PinRequest struct {
+	Position int `json:"position" validate:"gte=0"`
+}
+
+// PinComment - PUT /api/v1/comment/{id}/pin with an optional {"position": n}
+func (h *Handler) PinComment(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "PinComment", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var req PinRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not a valid pin", http.StatusBadRequest)
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not a valid pin", http.StatusBadRequest)
+		return
+	}
+
+	h.changePin(ctx, w, r, func(id string) (datastructs.Comment, error) {
+		return h.Service.PinComment(ctx, id, req.Position)
+	})
+}
+
+func (h *Handler) UnpinComment(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "UnpinComment", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	h.changePin(ctx, w, r, func(id string) (datastructs.Comment, error) {
+		return h.Service.UnpinComment(ctx, id)
+	})
+}
+
+// FeatureComment - PUT /api/v1/comment/{id}/feature makes the comment an editor's pick
+func (h *Handler) FeatureComment(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "FeatureComment", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	h.changePin(ctx, w, r, func(id string) (datastructs.Comment, error) {
+		return h.Service.FeatureComment(ctx, id, true)
+	})
+}
+
+func (h *Handler) UnfeatureComment(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "UnfeatureComment", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	h.changePin(ctx, w, r, func(id string) (datastructs.Comment, error) {
+		return h.Service.FeatureComment(ctx, id, false)
+	})
+}
+
+func (h *Handler) changePin(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	change func(id string) (datastructs.Comment, error),
+) {
+
+	span := tr.SpanFromContext(ctx)
+
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	cmt, err := change(id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		switch {
+		case errors.Is(err, comment.ErrFetchingComment):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, comment.ErrInvalidPinPosition):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(cmt); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
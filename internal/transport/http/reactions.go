@@ -0,0 +1,94 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type ReactionService interface {
+	AddReaction(ctx context.Context, commentID string, reaction string) (datastructs.Comment, error)
+	RemoveReaction(ctx context.Context, commentID string, reaction string) (datastructs.Comment, error)
+}
+
+// reactionErrorStatus - the status for errors any reaction endpoint can return
+func reactionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, comment.ErrNotAuthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, comment.ErrInvalidReaction):
+		return http.StatusBadRequest
+	case errors.Is(err, comment.ErrFetchingComment):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// AddReaction - votes on or reacts to a comment as the caller
+func (h *Handler) AddReaction(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "AddReaction", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	h.changeReaction(ctx, w, r, h.Service.AddReaction)
+}
+
+// RemoveReaction - takes back the caller's vote or reaction
+func (h *Handler) RemoveReaction(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "RemoveReaction", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	h.changeReaction(ctx, w, r, h.Service.RemoveReaction)
+}
+
+func (h *Handler) changeReaction(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	change func(context.Context, string, string) (datastructs.Comment, error),
+) {
+
+	span := tr.SpanFromContext(ctx)
+
+	vars := mux.Vars(r)
+	id, reaction := vars["id"], vars["reaction"]
+	if id == "" || reaction == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	cmt, err := change(ctx, id, reaction)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		switch status := reactionErrorStatus(err); status {
+		case http.StatusUnauthorized:
+			http.Error(w, "not authorized", status)
+		case http.StatusBadRequest:
+			http.Error(w, "not a valid reaction", status)
+		default:
+			w.WriteHeader(status)
+		}
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(cmt); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
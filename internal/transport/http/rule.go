@@ -0,0 +1,302 @@
+package http
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/imraan1901/comment-section-rest-api/internal/processor"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type RuleService interface {
+	GetRule(ctx context.Context, ID string) (datastructs.Rule, error)
+	ListRules(ctx context.Context) ([]datastructs.Rule, error)
+	PostRule(ctx context.Context, rule datastructs.Rule) (datastructs.Rule, error)
+	UpdateRule(ctx context.Context, ID string, rule datastructs.Rule) (datastructs.Rule, error)
+	DeleteRule(ctx context.Context, ID string) error
+	DryRunRule(ctx context.Context, rule datastructs.Rule, limit int) ([]datastructs.Comment, error)
+}
+
+// Validate input from http request
+type RuleRequest struct {
+	Name       string                      `json:"name" validate:"required"`
+	Conditions []datastructs.RuleCondition `json:"conditions" validate:"required,min=1"`
+	Action     string                      `json:"action" validate:"required,oneof=flag hold spam reject"`
+	Enabled    *bool                       `json:"enabled"`
+}
+
+func convertRuleRequestToRule(r RuleRequest) datastructs.Rule {
+	// Rules are enabled unless the caller says otherwise
+	enabled := true
+	if r.Enabled != nil {
+		enabled = *r.Enabled
+	}
+	return datastructs.Rule{
+		Name:       r.Name,
+		Conditions: r.Conditions,
+		Action:     r.Action,
+		Enabled:    enabled,
+	}
+}
+
+func decodeRuleRequest(r *http.Request) (datastructs.Rule, error) {
+	var req RuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return datastructs.Rule{}, err
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		return datastructs.Rule{}, err
+	}
+	return convertRuleRequestToRule(req), nil
+}
+
+// ruleErrorStatus - invalid rules and rules that do not
+// exist are the caller's fault, anything else is ours
+func ruleErrorStatus(err error) int {
+	if errors.Is(err, processor.ErrInvalidRule) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *Handler) ListRules(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "ListRules", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	rules, err := h.Service.ListRules(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(rules); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+func (h *Handler) GetRule(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "GetRule", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	rule, err := h.Service.GetRule(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(ruleErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(rule); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+func (h *Handler) PostRule(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "PostRule", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	rule, err := decodeRuleRequest(r)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not a valid rule", http.StatusBadRequest)
+		return
+	}
+
+	postedRule, err := h.Service.PostRule(ctx, rule)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		http.Error(w, err.Error(), ruleErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(postedRule); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+func (h *Handler) UpdateRule(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "UpdateRule", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	rule, err := decodeRuleRequest(r)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not a valid rule", http.StatusBadRequest)
+		return
+	}
+
+	updatedRule, err := h.Service.UpdateRule(ctx, id, rule)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		http.Error(w, err.Error(), ruleErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(updatedRule); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+func (h *Handler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "DeleteRule", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.DeleteRule(ctx, id); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(ruleErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(Response{Message: "Successfully deleted"}); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+// DryRunRule - evaluates the rule in the request body against
+// recent comments without saving it
+func (h *Handler) DryRunRule(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "DryRunRule", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	rule, err := decodeRuleRequest(r)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not a valid rule", http.StatusBadRequest)
+		return
+	}
+
+	h.writeDryRun(ctx, w, r, rule)
+}
+
+// DryRunSavedRule - evaluates an existing rule against recent comments
+func (h *Handler) DryRunSavedRule(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "DryRunSavedRule", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	rule, err := h.Service.GetRule(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(ruleErrorStatus(err))
+		return
+	}
+
+	h.writeDryRun(ctx, w, r, rule)
+}
+
+type DryRunResponse struct {
+	Rule    datastructs.Rule
+	Matched []datastructs.Comment
+}
+
+func (h *Handler) writeDryRun(ctx context.Context, w http.ResponseWriter, r *http.Request, rule datastructs.Rule) {
+
+	span := tr.SpanFromContext(ctx)
+
+	limit := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 0 || parsed > 1000 {
+			http.Error(w, "limit must be between 0 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	matched, err := h.Service.DryRunRule(ctx, rule, limit)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		http.Error(w, err.Error(), ruleErrorStatus(err))
+		return
+	}
+
+	resp := DryRunResponse{
+		Rule:    rule,
+		Matched: matched,
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type SearchService interface {
+	SearchComments(ctx context.Context, q datastructs.SearchQuery) (datastructs.SearchResults, error)
+}
+
+// queryInt - reads an optional integer query parameter
+func queryInt(r *http.Request, key string) (int, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// SearchComments - GET /api/v1/comments/search?q=...&slug=...&limit=...&offset=...
+func (h *Handler) SearchComments(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "SearchComments", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		http.Error(w, "limit must be a number", http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(r, "offset")
+	if err != nil {
+		http.Error(w, "offset must be a number", http.StatusBadRequest)
+		return
+	}
+
+	results, err := h.Service.SearchComments(ctx, datastructs.SearchQuery{
+		Query:  r.URL.Query().Get("q"),
+		Slug:   r.URL.Query().Get("slug"),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if errors.Is(err, comment.ErrInvalidSearch) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
@@ -0,0 +1,128 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
+	"github.com/imraan1901/comment-section-rest-api/internal/processor"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type SpamService interface {
+	RetrainSpamModel(ctx context.Context) (processor.SpamModel, error)
+	ExportSpamModel(ctx context.Context) (processor.SpamModel, error)
+	ImportSpamModel(ctx context.Context, model processor.SpamModel) error
+}
+
+// spamErrorStatus - maps errors from the spam service to a status code
+func spamErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, comment.ErrNotImplemented):
+		return http.StatusNotImplemented
+	case errors.Is(err, processor.ErrInvalidSpamModel):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// SpamModelSummary - what a retrain reports back,
+// the full model can be fetched from the export endpoint
+type SpamModelSummary struct {
+	SpamDocs   int
+	HamDocs    int
+	Vocabulary int
+}
+
+func summariseSpamModel(m processor.SpamModel) SpamModelSummary {
+	vocab := len(m.SpamCounts)
+	for t := range m.HamCounts {
+		if _, ok := m.SpamCounts[t]; !ok {
+			vocab++
+		}
+	}
+	return SpamModelSummary{
+		SpamDocs:   m.SpamDocs,
+		HamDocs:    m.HamDocs,
+		Vocabulary: vocab,
+	}
+}
+
+func (h *Handler) RetrainSpamModel(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "RetrainSpamModel", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	model, err := h.Service.RetrainSpamModel(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(spamErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(summariseSpamModel(model)); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+func (h *Handler) ExportSpamModel(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "ExportSpamModel", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	model, err := h.Service.ExportSpamModel(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(spamErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(model); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+func (h *Handler) ImportSpamModel(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "ImportSpamModel", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var model processor.SpamModel
+	if err := json.NewDecoder(r.Body).Decode(&model); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not a valid spam model", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.ImportSpamModel(ctx, model); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(spamErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(summariseSpamModel(model)); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
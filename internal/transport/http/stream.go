@@ -0,0 +1,125 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/imraan1901/comment-section-rest-api/internal/events"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// streamHeartbeat - how often an idle stream is sent a comment,
+	// keeping proxies from closing it and noticing clients that left
+	streamHeartbeat = 15 * time.Second
+	// streamRetry - how long browsers wait before reconnecting
+	streamRetry = 3 * time.Second
+)
+
+// StreamComments - GET /api/v1/comments/stream?slug=..., the slug's new,
+// edited and deleted comments as Server-Sent Events. A client that
+// reconnects with Last-Event-ID is sent what it missed first, one that
+// falls too far behind is disconnected and can reconnect the same way
+func (h *Handler) StreamComments(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(r.Context(), "StreamComments", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	slug := r.URL.Query().Get("slug")
+	if slug == "" {
+		http.Error(w, "slug is required", http.StatusBadRequest)
+		return
+	}
+	if h.Hub == nil {
+		http.Error(w, "streaming is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sub, err := h.Hub.Subscribe(clientAddr(r))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, events.ErrTooManySubscribers) {
+			w.Header().Set("Retry-After", fmt.Sprint(int(streamRetry.Seconds())))
+			http.Error(w, "too many streams, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer sub.Close()
+	missed := sub.Follow(slug, r.Header.Get("Last-Event-ID"))
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Stop nginx buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds()); err != nil {
+		return
+	}
+	for _, evt := range missed {
+		if err := writeStreamEvent(w, evt); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.shutdown:
+			return
+		case <-sub.Done():
+			if sub.Lagged() {
+				log.Printf("dropped a stream of %s for falling behind", slug)
+			}
+			return
+		case evt := <-sub.Events():
+			if err := writeStreamEvent(w, evt); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeStreamEvent - writes the event as readers see it, events
+// readers should not see are skipped
+func writeStreamEvent(w http.ResponseWriter, evt datastructs.Event) error {
+	evt, ok := comment.PublicEvent(evt)
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(evt.Comment)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", evt.ID, evt.Type, data)
+	return err
+}
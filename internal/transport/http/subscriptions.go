@@ -0,0 +1,215 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type SubscriptionService interface {
+	Subscribe(ctx context.Context, slug string, commentID string) (datastructs.Subscription, error)
+	ListSubscriptions(ctx context.Context) ([]datastructs.Subscription, error)
+	Unsubscribe(ctx context.Context, ID string) error
+	UnsubscribeByToken(ctx context.Context, token string) error
+	UnsubscribeFromDigests(ctx context.Context, digestID string) error
+}
+
+// unsubscribePage - asks before unsubscribing, links in emails are
+// followed with a GET by mail scanners as well as people so only the
+// POST the form makes unsubscribes
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<body>
+<form method="post" action="{{.}}">
+<p>Stop getting these emails?</p>
+<button type="submit">Unsubscribe</button>
+</form>
+</body>
+</html>
+`))
+
+// Validate input from http request, a slug follows the whole
+// slug and a comment id only the replies under that comment
+type SubscribeRequest struct {
+	Slug      string `json:"slug" validate:"required_without=CommentID"`
+	CommentID string `json:"comment_id" validate:"omitempty,uuid"`
+}
+
+// subscriptionErrorStatus - the status for errors any subscription endpoint can return
+func subscriptionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, comment.ErrNotAuthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, comment.ErrInvalidSubscription):
+		return http.StatusBadRequest
+	case errors.Is(err, comment.ErrFetchingComment), errors.Is(err, comment.ErrSubscriptionNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *Handler) Subscribe(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "Subscribe", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var req SubscribeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not a valid subscription", http.StatusBadRequest)
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not a valid subscription", http.StatusBadRequest)
+		return
+	}
+
+	sub, err := h.Service.Subscribe(ctx, req.Slug, req.CommentID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(subscriptionErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(sub); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+func (h *Handler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "ListSubscriptions", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	subs, err := h.Service.ListSubscriptions(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(subscriptionErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(subs); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+func (h *Handler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "Unsubscribe", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.Unsubscribe(ctx, id); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(subscriptionErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(Response{Message: "Successfully unsubscribed"}); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+// ConfirmUnsubscribe - GET on an unsubscribe link, a page
+// with a button that POSTs back to the link to unsubscribe
+func (h *Handler) ConfirmUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := unsubscribePage.Execute(w, r.URL.Path); err != nil {
+		log.Print(err)
+	}
+}
+
+// UnsubscribeByToken - POST /api/v1/unsubscribe/{token}, the one click
+// unsubscribe link (RFC 8058) sent with subscription notifications
+func (h *Handler) UnsubscribeByToken(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "UnsubscribeByToken", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	token := mux.Vars(r)["token"]
+	if token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.UnsubscribeByToken(ctx, token); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(subscriptionErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(Response{Message: "Successfully unsubscribed"}); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+// UnsubscribeFromDigests - POST /api/v1/digests/{id}/unsubscribe, the
+// one click unsubscribe (RFC 8058) sent in every digest's headers
+func (h *Handler) UnsubscribeFromDigests(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "UnsubscribeFromDigests", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.UnsubscribeFromDigests(ctx, id); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(subscriptionErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(Response{Message: "Successfully unsubscribed"}); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
@@ -0,0 +1,288 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type ThreadService interface {
+	GetThread(ctx context.Context, slug string) (datastructs.Thread, error)
+	ListThreads(ctx context.Context, q datastructs.ThreadQuery) ([]datastructs.Thread, error)
+	UpdateThread(ctx context.Context, thread datastructs.Thread) (datastructs.Thread, error)
+	DeleteThread(ctx context.Context, slug string) error
+	AcceptAnswer(ctx context.Context, slug string, commentID string) (datastructs.Thread, error)
+	UnacceptAnswer(ctx context.Context, slug string) (datastructs.Thread, error)
+}
+
+// Validate input from http request
+type ThreadRequest struct {
+	State          string `json:"state" validate:"required,oneof=open closed locked archived"`
+	MaxLength      int    `json:"max_length" validate:"gte=0"`
+	ModerationMode string `json:"moderation_mode" validate:"omitempty,oneof=post pre"`
+	Kind           string `json:"kind" validate:"omitempty,oneof=discussion question"`
+	Owner          string `json:"owner"`
+}
+
+// Validate input from http request
+type AcceptAnswerRequest struct {
+	CommentID string `json:"comment_id" validate:"required"`
+}
+
+// threadErrorStatus - the status for a comment the thread
+// settings turned away, zero when the error is not one of those
+func threadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, comment.ErrThreadClosed), errors.Is(err, comment.ErrThreadLocked):
+		return http.StatusForbidden
+	case errors.Is(err, comment.ErrCommentTooLong):
+		return http.StatusBadRequest
+	}
+	return 0
+}
+
+// ListThreads - GET /api/v1/threads?state=...&kind=...&answered=true|false
+func (h *Handler) ListThreads(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "ListThreads", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	q := datastructs.ThreadQuery{
+		State: r.URL.Query().Get("state"),
+		Kind:  r.URL.Query().Get("kind"),
+	}
+	if value := r.URL.Query().Get("answered"); value != "" {
+		answered, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "answered must be true or false", http.StatusBadRequest)
+			return
+		}
+		q.Answered = &answered
+	}
+
+	threads, err := h.Service.ListThreads(ctx, q)
+	if errors.Is(err, comment.ErrInvalidThread) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not a valid thread query", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(threads); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+func (h *Handler) GetThread(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "GetThread", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	slug := mux.Vars(r)["slug"]
+	if slug == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	thread, err := h.Service.GetThread(ctx, slug)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(thread); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+func (h *Handler) UpdateThread(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "UpdateThread", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	slug := mux.Vars(r)["slug"]
+	if slug == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var req ThreadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not valid thread settings", http.StatusBadRequest)
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not valid thread settings", http.StatusBadRequest)
+		return
+	}
+
+	thread, err := h.Service.UpdateThread(ctx, datastructs.Thread{
+		Slug:           slug,
+		State:          req.State,
+		MaxLength:      req.MaxLength,
+		ModerationMode: req.ModerationMode,
+		Kind:           req.Kind,
+		Owner:          req.Owner,
+	})
+	if errors.Is(err, comment.ErrInvalidThread) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not valid thread settings", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(thread); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+// DeleteThread - resets the slug to the default thread settings
+func (h *Handler) DeleteThread(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "DeleteThread", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	slug := mux.Vars(r)["slug"]
+	if slug == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.DeleteThread(ctx, slug); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(Response{Message: "Successfully reset"}); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+// AcceptAnswer - PUT /api/v1/threads/{slug}/answer with {"comment_id": "..."}
+func (h *Handler) AcceptAnswer(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "AcceptAnswer", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	var req AcceptAnswerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not a valid answer", http.StatusBadRequest)
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not a valid answer", http.StatusBadRequest)
+		return
+	}
+
+	h.changeAnswer(ctx, w, r, func(slug string) (datastructs.Thread, error) {
+		return h.Service.AcceptAnswer(ctx, slug, req.CommentID)
+	})
+}
+
+func (h *Handler) UnacceptAnswer(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "UnacceptAnswer", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	h.changeAnswer(ctx, w, r, func(slug string) (datastructs.Thread, error) {
+		return h.Service.UnacceptAnswer(ctx, slug)
+	})
+}
+
+func (h *Handler) changeAnswer(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	change func(slug string) (datastructs.Thread, error),
+) {
+
+	span := tr.SpanFromContext(ctx)
+
+	slug := mux.Vars(r)["slug"]
+	if slug == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	thread, err := change(slug)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		switch {
+		case errors.Is(err, comment.ErrNotAuthenticated):
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+		case errors.Is(err, comment.ErrForbidden):
+			http.Error(w, "forbidden", http.StatusForbidden)
+		case errors.Is(err, comment.ErrNotQuestion), errors.Is(err, comment.ErrInvalidAnswer):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(thread); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
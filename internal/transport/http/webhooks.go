@@ -0,0 +1,298 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type WebhookService interface {
+	GetWebhook(ctx context.Context, ID string) (datastructs.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]datastructs.Webhook, error)
+	PostWebhook(ctx context.Context, hook datastructs.Webhook) (datastructs.Webhook, error)
+	UpdateWebhook(ctx context.Context, ID string, hook datastructs.Webhook) (datastructs.Webhook, error)
+	DeleteWebhook(ctx context.Context, ID string) error
+	ListWebhookDeliveries(ctx context.Context, q datastructs.WebhookDeliveryQuery) ([]datastructs.WebhookDelivery, error)
+	ReplayWebhookDelivery(ctx context.Context, webhookID string, deliveryID string) (datastructs.WebhookDelivery, error)
+}
+
+// Validate input from http request, no events means every event
+type WebhookRequest struct {
+	URL    string   `json:"url" validate:"required,url"`
+	Events []string `json:"events" validate:"dive,oneof=comment.created comment.updated comment.deleted comment.moderated"`
+	Secret string   `json:"secret" validate:"omitempty,min=16"`
+	Active *bool    `json:"active"`
+}
+
+func decodeWebhookRequest(r *http.Request) (datastructs.Webhook, error) {
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return datastructs.Webhook{}, err
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		return datastructs.Webhook{}, err
+	}
+
+	// Webhooks are active unless the caller says otherwise
+	active := true
+	if req.Active != nil {
+		active = *req.Active
+	}
+	events := req.Events
+	if events == nil {
+		events = []string{}
+	}
+	return datastructs.Webhook{
+		URL:    req.URL,
+		Events: events,
+		Secret: req.Secret,
+		Active: active,
+	}, nil
+}
+
+// webhookErrorStatus - the status for errors any webhook endpoint can return
+func webhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, comment.ErrInvalidWebhook),
+		errors.Is(err, comment.ErrInvalidWebhookDeliveryList):
+		return http.StatusBadRequest
+	case errors.Is(err, comment.ErrWebhookNotFound),
+		errors.Is(err, comment.ErrDeliveryNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, comment.ErrDeliveryNotFailed):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "ListWebhooks", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	hooks, err := h.Service.ListWebhooks(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(hooks); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+func (h *Handler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "GetWebhook", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	hook, err := h.Service.GetWebhook(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(webhookErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(hook); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+// PostWebhook - the response carries the secret deliveries
+// are signed with, it is not shown again
+func (h *Handler) PostWebhook(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "PostWebhook", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	hook, err := decodeWebhookRequest(r)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not a valid webhook", http.StatusBadRequest)
+		return
+	}
+
+	posted, err := h.Service.PostWebhook(ctx, hook)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		http.Error(w, err.Error(), webhookErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(posted); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+func (h *Handler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "UpdateWebhook", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	hook, err := decodeWebhookRequest(r)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "not a valid webhook", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.Service.UpdateWebhook(ctx, id, hook)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		http.Error(w, err.Error(), webhookErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(updated); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "DeleteWebhook", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.DeleteWebhook(ctx, id); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		w.WriteHeader(webhookErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(Response{Message: "Successfully deleted"}); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+// ListWebhookDeliveries - GET /api/v1/admin/webhooks/{id}/deliveries?status=failed&limit=...&offset=...
+func (h *Handler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "ListWebhookDeliveries", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		http.Error(w, "limit must be a number", http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(r, "offset")
+	if err != nil {
+		http.Error(w, "offset must be a number", http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := h.Service.ListWebhookDeliveries(ctx, datastructs.WebhookDeliveryQuery{
+		WebhookID: id,
+		Status:    r.URL.Query().Get("status"),
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		http.Error(w, err.Error(), webhookErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(deliveries); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
+
+// ReplayWebhookDelivery - queues a failed delivery again, the
+// response is the new delivery
+func (h *Handler) ReplayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(r.Context(), "ReplayWebhookDelivery", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	vars := mux.Vars(r)
+	if vars["id"] == "" || vars["delivery"] == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := h.Service.ReplayWebhookDelivery(ctx, vars["id"], vars["delivery"])
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		http.Error(w, err.Error(), webhookErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(delivery); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		panic(err)
+	}
+}
@@ -0,0 +1,383 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/websocket"
+	"github.com/imraan1901/comment-section-rest-api/internal/comment"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/imraan1901/comment-section-rest-api/internal/events"
+	"github.com/imraan1901/comment-section-rest-api/internal/transport/auth"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// socketPingEvery - how often clients are pinged, one that has not
+	// answered within socketPongWait is disconnected
+	socketPingEvery = 30 * time.Second
+	socketPongWait  = 60 * time.Second
+	// socketWriteWait - how long a write may take before the client
+	// is given up on
+	socketWriteWait = 10 * time.Second
+	// socketMaxMessage - the largest message a client may send
+	socketMaxMessage = 64 * 1024
+	// socketMaxSlugs - the most slugs one connection may follow
+	socketMaxSlugs = 50
+	// socketQueueSize - how many replies may wait to be written
+	socketQueueSize = 16
+)
+
+// Types of message a client sends over the socket
+const (
+	SocketAuth           = "auth"
+	SocketSubscribe      = "subscribe"
+	SocketUnsubscribe    = "unsubscribe"
+	SocketPostComment    = "post_comment"
+	SocketAddReaction    = "add_reaction"
+	SocketRemoveReaction = "remove_reaction"
+)
+
+// Types of message the server sends that are not comment events
+const (
+	SocketReply = "reply"
+	SocketError = "error"
+)
+
+// SocketRequest - a message from a client, ID is the client's own
+// and is sent back on the reply. Browsers can not set headers on a
+// WebSocket so they authenticate with an auth message instead
+type SocketRequest struct {
+	ID          string              `json:"id"`
+	Type        string              `json:"type" validate:"required,oneof=auth subscribe unsubscribe post_comment add_reaction remove_reaction"`
+	Token       string              `json:"token" validate:"required_if=Type auth"`
+	Slug        string              `json:"slug" validate:"required_if=Type subscribe,required_if=Type unsubscribe"`
+	LastEventID string              `json:"last_event_id"`
+	CommentID   string              `json:"comment_id" validate:"required_if=Type add_reaction,required_if=Type remove_reaction"`
+	Reaction    string              `json:"reaction" validate:"required_if=Type add_reaction,required_if=Type remove_reaction"`
+	Comment     *PostCommentRequest `json:"comment" validate:"required_if=Type post_comment"`
+}
+
+// SocketMessage - a message to a client, either the reply to one of
+// its requests or, with the event's type, a comment event for a slug
+// it follows. Events are sent as readers of the thread see them
+type SocketMessage struct {
+	ID      string               `json:"id,omitempty"`
+	Type    string               `json:"type"`
+	Status  int                  `json:"status,omitempty"`
+	Error   string               `json:"error,omitempty"`
+	EventID string               `json:"event_id,omitempty"`
+	Comment *datastructs.Comment `json:"comment,omitempty"`
+}
+
+// followRequest - asks the writer to follow or unfollow a slug, the
+// writer follows it so the events missed are sent before any new ones
+type followRequest struct {
+	id          string
+	slug        string
+	lastEventID string
+}
+
+// outgoing - a reply or a slug to follow or unfollow, queued
+// in order so replies go out in the order requests came in and
+// a slug followed then unfollowed ends up unfollowed
+type outgoing struct {
+	msg      SocketMessage
+	follow   *followRequest
+	unfollow *followRequest
+}
+
+// checkOrigin - lets browsers connect from the origins in
+// AllowedOrigins, or from this host when there are none, so other
+// sites can not use a reader's browser to talk to the server.
+// Clients that are not browsers send no origin and may connect
+func (h *Handler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if len(h.AllowedOrigins) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	for _, allowed := range h.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// socket - one client's connection
+type socket struct {
+	h     *Handler
+	conn  *websocket.Conn
+	sub   *events.Subscription
+	queue chan outgoing
+	// closed - closed once the reader is done, written
+	// once the writer is done and nothing more can be sent
+	closed  chan struct{}
+	written chan struct{}
+}
+
+// Socket - GET /api/v1/ws, upgraded to a WebSocket on which clients
+// follow slugs to receive their comment events, and post comments
+// and react to them the way the REST endpoints do
+func (h *Handler) Socket(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+	_, span := otel.Tracer(name).Start(r.Context(), "Socket", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	if h.Hub == nil {
+		http.Error(w, "streaming is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	sub, err := h.Hub.Subscribe(clientAddr(r))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, events.ErrTooManySubscribers) {
+			http.Error(w, "too many streams, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer sub.Close()
+
+	upgrader := websocket.Upgrader{CheckOrigin: h.checkOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already replied
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	defer conn.Close()
+
+	s := &socket{
+		h:       h,
+		conn:    conn,
+		sub:     sub,
+		queue:   make(chan outgoing, socketQueueSize),
+		closed:  make(chan struct{}),
+		written: make(chan struct{}),
+	}
+	go s.write()
+	s.read(r.Context())
+}
+
+// read - handles the client's requests until it disconnects
+func (s *socket) read(ctx context.Context) {
+	defer close(s.closed)
+
+	s.conn.SetReadLimit(socketMaxMessage)
+	s.conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+
+	slugs := map[string]bool{}
+	for {
+		var req SocketRequest
+		if err := s.conn.ReadJSON(&req); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) {
+				return
+			}
+			if !s.reply(SocketMessage{Type: SocketError, Status: http.StatusBadRequest, Error: "not a valid message"}) {
+				return
+			}
+			continue
+		}
+
+		validate := validator.New()
+		if err := validate.Struct(req); err != nil {
+			if !s.reply(SocketMessage{ID: req.ID, Type: SocketError, Status: http.StatusBadRequest, Error: "not a valid message"}) {
+				return
+			}
+			continue
+		}
+
+		switch req.Type {
+		case SocketAuth:
+			claims, ok := auth.ValidateToken(req.Token)
+			if !ok {
+				if !s.reply(SocketMessage{ID: req.ID, Type: SocketError, Status: http.StatusUnauthorized, Error: "not authorized"}) {
+					return
+				}
+				continue
+			}
+			ctx = auth.WithClaims(ctx, claims)
+			if !s.reply(SocketMessage{ID: req.ID, Type: SocketReply, Status: http.StatusOK}) {
+				return
+			}
+		case SocketSubscribe:
+			if !slugs[req.Slug] && len(slugs) >= socketMaxSlugs {
+				if !s.reply(SocketMessage{ID: req.ID, Type: SocketError, Status: http.StatusBadRequest, Error: "following too many slugs"}) {
+					return
+				}
+				continue
+			}
+			slugs[req.Slug] = true
+			if !s.enqueue(outgoing{follow: &followRequest{id: req.ID, slug: req.Slug, lastEventID: req.LastEventID}}) {
+				return
+			}
+		case SocketUnsubscribe:
+			delete(slugs, req.Slug)
+			if !s.enqueue(outgoing{unfollow: &followRequest{id: req.ID, slug: req.Slug}}) {
+				return
+			}
+		default:
+			if !s.reply(s.handle(ctx, req)) {
+				return
+			}
+		}
+	}
+}
+
+// handle - carries out a request that changes comments, as the
+// REST endpoint for it would
+func (s *socket) handle(ctx context.Context, req SocketRequest) SocketMessage {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(ctx, "Socket."+req.Type, tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	// Only authenticated callers may change anything, as with JWTAuth,
+	// and the connection may have outlived the token it was opened with
+	if !auth.Authenticated(ctx) {
+		span.SetStatus(codes.Error, "not authorized")
+		return SocketMessage{ID: req.ID, Type: SocketError, Status: http.StatusUnauthorized, Error: "not authorized"}
+	}
+	if auth.Expired(ctx) {
+		span.SetStatus(codes.Error, "token expired")
+		return SocketMessage{ID: req.ID, Type: SocketError, Status: http.StatusUnauthorized, Error: "token expired"}
+	}
+
+	var cmt datastructs.Comment
+	var err error
+	status := 0
+	switch req.Type {
+	case SocketPostComment:
+		cmt, err = s.h.Service.PostComment(ctx, convertPostCommentRequestToComment(*req.Comment))
+		status = postCommentErrorStatus(err)
+	case SocketAddReaction:
+		cmt, err = s.h.Service.AddReaction(ctx, req.CommentID, req.Reaction)
+		status = reactionErrorStatus(err)
+	case SocketRemoveReaction:
+		cmt, err = s.h.Service.RemoveReaction(ctx, req.CommentID, req.Reaction)
+		status = reactionErrorStatus(err)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Print(err)
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		msg := err.Error()
+		if status >= http.StatusInternalServerError {
+			msg = http.StatusText(status)
+		}
+		return SocketMessage{ID: req.ID, Type: SocketError, Status: status, Error: msg}
+	}
+	return SocketMessage{ID: req.ID, Type: SocketReply, Status: http.StatusOK, Comment: &cmt}
+}
+
+// reply - queues a message for the writer, false once the
+// connection is going away
+func (s *socket) reply(msg SocketMessage) bool {
+	return s.enqueue(outgoing{msg: msg})
+}
+
+func (s *socket) enqueue(out outgoing) bool {
+	select {
+	case s.queue <- out:
+		return true
+	case <-s.written:
+		return false
+	}
+}
+
+// write - the only goroutine writing to the connection, it sends
+// replies, comment events and pings until the connection is done
+func (s *socket) write() {
+	ping := time.NewTicker(socketPingEvery)
+	defer ping.Stop()
+	defer close(s.written)
+	// Closing the connection ends the reader too
+	defer s.conn.Close()
+
+	for {
+		var err error
+		select {
+		case <-s.closed:
+			return
+		case <-s.h.shutdown:
+			s.close(websocket.CloseGoingAway, "server shutting down")
+			return
+		case <-s.sub.Done():
+			// Fell too far behind, the client can resubscribe
+			// with the last event it saw to catch up
+			s.close(websocket.ClosePolicyViolation, "too far behind")
+			return
+		case out := <-s.queue:
+			if out.unfollow != nil {
+				s.sub.Unfollow(out.unfollow.slug)
+				err = s.send(SocketMessage{ID: out.unfollow.id, Type: SocketReply, Status: http.StatusOK})
+				break
+			}
+			if out.follow == nil {
+				err = s.send(out.msg)
+				break
+			}
+			missed := s.sub.Follow(out.follow.slug, out.follow.lastEventID)
+			err = s.send(SocketMessage{ID: out.follow.id, Type: SocketReply, Status: http.StatusOK})
+			for _, evt := range missed {
+				if err == nil {
+					err = s.sendEvent(evt)
+				}
+			}
+		case evt := <-s.sub.Events():
+			err = s.sendEvent(evt)
+		case <-ping.C:
+			err = s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteWait))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *socket) send(msg SocketMessage) error {
+	s.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+	return s.conn.WriteJSON(msg)
+}
+
+// sendEvent - sends the event as readers see it, events
+// readers should not see are skipped
+func (s *socket) sendEvent(evt datastructs.Event) error {
+	evt, ok := comment.PublicEvent(evt)
+	if !ok {
+		return nil
+	}
+	return s.send(SocketMessage{Type: evt.Type, EventID: evt.ID, Comment: &evt.Comment})
+}
+
+func (s *socket) close(code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	s.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(socketWriteWait))
+}
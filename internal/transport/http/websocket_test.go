@@ -0,0 +1,90 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/imraan1901/comment-section-rest-api/internal/events"
+	"github.com/imraan1901/comment-section-rest-api/internal/transport/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSocketOrigin(t *testing.T) {
+
+	request := func(origin string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "http://comments.example.com/api/v1/ws", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		return r
+	}
+
+	t.Run("only this host by default", func(t *testing.T) {
+		h := &Handler{}
+		assert.True(t, h.checkOrigin(request("")))
+		assert.True(t, h.checkOrigin(request("https://comments.example.com")))
+		assert.False(t, h.checkOrigin(request("https://evil.example")))
+	})
+
+	t.Run("the allowed origins when set", func(t *testing.T) {
+		h := &Handler{AllowedOrigins: []string{"https://blog.example.com"}}
+		assert.True(t, h.checkOrigin(request("https://blog.example.com")))
+		assert.True(t, h.checkOrigin(request("HTTPS://Blog.Example.com")))
+		assert.False(t, h.checkOrigin(request("https://comments.example.com")))
+		assert.False(t, h.checkOrigin(request("http://blog.example.com")))
+
+		h.AllowedOrigins = []string{"*"}
+		assert.True(t, h.checkOrigin(request("https://evil.example")))
+	})
+}
+
+func TestSocketTokenExpiry(t *testing.T) {
+	s := &socket{h: &Handler{}}
+	claims := jwt.MapClaims{"sub": "user-1", "exp": float64(time.Now().Add(-time.Minute).Unix())}
+	ctx := auth.WithClaims(context.Background(), claims)
+
+	msg := s.handle(ctx, SocketRequest{ID: "1", Type: SocketAddReaction, CommentID: "c1", Reaction: "like"})
+	assert.Equal(t, SocketError, msg.Type)
+	assert.Equal(t, http.StatusUnauthorized, msg.Status)
+	assert.Equal(t, "token expired", msg.Error)
+}
+
+func TestSocketUnsubscribe(t *testing.T) {
+	hub := events.NewHub()
+	server := httptest.NewServer(http.HandlerFunc((&Handler{Hub: hub}).Socket))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	read := func() SocketMessage {
+		var msg SocketMessage
+		require.NoError(t, conn.ReadJSON(&msg))
+		return msg
+	}
+
+	// Sent back to back, the unsubscribe must not be overtaken by
+	// the subscribe still waiting on the writer
+	require.NoError(t, conn.WriteJSON(SocketRequest{ID: "1", Type: SocketSubscribe, Slug: "post"}))
+	require.NoError(t, conn.WriteJSON(SocketRequest{ID: "2", Type: SocketUnsubscribe, Slug: "post"}))
+	assert.Equal(t, "1", read().ID)
+	assert.Equal(t, "2", read().ID)
+
+	cmt := datastructs.Comment{ID: "c1", Slug: "post", ModerationStatus: datastructs.ModerationApproved}
+	require.NoError(t, hub.HandleCommentEvent(context.Background(), datastructs.Event{ID: "e1", Type: datastructs.EventCommentCreated, Comment: cmt}))
+
+	require.NoError(t, conn.WriteJSON(SocketRequest{ID: "3", Type: SocketSubscribe, Slug: "other"}))
+	msg := read()
+	assert.Equal(t, SocketReply, msg.Type)
+	assert.Equal(t, "3", msg.ID)
+}
@@ -0,0 +1,254 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	uuid "github.com/satori/go.uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// DefaultInterval - how often the dispatcher looks for deliveries
+	DefaultInterval = 5 * time.Second
+	// MaxAttempts - a delivery that failed this many times is given up on
+	MaxAttempts = 8
+	// leaseDuration - how long a delivery being sent is hidden from
+	// other dispatchers, a crash mid send is retried after it
+	leaseDuration = 5 * time.Minute
+	// batchSize - the most deliveries sent per tick
+	batchSize = 20
+	// requestTimeout - how long a webhook has to answer
+	requestTimeout = 10 * time.Second
+	// maxErrorBody - how much of a failed response is kept in the log
+	maxErrorBody = 512
+	baseBackoff  = 30 * time.Second
+	maxBackoff   = time.Hour
+)
+
+// Store - the methods the dispatcher needs to queue and log deliveries
+type Store interface {
+	// CreateWebhookDeliveries - a pending delivery of the payload to
+	// every active webhook that wants the event type
+	CreateWebhookDeliveries(ctx context.Context, eventID string, eventType string, payload string) (int, error)
+	// LeaseWebhookDeliveries - pending and retrying deliveries due by now,
+	// hidden from other callers until the lease ends
+	LeaseWebhookDeliveries(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]datastructs.WebhookDelivery, error)
+	// RecordWebhookAttempt - logs how sending went
+	RecordWebhookAttempt(ctx context.Context, delivery datastructs.WebhookDelivery, nextAttempt time.Time) error
+}
+
+// Dispatcher - queues a delivery for every comment event
+// and sends the queued deliveries in the background
+type Dispatcher struct {
+	Store    Store
+	Client   *http.Client
+	Interval time.Duration
+	// now - the clock, swapped out by tests
+	now func() time.Time
+}
+
+// ErrPrivateAddress - the webhook resolved to an address inside our network
+var ErrPrivateAddress = errors.New("webhook address is not public")
+
+// publicOnly - a net.Dialer Control that refuses addresses inside our
+// network. Whoever registers a webhook picks its URL, it must not be
+// able to reach services that trust internal callers. It runs on the
+// resolved address so a name that points inside is refused as well
+func publicOnly(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+func NewDispatcher(store Store) *Dispatcher {
+	dialer := &net.Dialer{
+		Timeout:   requestTimeout,
+		KeepAlive: 30 * time.Second,
+		Control:   publicOnly,
+	}
+	return &Dispatcher{
+		Store: store,
+		Client: &http.Client{
+			Timeout: requestTimeout,
+			// No proxy, it would be dialled instead of the webhook
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				MaxIdleConns:        100,
+				IdleConnTimeout:     90 * time.Second,
+				TLSHandshakeTimeout: requestTimeout,
+			},
+			// A redirect is not a delivery, the webhook should be updated
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		Interval: DefaultInterval,
+		now:      time.Now,
+	}
+}
+
+// HandleCommentEvent - queues the event for every webhook that
+// wants it, sending happens later so a slow webhook never holds
+// up the events behind it
+func (d *Dispatcher) HandleCommentEvent(ctx context.Context, evt datastructs.Event) error {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(ctx, "HandleCommentEvent", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	// Relayed events keep their id, so a repeat can be spotted downstream
+	id := evt.ID
+	if id == "" {
+		id = uuid.NewV4().String()
+	}
+	payload := Payload{
+		ID:         id,
+		Type:       evt.Type,
+		OccurredAt: evt.OccurredAt,
+		Comment:    evt.Comment,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	if _, err := d.Store.CreateWebhookDeliveries(ctx, payload.ID, payload.Type, string(body)); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
+// Run - ticks until the context is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		d.Tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick - sends every delivery that is due, failures are logged
+// against the delivery and retried by a later tick
+func (d *Dispatcher) Tick(ctx context.Context) {
+
+	startTime := time.Now()
+	ctx, span := otel.Tracer(name).Start(ctx, "Tick", tr.WithTimestamp(startTime))
+	defer span.End(tr.WithTimestamp(time.Now()))
+
+	deliveries, err := d.Store.LeaseWebhookDeliveries(ctx, d.now().UTC(), batchSize, leaseDuration)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	for _, delivery := range deliveries {
+		d.deliver(ctx, delivery)
+	}
+}
+
+// deliver - one attempt at a delivery, the lease already counted it
+func (d *Dispatcher) deliver(ctx context.Context, delivery datastructs.WebhookDelivery) {
+
+	span := tr.SpanFromContext(ctx)
+
+	status, err := d.post(ctx, delivery)
+	delivery.ResponseStatus = status
+
+	now := d.now().UTC()
+	var nextAttempt time.Time
+	switch {
+	case err == nil:
+		delivery.Status = datastructs.WebhookDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= MaxAttempts:
+		delivery.Status = datastructs.WebhookFailed
+		delivery.LastError = err.Error()
+	default:
+		delivery.Status = datastructs.WebhookRetrying
+		delivery.LastError = err.Error()
+		nextAttempt = now.Add(backoff(delivery.Attempts))
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+
+	if err := d.Store.RecordWebhookAttempt(ctx, delivery, nextAttempt); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// post - sends the signed payload, anything but a 2xx is a failure
+func (d *Dispatcher) post(ctx context.Context, delivery datastructs.WebhookDelivery) (int, error) {
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	timestamp := d.now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "comment-section-webhooks/1")
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, body))
+
+	res, err := d.Client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to deliver webhook: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+		return res.StatusCode, fmt.Errorf("webhook answered %s: %s", res.Status, bytes.TrimSpace(snippet))
+	}
+	// Read what is left so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	return res.StatusCode, nil
+}
+
+// backoff - doubles from 30 seconds after each failed attempt
+func backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts > 20 {
+		return maxBackoff
+	}
+	wait := baseBackoff << (attempts - 1)
+	if wait > maxBackoff {
+		return maxBackoff
+	}
+	return wait
+}
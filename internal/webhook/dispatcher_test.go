@@ -0,0 +1,183 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	created  []string
+	due      []datastructs.WebhookDelivery
+	recorded []datastructs.WebhookDelivery
+	next     []time.Time
+}
+
+func (s *fakeStore) CreateWebhookDeliveries(ctx context.Context, eventID string, eventType string, payload string) (int, error) {
+	s.created = append(s.created, payload)
+	return 1, nil
+}
+
+func (s *fakeStore) LeaseWebhookDeliveries(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]datastructs.WebhookDelivery, error) {
+	due := s.due
+	s.due = nil
+	return due, nil
+}
+
+func (s *fakeStore) RecordWebhookAttempt(ctx context.Context, delivery datastructs.WebhookDelivery, nextAttempt time.Time) error {
+	s.recorded = append(s.recorded, delivery)
+	s.next = append(s.next, nextAttempt)
+	return nil
+}
+
+func TestSign(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	signature := Sign("secret", at, []byte(`{"ID":"1"}`))
+
+	assert.True(t, Verify("secret", "1700000000", []byte(`{"ID":"1"}`), signature))
+	assert.False(t, Verify("other", "1700000000", []byte(`{"ID":"1"}`), signature))
+	assert.False(t, Verify("secret", "1700000001", []byte(`{"ID":"1"}`), signature))
+	assert.False(t, Verify("secret", "1700000000", []byte(`{"ID":"2"}`), signature))
+}
+
+func TestDispatcher(t *testing.T) {
+
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	newDispatcher := func(store *fakeStore) *Dispatcher {
+		d := NewDispatcher(store)
+		d.now = func() time.Time { return now }
+		// The test servers listen on loopback, which is refused
+		d.Client.Transport = http.DefaultTransport
+		return d
+	}
+	delivery := func(url string, attempts int) datastructs.WebhookDelivery {
+		return datastructs.WebhookDelivery{
+			ID:        "d1",
+			EventType: datastructs.EventCommentCreated,
+			Payload:   `{"ID":"e1"}`,
+			Attempts:  attempts,
+			URL:       url,
+			Secret:    "secret",
+		}
+	}
+
+	t.Run("queues a payload for each event", func(t *testing.T) {
+		store := &fakeStore{}
+		err := newDispatcher(store).HandleCommentEvent(context.Background(), datastructs.Event{
+			ID:      "e1",
+			Type:    datastructs.EventCommentDeleted,
+			Comment: datastructs.Comment{ID: "c1"},
+		})
+		require.NoError(t, err)
+
+		require.Len(t, store.created, 1)
+		var payload Payload
+		require.NoError(t, json.Unmarshal([]byte(store.created[0]), &payload))
+		assert.Equal(t, datastructs.EventCommentDeleted, payload.Type)
+		assert.Equal(t, "c1", payload.Comment.ID)
+		assert.Equal(t, "e1", payload.ID)
+	})
+
+	t.Run("sends a signed delivery", func(t *testing.T) {
+		var verified bool
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			verified = Verify("secret", r.Header.Get(HeaderTimestamp), body, r.Header.Get(HeaderSignature))
+			assert.Equal(t, datastructs.EventCommentCreated, r.Header.Get(HeaderEvent))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		store := &fakeStore{due: []datastructs.WebhookDelivery{delivery(server.URL, 1)}}
+		newDispatcher(store).Tick(context.Background())
+
+		assert.True(t, verified)
+		require.Len(t, store.recorded, 1)
+		assert.Equal(t, datastructs.WebhookDelivered, store.recorded[0].Status)
+		assert.Equal(t, http.StatusNoContent, store.recorded[0].ResponseStatus)
+	})
+
+	t.Run("retries an error response with backoff", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		store := &fakeStore{due: []datastructs.WebhookDelivery{delivery(server.URL, 3)}}
+		newDispatcher(store).Tick(context.Background())
+
+		require.Len(t, store.recorded, 1)
+		assert.Equal(t, datastructs.WebhookRetrying, store.recorded[0].Status)
+		assert.Equal(t, http.StatusServiceUnavailable, store.recorded[0].ResponseStatus)
+		assert.Contains(t, store.recorded[0].LastError, "down for maintenance")
+		assert.Equal(t, now.Add(2*time.Minute), store.next[0])
+	})
+
+	t.Run("does not follow redirects", func(t *testing.T) {
+		var followed bool
+		target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			followed = true
+		}))
+		defer target.Close()
+		server := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+		defer server.Close()
+
+		store := &fakeStore{due: []datastructs.WebhookDelivery{delivery(server.URL, 1)}}
+		newDispatcher(store).Tick(context.Background())
+
+		assert.False(t, followed)
+		assert.Equal(t, datastructs.WebhookRetrying, store.recorded[0].Status)
+		assert.Equal(t, http.StatusTemporaryRedirect, store.recorded[0].ResponseStatus)
+	})
+
+	t.Run("refuses addresses inside the network", func(t *testing.T) {
+		var called bool
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+		defer server.Close()
+
+		store := &fakeStore{due: []datastructs.WebhookDelivery{delivery(server.URL, 1)}}
+		d := NewDispatcher(store)
+		d.now = func() time.Time { return now }
+		d.Tick(context.Background())
+
+		assert.False(t, called)
+		require.Len(t, store.recorded, 1)
+		assert.Contains(t, store.recorded[0].LastError, ErrPrivateAddress.Error())
+	})
+
+	t.Run("gives up after the last attempt", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		store := &fakeStore{due: []datastructs.WebhookDelivery{delivery(server.URL, MaxAttempts)}}
+		newDispatcher(store).Tick(context.Background())
+
+		assert.Equal(t, datastructs.WebhookFailed, store.recorded[0].Status)
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, backoff(1))
+	assert.Equal(t, 4*time.Minute, backoff(4))
+	assert.Equal(t, maxBackoff, backoff(MaxAttempts))
+	assert.Equal(t, maxBackoff, backoff(100))
+}
+
+func TestPublicOnly(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1:80", "[::1]:80", "10.0.0.1:80", "192.168.1.1:443", "169.254.169.254:80", "0.0.0.0:80", "[fe80::1]:80"} {
+		assert.ErrorIs(t, publicOnly("tcp", addr, nil), ErrPrivateAddress, addr)
+	}
+	assert.NoError(t, publicOnly("tcp", "93.184.216.34:443", nil))
+}
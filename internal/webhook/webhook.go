@@ -0,0 +1,57 @@
+package webhook
+
+// Tells other services about comment events by POSTing
+// signed JSON to the webhooks they registered
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imraan1901/comment-section-rest-api/internal/datastructs"
+)
+
+// name is the Tracer name used to identify this instrumentation library.
+const name = "webhook"
+
+// Headers sent with every delivery
+const (
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Payload - the body of a delivery, ID is the same for every
+// webhook and every retry so receivers can drop duplicates
+type Payload struct {
+	ID         string
+	Type       string
+	OccurredAt time.Time
+	Comment    datastructs.Comment
+}
+
+// Sign - "sha256=" and the hex HMAC-SHA256 of the timestamp, a dot
+// and the body. Signing the timestamp lets receivers turn away old
+// deliveries being replayed at them
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify - checks a signature in constant time, for receivers
+// written in Go and for our own tests
+func Verify(secret string, timestamp string, body []byte, signature string) bool {
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	expected := Sign(secret, time.Unix(unix, 0), body)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
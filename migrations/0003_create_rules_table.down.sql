@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS rules;
+
+DROP INDEX IF EXISTS comments_created_at_idx;
+DROP INDEX IF EXISTS comments_author_created_at_idx;
+
+ALTER TABLE comments
+    DROP COLUMN Created_At,
+    DROP COLUMN Moderation_Status;
@@ -0,0 +1,16 @@
+ALTER TABLE comments
+    ADD COLUMN Created_At timestamptz NOT NULL DEFAULT now(),
+    ADD COLUMN Moderation_Status text NOT NULL DEFAULT 'approved';
+
+CREATE INDEX IF NOT EXISTS comments_author_created_at_idx ON comments (Author, Created_At);
+CREATE INDEX IF NOT EXISTS comments_created_at_idx ON comments (Created_At);
+
+CREATE TABLE IF NOT EXISTS rules (
+    ID uuid PRIMARY KEY,
+    Name text NOT NULL,
+    Conditions jsonb NOT NULL,
+    Action text NOT NULL,
+    Enabled boolean NOT NULL DEFAULT true,
+    Hits bigint NOT NULL DEFAULT 0,
+    Created_At timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS spam_models;
+DROP TABLE IF EXISTS spam_training;
+
+ALTER TABLE comments
+    DROP COLUMN Spam_Score;
@@ -0,0 +1,15 @@
+ALTER TABLE comments
+    ADD COLUMN Spam_Score double precision NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS spam_training (
+    Comment_ID uuid PRIMARY KEY,
+    Body text NOT NULL,
+    Is_Spam boolean NOT NULL,
+    Created_At timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS spam_models (
+    ID bigserial PRIMARY KEY,
+    Model jsonb NOT NULL,
+    Created_At timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,13 @@
+DROP INDEX IF EXISTS comments_sim_hash_band_7_idx;
+DROP INDEX IF EXISTS comments_sim_hash_band_6_idx;
+DROP INDEX IF EXISTS comments_sim_hash_band_5_idx;
+DROP INDEX IF EXISTS comments_sim_hash_band_4_idx;
+DROP INDEX IF EXISTS comments_sim_hash_band_3_idx;
+DROP INDEX IF EXISTS comments_sim_hash_band_2_idx;
+DROP INDEX IF EXISTS comments_sim_hash_band_1_idx;
+DROP INDEX IF EXISTS comments_sim_hash_band_0_idx;
+DROP INDEX IF EXISTS comments_author_body_hash_idx;
+
+ALTER TABLE comments
+    DROP COLUMN Body_Hash,
+    DROP COLUMN Sim_Hash;
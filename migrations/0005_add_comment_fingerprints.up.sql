@@ -0,0 +1,15 @@
+ALTER TABLE comments
+    ADD COLUMN Body_Hash text,
+    ADD COLUMN Sim_Hash bigint;
+
+CREATE INDEX IF NOT EXISTS comments_author_body_hash_idx ON comments (Author, Body_Hash, Created_At);
+
+-- One index per 8 bit SimHash band, see processor.SimHashBands
+CREATE INDEX IF NOT EXISTS comments_sim_hash_band_0_idx ON comments ((Sim_Hash & 255));
+CREATE INDEX IF NOT EXISTS comments_sim_hash_band_1_idx ON comments (((Sim_Hash >> 8) & 255));
+CREATE INDEX IF NOT EXISTS comments_sim_hash_band_2_idx ON comments (((Sim_Hash >> 16) & 255));
+CREATE INDEX IF NOT EXISTS comments_sim_hash_band_3_idx ON comments (((Sim_Hash >> 24) & 255));
+CREATE INDEX IF NOT EXISTS comments_sim_hash_band_4_idx ON comments (((Sim_Hash >> 32) & 255));
+CREATE INDEX IF NOT EXISTS comments_sim_hash_band_5_idx ON comments (((Sim_Hash >> 40) & 255));
+CREATE INDEX IF NOT EXISTS comments_sim_hash_band_6_idx ON comments (((Sim_Hash >> 48) & 255));
+CREATE INDEX IF NOT EXISTS comments_sim_hash_band_7_idx ON comments (((Sim_Hash >> 56) & 255));
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS pii_settings;
+
+ALTER TABLE comments
+    DROP COLUMN Site,
+    DROP COLUMN PII_Categories;
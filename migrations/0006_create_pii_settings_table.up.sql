@@ -0,0 +1,9 @@
+ALTER TABLE comments
+    ADD COLUMN Site text NOT NULL DEFAULT 'default',
+    ADD COLUMN PII_Categories text[];
+
+CREATE TABLE IF NOT EXISTS pii_settings (
+    Site text PRIMARY KEY,
+    Mode text NOT NULL,
+    Updated_At timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,2 @@
+ALTER TABLE comments
+    DROP COLUMN Body_HTML;
@@ -0,0 +1,2 @@
+ALTER TABLE comments
+    ADD COLUMN Body_HTML text;
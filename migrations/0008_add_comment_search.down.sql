@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS comments_search_vector_idx;
+DROP TRIGGER IF EXISTS comments_search_vector_trigger ON comments;
+DROP FUNCTION IF EXISTS comments_search_vector_update();
+
+ALTER TABLE comments
+    DROP COLUMN Search_Vector;
@@ -0,0 +1,18 @@
+ALTER TABLE comments
+    ADD COLUMN Search_Vector tsvector;
+
+-- Index what readers see, so redacted PII can not be searched for
+CREATE OR REPLACE FUNCTION comments_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.Search_Vector := to_tsvector('english', coalesce(NEW.Processed_Body, NEW.Body, ''));
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER comments_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF Body, Processed_Body ON comments
+    FOR EACH ROW EXECUTE FUNCTION comments_search_vector_update();
+
+UPDATE comments SET Search_Vector = to_tsvector('english', coalesce(Processed_Body, Body, ''));
+
+CREATE INDEX IF NOT EXISTS comments_search_vector_idx ON comments USING GIN (Search_Vector);
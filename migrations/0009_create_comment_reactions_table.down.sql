@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS comment_reactions;
+
+ALTER TABLE comments
+    DROP CONSTRAINT IF EXISTS comments_pkey;
@@ -0,0 +1,12 @@
+ALTER TABLE comments
+    ADD PRIMARY KEY (ID);
+
+CREATE TABLE IF NOT EXISTS comment_reactions (
+    Comment_ID uuid NOT NULL REFERENCES comments (ID) ON DELETE CASCADE,
+    User_ID text NOT NULL,
+    Reaction text NOT NULL,
+    Created_At timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (Comment_ID, User_ID, Reaction)
+);
+
+CREATE INDEX IF NOT EXISTS comment_reactions_user_idx ON comment_reactions (User_ID, Comment_ID);
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS comments_slug_new_idx;
+DROP INDEX IF EXISTS comments_slug_top_idx;
+DROP INDEX IF EXISTS comments_slug_best_idx;
+DROP INDEX IF EXISTS comments_slug_controversial_idx;
+
+ALTER TABLE comments
+    DROP COLUMN IF EXISTS Upvotes,
+    DROP COLUMN IF EXISTS Downvotes,
+    DROP COLUMN IF EXISTS Score,
+    DROP COLUMN IF EXISTS Wilson_Score,
+    DROP COLUMN IF EXISTS Controversy;
@@ -0,0 +1,33 @@
+ALTER TABLE comments
+    ADD COLUMN Upvotes integer NOT NULL DEFAULT 0,
+    ADD COLUMN Downvotes integer NOT NULL DEFAULT 0,
+    ADD COLUMN Score integer NOT NULL DEFAULT 0,
+    ADD COLUMN Wilson_Score double precision NOT NULL DEFAULT 0,
+    ADD COLUMN Controversy double precision NOT NULL DEFAULT 0;
+
+-- Votes cast before these columns existed, the formulas match internal/ranking
+WITH votes AS (
+    SELECT Comment_ID,
+        COUNT(*) FILTER (WHERE Reaction = 'up') AS ups,
+        COUNT(*) FILTER (WHERE Reaction = 'down') AS downs
+    FROM comment_reactions
+    GROUP BY Comment_ID
+)
+UPDATE comments c SET
+    Upvotes = v.ups,
+    Downvotes = v.downs,
+    Score = v.ups - v.downs,
+    Wilson_Score = CASE WHEN v.ups + v.downs = 0 THEN 0 ELSE
+        (v.ups::float8 / (v.ups + v.downs) + 1.96 * 1.96 / (2 * (v.ups + v.downs))
+            - 1.96 * sqrt((v.ups::float8 / (v.ups + v.downs) * (v.downs::float8 / (v.ups + v.downs))
+                + 1.96 * 1.96 / (4 * (v.ups + v.downs))) / (v.ups + v.downs)))
+        / (1 + 1.96 * 1.96 / (v.ups + v.downs)) END,
+    Controversy = CASE WHEN v.ups = 0 OR v.downs = 0 THEN 0 ELSE
+        power((v.ups + v.downs)::float8, LEAST(v.ups, v.downs)::float8 / GREATEST(v.ups, v.downs)) END
+FROM votes v
+WHERE c.ID = v.Comment_ID;
+
+CREATE INDEX IF NOT EXISTS comments_slug_new_idx ON comments (Slug, Moderation_Status, Created_At);
+CREATE INDEX IF NOT EXISTS comments_slug_top_idx ON comments (Slug, Moderation_Status, Score DESC, Created_At DESC);
+CREATE INDEX IF NOT EXISTS comments_slug_best_idx ON comments (Slug, Moderation_Status, Wilson_Score DESC, Created_At DESC);
+CREATE INDEX IF NOT EXISTS comments_slug_controversial_idx ON comments (Slug, Moderation_Status, Controversy DESC, Created_At DESC);
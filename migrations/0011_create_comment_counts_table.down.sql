@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS comment_counts_update_trigger ON comments;
+DROP TRIGGER IF EXISTS comment_counts_insert_delete_trigger ON comments;
+DROP FUNCTION IF EXISTS comment_counts_update();
+
+DROP TABLE IF EXISTS comment_counts;
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS comment_counts (
+    Slug text PRIMARY KEY,
+    Count bigint NOT NULL DEFAULT 0
+);
+
+-- Only approved comments are shown, so only they are counted. Running in the
+-- same transaction as the write keeps the count in step with PostComment,
+-- DeleteComment and every change of moderation status
+CREATE OR REPLACE FUNCTION comment_counts_update() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.Slug IS NOT NULL AND OLD.Moderation_Status = 'approved' THEN
+        UPDATE comment_counts SET Count = Count - 1 WHERE Slug = OLD.Slug;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.Slug IS NOT NULL AND NEW.Moderation_Status = 'approved' THEN
+        INSERT INTO comment_counts (Slug, Count) VALUES (NEW.Slug, 1)
+        ON CONFLICT (Slug) DO UPDATE SET Count = comment_counts.Count + 1;
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER comment_counts_insert_delete_trigger
+    AFTER INSERT OR DELETE ON comments
+    FOR EACH ROW EXECUTE FUNCTION comment_counts_update();
+
+CREATE TRIGGER comment_counts_update_trigger
+    AFTER UPDATE OF Slug, Moderation_Status ON comments
+    FOR EACH ROW
+    WHEN (OLD.Slug IS DISTINCT FROM NEW.Slug OR OLD.Moderation_Status IS DISTINCT FROM NEW.Moderation_Status)
+    EXECUTE FUNCTION comment_counts_update();
+
+INSERT INTO comment_counts (Slug, Count)
+SELECT Slug, COUNT(*) FROM comments
+WHERE Slug IS NOT NULL AND Moderation_Status = 'approved'
+GROUP BY Slug;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS threads (
+    Slug text PRIMARY KEY,
+    State text NOT NULL DEFAULT 'open',
+    Max_Length integer NOT NULL DEFAULT 0,
+    Moderation_Mode text NOT NULL DEFAULT 'post',
+    Updated_At timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS threads_state_idx ON threads (State);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS comments_slug_pinned_idx;
+
+ALTER TABLE comments
+    DROP COLUMN IF EXISTS Pin_Position,
+    DROP COLUMN IF EXISTS Featured;
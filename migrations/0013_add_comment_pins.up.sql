@@ -0,0 +1,5 @@
+ALTER TABLE comments
+    ADD COLUMN Pin_Position integer,
+    ADD COLUMN Featured boolean NOT NULL DEFAULT false;
+
+CREATE INDEX IF NOT EXISTS comments_slug_pinned_idx ON comments (Slug, Pin_Position) WHERE Pin_Position IS NOT NULL;
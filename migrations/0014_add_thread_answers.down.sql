@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS threads_kind_idx;
+
+ALTER TABLE threads
+    DROP COLUMN IF EXISTS Kind,
+    DROP COLUMN IF EXISTS Owner,
+    DROP COLUMN IF EXISTS Accepted_Answer_ID;
@@ -0,0 +1,6 @@
+ALTER TABLE threads
+    ADD COLUMN Kind text NOT NULL DEFAULT 'discussion',
+    ADD COLUMN Owner text,
+    ADD COLUMN Accepted_Answer_ID uuid REFERENCES comments (ID) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS threads_kind_idx ON threads (Kind);
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS notification_preferences;
+DROP TABLE IF EXISTS notifications;
+
+DROP INDEX IF EXISTS comments_parent_id_idx;
+
+ALTER TABLE comments
+    DROP COLUMN IF EXISTS Parent_ID,
+    DROP COLUMN IF EXISTS Mentions;
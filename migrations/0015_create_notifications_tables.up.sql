@@ -0,0 +1,28 @@
+ALTER TABLE comments
+    ADD COLUMN Parent_ID uuid REFERENCES comments (ID) ON DELETE SET NULL,
+    ADD COLUMN Mentions text[];
+
+CREATE INDEX IF NOT EXISTS comments_parent_id_idx ON comments (Parent_ID);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    ID uuid PRIMARY KEY,
+    User_ID text NOT NULL,
+    Kind text NOT NULL,
+    Comment_ID uuid NOT NULL REFERENCES comments (ID) ON DELETE CASCADE,
+    Slug text NOT NULL,
+    Actor text NOT NULL,
+    Read_At timestamptz,
+    Created_At timestamptz NOT NULL DEFAULT now(),
+    -- A comment approved, held and approved again only notifies once
+    UNIQUE (User_ID, Comment_ID, Kind)
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_created_at_idx ON notifications (User_ID, Created_At DESC);
+CREATE INDEX IF NOT EXISTS notifications_user_unread_idx ON notifications (User_ID) WHERE Read_At IS NULL;
+
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    User_ID text PRIMARY KEY,
+    Mentions boolean NOT NULL DEFAULT true,
+    Replies boolean NOT NULL DEFAULT true,
+    Updated_At timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,7 @@
+ALTER TABLE notification_preferences
+    DROP COLUMN IF EXISTS Subscriptions;
+
+ALTER TABLE notifications
+    DROP COLUMN IF EXISTS Unsubscribe_Token;
+
+DROP TABLE IF EXISTS subscriptions;
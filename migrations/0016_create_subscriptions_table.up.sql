@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS subscriptions (
+    ID uuid PRIMARY KEY,
+    User_ID text NOT NULL,
+    Slug text NOT NULL,
+    Comment_ID uuid REFERENCES comments (ID) ON DELETE CASCADE,
+    Unsubscribe_Token text NOT NULL UNIQUE,
+    Created_At timestamptz NOT NULL DEFAULT now()
+);
+
+-- A user follows a slug or a comment at most once, a NULL comment is the whole slug
+CREATE UNIQUE INDEX IF NOT EXISTS subscriptions_user_target_idx ON subscriptions
+    (User_ID, Slug, (COALESCE(Comment_ID, '00000000-0000-0000-0000-000000000000'::uuid)));
+CREATE INDEX IF NOT EXISTS subscriptions_slug_idx ON subscriptions (Slug);
+
+ALTER TABLE notifications
+    ADD COLUMN Unsubscribe_Token text;
+
+ALTER TABLE notification_preferences
+    ADD COLUMN Subscriptions boolean NOT NULL DEFAULT true;
@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS notification_preferences_digest_idx;
+DROP INDEX IF EXISTS notifications_digest_id_idx;
+
+ALTER TABLE notifications
+    DROP COLUMN IF EXISTS Digest_ID;
+
+DROP TABLE IF EXISTS email_digests;
+
+ALTER TABLE notification_preferences
+    DROP COLUMN IF EXISTS Email,
+    DROP COLUMN IF EXISTS Digest_Frequency,
+    DROP COLUMN IF EXISTS Email_Bounced_At;
@@ -0,0 +1,30 @@
+ALTER TABLE notification_preferences
+    ADD COLUMN Email text NOT NULL DEFAULT '',
+    ADD COLUMN Digest_Frequency text NOT NULL DEFAULT 'off',
+    ADD COLUMN Email_Bounced_At timestamptz;
+
+-- Every digest built is kept, this is the log of what was emailed
+CREATE TABLE IF NOT EXISTS email_digests (
+    ID uuid PRIMARY KEY,
+    User_ID text NOT NULL,
+    Email text NOT NULL,
+    Frequency text NOT NULL,
+    Status text NOT NULL DEFAULT 'pending',
+    Attempts integer NOT NULL DEFAULT 0,
+    Last_Error text NOT NULL DEFAULT '',
+    Next_Attempt_At timestamptz NOT NULL DEFAULT now(),
+    Created_At timestamptz NOT NULL DEFAULT now(),
+    Sent_At timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS email_digests_user_created_at_idx ON email_digests (User_ID, Created_At DESC);
+CREATE INDEX IF NOT EXISTS email_digests_due_idx ON email_digests (Next_Attempt_At)
+    WHERE Status IN ('pending', 'retrying');
+
+-- The digest a notification went out in, a notification is only ever in one
+ALTER TABLE notifications
+    ADD COLUMN Digest_ID uuid REFERENCES email_digests (ID) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS notifications_digest_id_idx ON notifications (Digest_ID);
+CREATE INDEX IF NOT EXISTS notification_preferences_digest_idx ON notification_preferences (Digest_Frequency)
+    WHERE Digest_Frequency <> 'off';
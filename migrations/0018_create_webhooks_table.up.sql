@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+    ID uuid PRIMARY KEY,
+    URL text NOT NULL,
+    Events text[] NOT NULL DEFAULT '{}',
+    Secret text NOT NULL,
+    Active boolean NOT NULL DEFAULT true,
+    Created_At timestamptz NOT NULL DEFAULT now(),
+    Updated_At timestamptz NOT NULL DEFAULT now()
+);
+
+-- Every event sent to every webhook, this is the delivery log
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    ID uuid PRIMARY KEY,
+    Webhook_ID uuid NOT NULL REFERENCES webhooks (ID) ON DELETE CASCADE,
+    Event_ID uuid NOT NULL,
+    Event_Type text NOT NULL,
+    Payload text NOT NULL,
+    Status text NOT NULL DEFAULT 'pending',
+    Attempts integer NOT NULL DEFAULT 0,
+    Response_Status integer NOT NULL DEFAULT 0,
+    Last_Error text NOT NULL DEFAULT '',
+    Replay_Of uuid REFERENCES webhook_deliveries (ID) ON DELETE SET NULL,
+    Next_Attempt_At timestamptz NOT NULL DEFAULT now(),
+    Created_At timestamptz NOT NULL DEFAULT now(),
+    Delivered_At timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_created_at_idx ON webhook_deliveries (Webhook_ID, Created_At DESC);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (Next_Attempt_At)
+    WHERE Status IN ('pending', 'retrying');
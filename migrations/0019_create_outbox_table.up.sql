@@ -0,0 +1,15 @@
+-- Comment events, written in the same transaction as the change
+-- they describe and relayed to listeners in ID order
+CREATE TABLE IF NOT EXISTS outbox (
+    ID bigserial PRIMARY KEY,
+    Event_ID uuid NOT NULL UNIQUE,
+    Event_Type text NOT NULL,
+    Payload text NOT NULL,
+    Attempts integer NOT NULL DEFAULT 0,
+    Last_Error text NOT NULL DEFAULT '',
+    Created_At timestamptz NOT NULL DEFAULT now(),
+    Dispatched_At timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (ID) WHERE Dispatched_At IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_dispatched_at_idx ON outbox (Dispatched_At) WHERE Dispatched_At IS NOT NULL;
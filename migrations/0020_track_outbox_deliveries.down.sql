@@ -0,0 +1,3 @@
+ALTER TABLE outbox DROP COLUMN IF EXISTS Claimed_Until;
+ALTER TABLE outbox DROP COLUMN IF EXISTS Failed_To;
+ALTER TABLE outbox DROP COLUMN IF EXISTS Delivered_To;
@@ -0,0 +1,6 @@
+-- Which listeners have handled each event, so a retry only goes to
+-- the ones that failed, and which were given up on after every attempt.
+-- Claimed_Until leases events to the relay handing them out
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS Delivered_To text[] NOT NULL DEFAULT '{}';
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS Failed_To text[] NOT NULL DEFAULT '{}';
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS Claimed_Until timestamptz;
@@ -0,0 +1,2 @@
+-- Listeners read back the events written lately whose NOTIFY they missed
+CREATE INDEX IF NOT EXISTS outbox_created_at_idx ON outbox (Created_At);
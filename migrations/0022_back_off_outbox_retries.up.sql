@@ -0,0 +1,2 @@
+-- When a failed event is next relayed, later each time it fails
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS Next_Attempt_At timestamptz;